@@ -0,0 +1,474 @@
+package router
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	BindSourcePath   = "path"
+	BindSourceQuery  = "query"
+	BindSourceHeader = "header"
+	BindSourceForm   = "form"
+	BindSourceBody   = "body"
+
+	// DefaultMaxMemory is the multipart memory limit used when binding forms.
+	DefaultMaxMemory = 32 << 20
+)
+
+// FieldError describes a single value that could not be bound.
+type FieldError struct {
+	Field   string `json:"field"`
+	Source  string `json:"source"`
+	Message string `json:"message"`
+}
+
+// BindError is returned by Bind when one or more values could not be bound.
+// It collects every failure instead of stopping at the first one.
+type BindError struct {
+	Errors []FieldError
+	status int
+}
+
+func (e *BindError) Error() string {
+
+	if len(e.Errors) == 0 {
+		return "invalid request"
+	}
+
+	parts := make([]string, 0, len(e.Errors))
+	for _, fe := range e.Errors {
+		if fe.Field == "" {
+			parts = append(parts, fe.Source+": "+fe.Message)
+			continue
+		}
+		parts = append(parts, fe.Source+" "+fe.Field+": "+fe.Message)
+	}
+
+	return strings.Join(parts, "; ")
+}
+
+// StatusCode returns the HTTP status the error should be reported with.
+func (e *BindError) StatusCode() int {
+	if e.status == 0 {
+		return http.StatusBadRequest
+	}
+	return e.status
+}
+
+func (e *BindError) add(field, source, message string) {
+	e.Errors = append(e.Errors, FieldError{Field: field, Source: source, Message: message})
+}
+
+// Bind creates a T and fills it from the request. See BindInto.
+func Bind[T any](r *http.Request) (T, error) {
+	var v T
+	err := BindInto(r, &v)
+	return v, err
+}
+
+// BindInto fills the struct pointed to by dst from the request.
+//
+// The body is decoded first, as JSON, XML or a form depending on the
+// Content-Type. Fields tagged with `path:"name"`, `query:"name"`,
+// `header:"Name"` or `form:"name"` are then set from the matching request
+// value, converting strings to the field type. A `default:"value"` tag is used
+// when the value is absent, and a ",required" tag option reports a missing
+// value as an error.
+//
+// A body without a Content-Type is not decoded.
+//
+// All failures are returned together as a *BindError.
+func BindInto(r *http.Request, dst any) error {
+	return bindInto(r, dst, "")
+}
+
+// bindInto implements BindInto. A body without a Content-Type is decoded as
+// defaultType, if it is not empty.
+func bindInto(r *http.Request, dst any, defaultType string) error {
+
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		panic("bind destination must be a non-nil pointer to a struct")
+	}
+
+	rv = rv.Elem()
+	fields := bindFieldsOf(rv.Type())
+	bindErr := &BindError{}
+
+	for _, f := range fields {
+		if f.defaultValue == "" {
+			continue
+		}
+		if err := setField(fieldByIndex(rv, f.index), []string{f.defaultValue}); err != nil {
+			bindErr.add(f.name, f.source, "invalid default: "+err.Error())
+		}
+	}
+
+	isForm := decodeBody(r, rv.Addr().Interface(), bindErr, defaultType)
+	query := r.URL.Query()
+
+	for _, f := range fields {
+
+		var values []string
+
+		switch f.source {
+		case BindSourcePath:
+			if v := r.PathValue(f.name); v != "" {
+				values = []string{v}
+			}
+		case BindSourceQuery:
+			values = query[f.name]
+		case BindSourceHeader:
+			values = r.Header.Values(f.name)
+		case BindSourceForm:
+			if isForm {
+				values = r.PostForm[f.name]
+			}
+		}
+
+		if len(values) == 0 {
+			if f.required && f.defaultValue == "" {
+				bindErr.add(f.name, f.source, "required")
+			}
+			continue
+		}
+
+		if err := setField(fieldByIndex(rv, f.index), values); err != nil {
+			bindErr.add(f.name, f.source, err.Error())
+		}
+	}
+
+	if len(bindErr.Errors) > 0 {
+		return bindErr
+	}
+
+	return nil
+}
+
+// decodeBody decodes the request body into dst and reports whether the body
+// was a form, in which case form tagged fields are bound by the caller.
+func decodeBody(r *http.Request, dst any, bindErr *BindError, defaultType string) bool {
+
+	if r.Body == nil || r.Body == http.NoBody || r.ContentLength == 0 {
+		return false
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+
+		if defaultType == "" || !hasBody(r) {
+			return false
+		}
+
+		contentType = defaultType
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		bindErr.status = http.StatusUnsupportedMediaType
+		bindErr.add("", BindSourceBody, "invalid content type")
+		return false
+	}
+
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		dec := json.NewDecoder(r.Body)
+		if err := dec.Decode(dst); err != nil && !errors.Is(err, io.EOF) {
+			bindErr.add(jsonErrorField(err), BindSourceBody, jsonErrorMessage(err))
+		}
+	case mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml"):
+		if err := xml.NewDecoder(r.Body).Decode(dst); err != nil && !errors.Is(err, io.EOF) {
+			bindErr.add("", BindSourceBody, err.Error())
+		}
+	case mediaType == "application/x-www-form-urlencoded":
+		if err := r.ParseForm(); err != nil {
+			bindErr.add("", BindSourceBody, err.Error())
+			return false
+		}
+		return true
+	case mediaType == "multipart/form-data":
+		if err := r.ParseMultipartForm(DefaultMaxMemory); err != nil {
+			bindErr.add("", BindSourceBody, err.Error())
+			return false
+		}
+		return true
+	default:
+		bindErr.status = http.StatusUnsupportedMediaType
+		bindErr.add("", BindSourceBody, "unsupported content type "+mediaType)
+	}
+
+	return false
+}
+
+func jsonErrorField(err error) string {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return typeErr.Field
+	}
+	return ""
+}
+
+func jsonErrorMessage(err error) string {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return "expected " + typeErr.Type.String()
+	}
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return fmt.Sprintf("malformed json at offset %d", syntaxErr.Offset)
+	}
+	return err.Error()
+}
+
+type bindField struct {
+	index        []int
+	name         string
+	source       string
+	defaultValue string
+	required     bool
+	typ          reflect.Type
+}
+
+var bindFieldCache sync.Map // map[reflect.Type][]bindField
+
+// bindFieldsOf returns the tagged fields of t, including those of embedded
+// structs. The result is cached per type.
+func bindFieldsOf(t reflect.Type) []bindField {
+
+	if cached, ok := bindFieldCache.Load(t); ok {
+		return cached.([]bindField)
+	}
+
+	fields := collectBindFields(t, nil)
+	bindFieldCache.Store(t, fields)
+
+	return fields
+}
+
+func collectBindFields(t reflect.Type, parent []int) []bindField {
+
+	var fields []bindField
+
+	for i := 0; i < t.NumField(); i++ {
+
+		sf := t.Field(i)
+		index := append(append([]int{}, parent...), i)
+
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+			fields = append(fields, collectBindFields(sf.Type, index)...)
+			continue
+		}
+
+		if !sf.IsExported() {
+			continue
+		}
+
+		for _, source := range []string{BindSourcePath, BindSourceQuery, BindSourceHeader, BindSourceForm} {
+
+			tag, ok := sf.Tag.Lookup(source)
+			if !ok || tag == "-" {
+				continue
+			}
+
+			name, opts, _ := strings.Cut(tag, ",")
+			if name == "" {
+				name = sf.Name
+			}
+
+			fields = append(fields, bindField{
+				index:        index,
+				name:         name,
+				source:       source,
+				defaultValue: sf.Tag.Get("default"),
+				required:     opts == "required",
+				typ:          sf.Type,
+			})
+
+			break
+		}
+	}
+
+	return fields
+}
+
+// fieldByIndex is like reflect.Value.FieldByIndex but allocates nil embedded
+// struct pointers along the way.
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for _, i := range index {
+		if v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+	return v
+}
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	timeType            = reflect.TypeOf(time.Time{})
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+func setField(v reflect.Value, values []string) error {
+
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8 {
+
+		slice := reflect.MakeSlice(v.Type(), 0, len(values))
+
+		for _, s := range values {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := setValue(elem, s); err != nil {
+				return err
+			}
+			slice = reflect.Append(slice, elem)
+		}
+
+		v.Set(slice)
+
+		return nil
+	}
+
+	return setValue(v, values[0])
+}
+
+func setValue(v reflect.Value, s string) error {
+
+	if v.Kind() == reflect.Pointer {
+		ptr := reflect.New(v.Type().Elem())
+		if err := setValue(ptr.Elem(), s); err != nil {
+			return err
+		}
+		v.Set(ptr)
+		return nil
+	}
+
+	if v.CanAddr() && v.Addr().Type().Implements(textUnmarshalerType) {
+		if err := v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s)); err != nil {
+			return fmt.Errorf("invalid value %q", s)
+		}
+		return nil
+	}
+
+	switch v.Type() {
+	case durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", s)
+		}
+		v.SetInt(int64(d))
+		return nil
+	case timeType:
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return fmt.Errorf("invalid time %q, expected RFC 3339", s)
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", s)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", s)
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid unsigned integer %q", s)
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid number %q", s)
+		}
+		v.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported field type %s", v.Type())
+	}
+
+	return nil
+}
+
+// HasErrorHandler reports whether the router serving r has an
+// ErrorHandler, which WriteError and WriteBindError use. Middleware that
+// prefers problem details to plain text responses writes them with
+// WriteProblem when it does not.
+func HasErrorHandler(r *http.Request) bool {
+	config := configFrom(r)
+	return config != nil && config.ErrorHandler != nil
+}
+
+// WriteBindError writes err as a 400 Bad Request (or 415 Unsupported Media
+// Type) response listing every field that failed to bind. If the router
+// serving r has an ErrorHandler it is used instead.
+func WriteBindError(w http.ResponseWriter, r *http.Request, err error) {
+
+	if config := configFrom(r); config != nil && config.ErrorHandler != nil {
+		config.ErrorHandler(w, r, err)
+		return
+	}
+
+	var bindErr *BindError
+	if !errors.As(err, &bindErr) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(bindErr.StatusCode())
+
+	_ = json.NewEncoder(w).Encode(struct {
+		Errors []FieldError `json:"errors"`
+	}{bindErr.Errors})
+}
+
+// hasBody reports whether r has a non-empty body, reading ahead a byte when
+// its length is unknown.
+func hasBody(r *http.Request) bool {
+
+	if r.ContentLength > 0 {
+		return true
+	}
+
+	var b [1]byte
+
+	n, _ := io.ReadFull(r.Body, b[:])
+	if n == 0 {
+		return false
+	}
+
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(b[:n]), r.Body), r.Body}
+
+	return true
+}
@@ -0,0 +1,202 @@
+package router
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type bindPaging struct {
+	Page  int `query:"page" default:"1"`
+	Limit int `query:"limit" default:"20"`
+}
+
+type bindRequest struct {
+	bindPaging
+	ID      int64         `path:"id"`
+	Tenant  string        `header:"X-Tenant,required"`
+	Tags    []string      `query:"tag"`
+	Active  *bool         `query:"active"`
+	Timeout time.Duration `query:"timeout"`
+	Name    string        `json:"name" xml:"name"`
+}
+
+func TestBind_PathQueryHeader(t *testing.T) {
+
+	req, _ := http.NewRequest("GET", "/users/42?page=3&tag=a&tag=b&active=true&timeout=2s", nil)
+	req.SetPathValue("id", "42")
+	req.Header.Set("X-Tenant", "acme")
+
+	in, err := Bind[bindRequest](req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if in.ID != 42 {
+		t.Errorf("ID is: %d, expected: %d", in.ID, 42)
+	}
+
+	if in.Page != 3 || in.Limit != 20 {
+		t.Errorf("paging is: %d/%d, expected: %d/%d", in.Page, in.Limit, 3, 20)
+	}
+
+	if in.Tenant != "acme" {
+		t.Errorf("Tenant is: %s, expected: %s", in.Tenant, "acme")
+	}
+
+	if len(in.Tags) != 2 || in.Tags[0] != "a" || in.Tags[1] != "b" {
+		t.Errorf("Tags is: %v, expected: %v", in.Tags, []string{"a", "b"})
+	}
+
+	if in.Active == nil || !*in.Active {
+		t.Error("Active is not set to true")
+	}
+
+	if in.Timeout != 2*time.Second {
+		t.Errorf("Timeout is: %s, expected: %s", in.Timeout, 2*time.Second)
+	}
+}
+
+func TestBind_Body(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+	}{
+		{name: "JSON", contentType: "application/json", body: `{"name":"gopher"}`},
+		{name: "XML", contentType: "application/xml", body: `<bindRequest><name>gopher</name></bindRequest>`},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+
+			req, _ := http.NewRequest("POST", "/users", strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", tc.contentType)
+			req.Header.Set("X-Tenant", "acme")
+
+			in, err := Bind[bindRequest](req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if in.Name != "gopher" {
+				t.Errorf("Name is: %s, expected: %s", in.Name, "gopher")
+			}
+		})
+	}
+}
+
+func TestBind_Form(t *testing.T) {
+
+	type form struct {
+		Email string `form:"email"`
+		Age   uint8  `form:"age"`
+	}
+
+	req, _ := http.NewRequest("POST", "/signup", strings.NewReader("email=a%40b.c&age=30"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	in, err := Bind[form](req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if in.Email != "a@b.c" || in.Age != 30 {
+		t.Errorf("form is: %+v, expected: email=a@b.c age=30", in)
+	}
+}
+
+func TestBind_AggregatesErrors(t *testing.T) {
+
+	req, _ := http.NewRequest("GET", "/users/abc?page=x", nil)
+	req.SetPathValue("id", "abc")
+
+	_, err := Bind[bindRequest](req)
+
+	var bindErr *BindError
+	if !errors.As(err, &bindErr) {
+		t.Fatalf("error is: %v, expected a *BindError", err)
+	}
+
+	if len(bindErr.Errors) != 3 {
+		t.Fatalf("got %d errors, expected: 3 (%v)", len(bindErr.Errors), bindErr)
+	}
+
+	expected := []FieldError{
+		{Field: "page", Source: BindSourceQuery},
+		{Field: "id", Source: BindSourcePath},
+		{Field: "X-Tenant", Source: BindSourceHeader, Message: "required"},
+	}
+
+	for i, fe := range expected {
+		got := bindErr.Errors[i]
+		if got.Field != fe.Field || got.Source != fe.Source {
+			t.Errorf("error %d is: %s %s, expected: %s %s", i, got.Source, got.Field, fe.Source, fe.Field)
+		}
+	}
+
+	if bindErr.StatusCode() != http.StatusBadRequest {
+		t.Errorf("status is: %d, expected: %d", bindErr.StatusCode(), http.StatusBadRequest)
+	}
+}
+
+func TestBind_UnsupportedContentType(t *testing.T) {
+
+	req, _ := http.NewRequest("POST", "/users", strings.NewReader("name"))
+	req.Header.Set("Content-Type", "text/csv")
+	req.Header.Set("X-Tenant", "acme")
+
+	_, err := Bind[bindRequest](req)
+
+	var bindErr *BindError
+	if !errors.As(err, &bindErr) || bindErr.StatusCode() != http.StatusUnsupportedMediaType {
+		t.Errorf("error is: %v, expected a 415 *BindError", err)
+	}
+}
+
+func TestBind_MissingContentType(t *testing.T) {
+
+	req, _ := http.NewRequest("POST", "/users", strings.NewReader(`{"name":"gopher"}`))
+	req.Header.Set("X-Tenant", "acme")
+
+	got, err := Bind[bindRequest](req)
+	if err != nil {
+		t.Errorf("error is: %v, expected none", err)
+	}
+
+	if got.Name != "" {
+		t.Errorf("name is: %q, expected the body to be ignored", got.Name)
+	}
+
+	req, _ = http.NewRequest("POST", "/users", http.NoBody)
+	req.Header.Set("X-Tenant", "acme")
+
+	if _, err := Bind[bindRequest](req); err != nil {
+		t.Errorf("error is: %v, expected none for an empty body", err)
+	}
+}
+
+func TestWriteBindError(t *testing.T) {
+
+	req, _ := http.NewRequest("GET", "/users?page=x", nil)
+	req.Header.Set("X-Tenant", "acme")
+	w := httptest.NewRecorder()
+
+	_, err := Bind[bindRequest](req)
+	WriteBindError(w, req, err)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("response code is: %d, expected: %d", w.Code, http.StatusBadRequest)
+	}
+
+	expected := `{"errors":[{"field":"page","source":"query","message":"invalid integer \"x\""}]}`
+	if strings.TrimSpace(w.Body.String()) != expected {
+		t.Errorf("response body is: %s, expected: %s", w.Body.String(), expected)
+	}
+}
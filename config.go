@@ -7,6 +7,9 @@ type Option func(*Config)
 type Config struct {
 	NotFoundHandler         http.HandlerFunc
 	MethodNotAllowedHandler http.HandlerFunc
+	ErrorHandler            func(w http.ResponseWriter, r *http.Request, err error)
+	VersionHeader           string
+	DefaultVersion          string
 }
 
 func WithNotFoundHandler(handler http.HandlerFunc) Option {
@@ -30,3 +33,52 @@ func WithMethodNotAllowedHandler(handler http.HandlerFunc) Option {
 		c.MethodNotAllowedHandler = handler
 	}
 }
+
+// WithErrorHandler sets the function used by WriteError and WriteBindError,
+// and by the middleware package, to write error responses.
+func WithErrorHandler(handler func(w http.ResponseWriter, r *http.Request, err error)) Option {
+
+	if handler == nil {
+		panic("error handler must not be nil")
+	}
+
+	return func(c *Config) {
+		c.ErrorHandler = handler
+	}
+}
+
+// WithProblemDetails makes the router answer unmatched routes, disallowed
+// methods and every error written through WriteError with RFC 9457
+// application/problem+json bodies.
+func WithProblemDetails() Option {
+	return func(c *Config) {
+		c.NotFoundHandler = func(w http.ResponseWriter, r *http.Request) {
+			WriteProblem(w, r, NewHTTPError(http.StatusNotFound, ""))
+		}
+		c.MethodNotAllowedHandler = func(w http.ResponseWriter, r *http.Request) {
+			WriteProblem(w, r, NewHTTPError(http.StatusMethodNotAllowed, ""))
+		}
+		c.ErrorHandler = WriteProblem
+	}
+}
+
+// WithVersionHeader sets the request header used to select an API version
+// when the path does not contain one. It defaults to Api-Version.
+func WithVersionHeader(name string) Option {
+
+	if name == "" {
+		panic("version header must not be empty")
+	}
+
+	return func(c *Config) {
+		c.VersionHeader = name
+	}
+}
+
+// WithDefaultVersion sets the API version used when a request to a versioned
+// group selects none.
+func WithDefaultVersion(version string) Option {
+	return func(c *Config) {
+		c.DefaultVersion = version
+	}
+}
@@ -0,0 +1,182 @@
+package router
+
+import (
+	"context"
+	"net/http"
+)
+
+type contextKey int
+
+const (
+	requestContextKey contextKey = iota
+	requestIDKey
+)
+
+// requestContext is attached to the requests served by a router that may
+// read it. It is its own context.Context, wrapping the request's context,
+// so attaching it costs a single allocation besides the request copy.
+type requestContext struct {
+	context.Context
+
+	config    *Config
+	version   string
+	node      *routeTreeNode
+	route     *route
+	mediaType string
+}
+
+func withRequestContext(r *http.Request, rc *requestContext) *http.Request {
+	rc.Context = r.Context()
+	return r.WithContext(rc)
+}
+
+func (rc *requestContext) Value(key any) any {
+
+	if key == requestContextKey {
+		return rc
+	}
+
+	return rc.Context.Value(key)
+}
+
+func requestContextFrom(ctx context.Context) *requestContext {
+	rc, _ := ctx.Value(requestContextKey).(*requestContext)
+	return rc
+}
+
+func configFrom(r *http.Request) *Config {
+
+	if rc := requestContextFrom(r.Context()); rc != nil {
+		return rc.config
+	}
+
+	return nil
+}
+
+// WithRouteContext prepares r for a router so that, once the router has
+// served it, RouteFromContext and MetaFromContext called with the context
+// of r report the matched route. Middleware that wraps a Router, rather
+// than being added with Use, needs it to see the route of the request. It
+// returns r unchanged if it has already been prepared or routed.
+func WithRouteContext(r *http.Request) *http.Request {
+
+	if requestContextFrom(r.Context()) != nil {
+		return r
+	}
+
+	return withRequestContext(r, &requestContext{})
+}
+
+// RouteFromContext returns the descriptor of the route matched for the
+// request, including its metadata. It reports false if no route matched, for
+// example when the method is not allowed. The descriptor must not be
+// modified.
+//
+// To keep plain routes free of allocations, the router only records the
+// route for middleware, routes with metadata, tags or content negotiation,
+// routers with an ErrorHandler or versions, and requests prepared with
+// WithRouteContext. In the handler of any other route it reports false.
+func RouteFromContext(ctx context.Context) (RouteDescriptor, bool) {
+
+	rc := requestContextFrom(ctx)
+	if rc == nil || rc.route == nil {
+		return RouteDescriptor{}, false
+	}
+
+	return rc.route.descriptor(), true
+}
+
+// PatternFromContext returns the pattern of the route matched for the
+// request, such as "/users/:id". If the path matched but no route accepts
+// the method, the pattern of the path is returned. It returns an empty
+// string for requests that matched no path. Unlike the path, the pattern
+// is safe to use as a metric label or span name.
+//
+// The pattern is recorded under the same conditions as the route described
+// by RouteFromContext; in the handler of a plain route without middleware,
+// metadata or tags it returns an empty string unless the request was
+// prepared with WithRouteContext.
+func PatternFromContext(ctx context.Context) string {
+
+	rc := requestContextFrom(ctx)
+	if rc == nil {
+		return ""
+	}
+
+	p := ""
+
+	switch {
+	case rc.route != nil:
+		p = rc.route.path
+	case rc.node != nil:
+		p = rc.node.getPath()
+	default:
+		return ""
+	}
+
+	if p == "" {
+		return "/"
+	}
+
+	return p
+}
+
+// MetaFromContext returns the metadata value stored under key on the route
+// matched for the request. It reports false if there is no matched route,
+// no such key or the value is not a T.
+//
+// Routes with metadata always record themselves, so the value is available
+// to their handlers; see RouteFromContext for the routes that do not.
+func MetaFromContext[T any](ctx context.Context, key string) (T, bool) {
+
+	var zero T
+
+	rc := requestContextFrom(ctx)
+	if rc == nil || rc.route == nil {
+		return zero, false
+	}
+
+	v, ok := rc.route.meta[key].(T)
+	if !ok {
+		return zero, false
+	}
+
+	return v, true
+}
+
+// AllowedMethods returns the methods registered for the path matched by the
+// router, which is empty for paths without routes. It returns nil if the
+// request is not being served by a router.
+//
+// The methods are available to middleware, to the handlers of unmatched
+// requests and on the routes described by RouteFromContext. In the handler
+// of a plain route without middleware, metadata or tags it returns nil
+// unless the request was prepared with WithRouteContext.
+func AllowedMethods(r *http.Request) []string {
+
+	rc := requestContextFrom(r.Context())
+	if rc == nil || rc.node == nil {
+		return nil
+	}
+
+	methods := rc.node.Methods()
+	if methods == nil {
+		return []string{}
+	}
+
+	return methods
+}
+
+// ContextWithRequestID returns a copy of ctx carrying the request ID id. It
+// is used by middleware.RequestID; error responses written by this package
+// include the ID.
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestIDFromContext returns the request ID stored with
+// ContextWithRequestID, or an empty string.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
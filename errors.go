@@ -0,0 +1,162 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/ironfang-ltd/go-router/problem"
+)
+
+// StatusCoder is implemented by errors and response values that carry
+// their own HTTP status code.
+type StatusCoder interface {
+	StatusCode() int
+}
+
+// HTTPError is an error with an HTTP status code and a message that is safe
+// to show to clients.
+type HTTPError struct {
+	Status  int
+	Message string
+	Err     error
+}
+
+// NewHTTPError returns an HTTPError with the given status and message. An
+// empty message falls back to the status text.
+func NewHTTPError(status int, message string) *HTTPError {
+	return &HTTPError{
+		Status:  status,
+		Message: message,
+	}
+}
+
+func (e *HTTPError) Error() string {
+
+	msg := e.Message
+	if msg == "" {
+		msg = http.StatusText(e.Status)
+	}
+
+	if e.Err != nil {
+		return msg + ": " + e.Err.Error()
+	}
+
+	return msg
+}
+
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
+func (e *HTTPError) StatusCode() int {
+	return e.Status
+}
+
+// StatusOf maps err to an HTTP status code. Errors implementing StatusCoder
+// use their own status, context deadlines map to 504 Gateway Timeout and
+// everything else is a 500 Internal Server Error.
+func StatusOf(err error) int {
+
+	var sc StatusCoder
+	if errors.As(err, &sc) {
+		return sc.StatusCode()
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return http.StatusServiceUnavailable
+	}
+
+	return http.StatusInternalServerError
+}
+
+// WriteError writes err as an error response. If the router serving r has an
+// ErrorHandler it is used, otherwise a plain text response is written. Only
+// the messages of HTTPError, BindError and problem.Problem are sent to the
+// client; other errors are reported with the status text so internal details
+// do not leak.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+
+	if config := configFrom(r); config != nil && config.ErrorHandler != nil {
+		config.ErrorHandler(w, r, err)
+		return
+	}
+
+	var prob *problem.Problem
+	if errors.As(err, &prob) {
+		http.Error(w, prob.Error(), StatusOf(err))
+		return
+	}
+
+	var bindErr *BindError
+	if errors.As(err, &bindErr) {
+		WriteBindError(w, r, bindErr)
+		return
+	}
+
+	status := StatusOf(err)
+	message := http.StatusText(status)
+
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) && httpErr.Message != "" {
+		message = httpErr.Message
+	}
+
+	http.Error(w, message, status)
+}
+
+// WriteProblem writes err as an RFC 9457 application/problem+json response.
+// A *problem.Problem is written as is, a *BindError lists its field errors in
+// an "errors" member and other errors are mapped with StatusOf. The instance
+// defaults to the request path, and the request ID, if any, is added as a
+// "requestId" member.
+func WriteProblem(w http.ResponseWriter, r *http.Request, err error) {
+	problem.Write(w, ProblemOf(r, err))
+}
+
+// ProblemOf converts err into the problem details written by WriteProblem.
+func ProblemOf(r *http.Request, err error) *problem.Problem {
+
+	var p *problem.Problem
+
+	var prob *problem.Problem
+	var bindErr *BindError
+	var httpErr *HTTPError
+
+	switch {
+	case errors.As(err, &prob):
+		copied := *prob
+		p = &copied
+	case errors.As(err, &bindErr):
+		p = problem.New(bindErr.StatusCode()).
+			WithDetail("The request could not be bound.").
+			With("errors", bindErr.Errors)
+	case errors.As(err, &httpErr):
+		p = problem.New(httpErr.StatusCode()).WithDetail(httpErr.Message)
+	default:
+		p = problem.New(StatusOf(err))
+	}
+
+	if p.Instance == "" {
+		p.Instance = r.URL.Path
+	}
+
+	if id := RequestIDFromContext(r.Context()); id != "" {
+		if _, ok := p.Extensions["requestId"]; !ok {
+			// The extensions of a copied problem are shared with the
+			// original, so they are copied before adding to them.
+			extensions := make(map[string]any, len(p.Extensions)+1)
+			for k, v := range p.Extensions {
+				extensions[k] = v
+			}
+			extensions["requestId"] = id
+			p.Extensions = extensions
+		}
+	}
+
+	return p
+}
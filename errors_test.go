@@ -0,0 +1,124 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ironfang-ltd/go-router/problem"
+)
+
+func TestRouter_ProblemDetails(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		status int
+	}{
+		{name: "NotFound", method: "GET", path: "/missing", status: http.StatusNotFound},
+		{name: "MethodNotAllowed", method: "DELETE", path: "/users/1", status: http.StatusMethodNotAllowed},
+		{name: "BindError", method: "GET", path: "/users/abc", status: http.StatusBadRequest},
+		{name: "HandlerError", method: "GET", path: "/users/7", status: http.StatusNotFound},
+	}
+
+	r := New(WithProblemDetails())
+
+	type input struct {
+		ID int `path:"id"`
+	}
+
+	r.Get("/users/:id", JSON(func(ctx context.Context, in input) (*userOutput, error) {
+		return nil, NewHTTPError(http.StatusNotFound, "user does not exist")
+	}))
+
+	for i := range tests {
+		tc := tests[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+
+			req, _ := http.NewRequest(tc.method, tc.path, nil)
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, req)
+
+			if w.Code != tc.status {
+				t.Errorf("response code is: %d, expected: %d", w.Code, tc.status)
+			}
+
+			if w.Header().Get("Content-Type") != problem.ContentType {
+				t.Errorf("content type is: %s, expected: %s", w.Header().Get("Content-Type"), problem.ContentType)
+			}
+
+			var p problem.Problem
+			if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+				t.Fatal(err)
+			}
+
+			if p.Status != tc.status || p.Title != http.StatusText(tc.status) || p.Instance != tc.path {
+				t.Errorf("problem is: %+v", p)
+			}
+		})
+	}
+}
+
+func TestProblemOf_BindError(t *testing.T) {
+
+	req, _ := http.NewRequest("GET", "/users?page=x", nil)
+	req.Header.Set("X-Tenant", "acme")
+
+	_, err := Bind[bindRequest](req)
+
+	p := ProblemOf(req, err)
+
+	if p.Status != http.StatusBadRequest {
+		t.Errorf("status is: %d, expected: %d", p.Status, http.StatusBadRequest)
+	}
+
+	errs, ok := p.Extensions["errors"].([]FieldError)
+	if !ok || len(errs) != 1 || errs[0].Field != "page" {
+		t.Errorf("errors extension is: %v", p.Extensions["errors"])
+	}
+}
+
+func TestWriteError_WithoutRouter(t *testing.T) {
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+
+	WriteError(w, req, NewHTTPError(http.StatusTeapot, "short and stout"))
+
+	if w.Code != http.StatusTeapot {
+		t.Errorf("response code is: %d, expected: %d", w.Code, http.StatusTeapot)
+	}
+
+	if strings.TrimSpace(w.Body.String()) != "short and stout" {
+		t.Errorf("response body is: %s, expected: %s", w.Body.String(), "short and stout")
+	}
+}
+
+func TestProblemOf_RequestID(t *testing.T) {
+
+	req, _ := http.NewRequest("GET", "/orders/1", nil)
+	req = req.WithContext(ContextWithRequestID(req.Context(), "req-42"))
+
+	original := problem.New(http.StatusConflict).With("orderId", 1)
+
+	p := ProblemOf(req, original)
+
+	if p.Extensions["requestId"] != "req-42" || p.Extensions["orderId"] != 1 {
+		t.Errorf("extensions are: %v", p.Extensions)
+	}
+
+	if _, ok := original.Extensions["requestId"]; ok {
+		t.Error("the original problem was modified")
+	}
+
+	if p := ProblemOf(req, errors.New("boom")); p.Extensions["requestId"] != "req-42" {
+		t.Errorf("extensions are: %v", p.Extensions)
+	}
+}
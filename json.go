@@ -0,0 +1,116 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+)
+
+// JSONHandlerFunc is the signature of the functions adapted by JSON.
+type JSONHandlerFunc[In, Out any] func(ctx context.Context, in In) (Out, error)
+
+// JSON adapts fn into an http.HandlerFunc.
+//
+// The request is bound into In with BindInto when In is a struct, otherwise
+// the JSON body is decoded into it. Either way a body without a
+// Content-Type is decoded as JSON. Binding failures are answered with
+// WriteBindError and fn is not called.
+//
+// Errors returned by fn are written with WriteError, which uses StatusOf to
+// pick the status code. On success Out is encoded as JSON: with its own
+// status if it implements StatusCoder, 201 Created for POST requests, 204 No
+// Content if it is nil, and 200 OK otherwise.
+func JSON[In, Out any](fn JSONHandlerFunc[In, Out]) http.HandlerFunc {
+
+	if fn == nil {
+		panic("json handler func must not be nil")
+	}
+
+	isStruct := reflect.TypeFor[In]().Kind() == reflect.Struct
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		var in In
+
+		if isStruct {
+			if err := bindInto(r, &in, "application/json"); err != nil {
+				WriteBindError(w, r, err)
+				return
+			}
+		} else if err := decodeJSON(r, &in); err != nil {
+			WriteBindError(w, r, err)
+			return
+		}
+
+		out, err := fn(r.Context(), in)
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+
+		// A nil pointer is checked first, as its StatusCode method may
+		// dereference it.
+		if isNil(out) {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		status := http.StatusOK
+		if r.Method == http.MethodPost {
+			status = http.StatusCreated
+		}
+
+		if sc, ok := any(out).(StatusCoder); ok {
+			status = sc.StatusCode()
+		}
+
+		writeJSON(w, status, out)
+	}
+}
+
+func decodeJSON(r *http.Request, dst any) error {
+
+	if r.Body == nil || r.Body == http.NoBody || r.ContentLength == 0 {
+		return nil
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(dst); err != nil && !errors.Is(err, io.EOF) {
+		bindErr := &BindError{}
+		bindErr.add(jsonErrorField(err), BindSourceBody, jsonErrorMessage(err))
+		return bindErr
+	}
+
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = w.Write(b)
+}
+
+func isNil(v any) bool {
+
+	if v == nil {
+		return true
+	}
+
+	rv := reflect.ValueOf(v)
+
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		return rv.IsNil()
+	}
+
+	return false
+}
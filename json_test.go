@@ -0,0 +1,209 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type createUserInput struct {
+	Tenant string `header:"X-Tenant"`
+	Name   string `json:"name"`
+}
+
+type userOutput struct {
+	ID     int    `json:"id"`
+	Name   string `json:"name"`
+	Tenant string `json:"tenant"`
+}
+
+func TestJSON_Post(t *testing.T) {
+
+	req, _ := http.NewRequest("POST", "/users", strings.NewReader(`{"name":"gopher"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Tenant", "acme")
+	w := httptest.NewRecorder()
+
+	r := New()
+
+	r.Post("/users", JSON(func(ctx context.Context, in createUserInput) (userOutput, error) {
+		return userOutput{ID: 1, Name: in.Name, Tenant: in.Tenant}, nil
+	}))
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Errorf("response code is: %d, expected: %d", w.Code, http.StatusCreated)
+	}
+
+	if w.Header().Get("Content-Type") != "application/json; charset=utf-8" {
+		t.Errorf("content type is: %s, expected: %s", w.Header().Get("Content-Type"), "application/json; charset=utf-8")
+	}
+
+	expected := `{"id":1,"name":"gopher","tenant":"acme"}`
+	if w.Body.String() != expected {
+		t.Errorf("response body is: %s, expected: %s", w.Body.String(), expected)
+	}
+}
+
+func TestJSON_PostWithoutContentType(t *testing.T) {
+
+	r := New()
+
+	r.Post("/users", JSON(func(ctx context.Context, in createUserInput) (userOutput, error) {
+		return userOutput{ID: 1, Name: in.Name}, nil
+	}))
+
+	tests := []struct {
+		name string
+		req  *http.Request
+	}{
+		{name: "KnownLength", req: httptest.NewRequest("POST", "/users", strings.NewReader(`{"name":"gopher"}`))},
+		{name: "UnknownLength", req: httptest.NewRequest("POST", "/users", io.NopCloser(strings.NewReader(`{"name":"gopher"}`)))},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+
+			if tc.name == "UnknownLength" {
+				tc.req.ContentLength = -1
+			}
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, tc.req)
+
+			expected := `{"id":1,"name":"gopher","tenant":""}`
+			if w.Code != http.StatusCreated || w.Body.String() != expected {
+				t.Errorf("response is: %d %s, expected: %d %s", w.Code, w.Body.String(), http.StatusCreated, expected)
+			}
+		})
+	}
+}
+
+func TestJSON_NonStructInput(t *testing.T) {
+
+	req, _ := http.NewRequest("PUT", "/tags", strings.NewReader(`["a","b"]`))
+	w := httptest.NewRecorder()
+
+	handler := JSON(func(ctx context.Context, in []string) (int, error) {
+		return len(in), nil
+	})
+
+	handler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("response code is: %d, expected: %d", w.Code, http.StatusOK)
+	}
+
+	if w.Body.String() != "2" {
+		t.Errorf("response body is: %s, expected: %s", w.Body.String(), "2")
+	}
+}
+
+func TestJSON_BindError(t *testing.T) {
+
+	req, _ := http.NewRequest("POST", "/users", strings.NewReader(`{"name":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	called := false
+	handler := JSON(func(ctx context.Context, in createUserInput) (*userOutput, error) {
+		called = true
+		return nil, nil
+	})
+
+	handler(w, req)
+
+	if called {
+		t.Error("handler func should not be called when binding fails")
+	}
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("response code is: %d, expected: %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestJSON_Errors(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		body   string
+	}{
+		{name: "HTTPError", err: NewHTTPError(http.StatusNotFound, "user not found"), status: http.StatusNotFound, body: "user not found"},
+		{name: "Wrapped", err: &HTTPError{Status: http.StatusConflict, Err: errors.New("duplicate key")}, status: http.StatusConflict, body: "Conflict"},
+		{name: "Deadline", err: context.DeadlineExceeded, status: http.StatusGatewayTimeout, body: "Gateway Timeout"},
+		{name: "Internal", err: errors.New("db password is hunter2"), status: http.StatusInternalServerError, body: "Internal Server Error"},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+
+			req, _ := http.NewRequest("GET", "/users/1", nil)
+			w := httptest.NewRecorder()
+
+			handler := JSON(func(ctx context.Context, in struct{}) (*userOutput, error) {
+				return nil, tc.err
+			})
+
+			handler(w, req)
+
+			if w.Code != tc.status {
+				t.Errorf("response code is: %d, expected: %d", w.Code, tc.status)
+			}
+
+			if strings.TrimSpace(w.Body.String()) != tc.body {
+				t.Errorf("response body is: %s, expected: %s", w.Body.String(), tc.body)
+			}
+		})
+	}
+}
+
+func TestJSON_NoContent(t *testing.T) {
+
+	req, _ := http.NewRequest("DELETE", "/users/1", nil)
+	w := httptest.NewRecorder()
+
+	handler := JSON(func(ctx context.Context, in struct{}) (*userOutput, error) {
+		return nil, nil
+	})
+
+	handler(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Errorf("response code is: %d, expected: %d", w.Code, http.StatusNoContent)
+	}
+}
+
+type acceptedOutput struct {
+	Status int `json:"status"`
+}
+
+func (o *acceptedOutput) StatusCode() int {
+	return o.Status
+}
+
+func TestJSON_NilStatusCoder(t *testing.T) {
+
+	req, _ := http.NewRequest("POST", "/jobs", nil)
+	w := httptest.NewRecorder()
+
+	handler := JSON(func(ctx context.Context, in struct{}) (*acceptedOutput, error) {
+		return nil, nil
+	})
+
+	handler(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Errorf("response code is: %d, expected: %d", w.Code, http.StatusNoContent)
+	}
+}
@@ -0,0 +1,172 @@
+package middleware
+
+import (
+	"net/http"
+	"path"
+	"strings"
+)
+
+const (
+	// CacheControlImmutable caches a file for a year without revalidation,
+	// for files whose name changes with their content.
+	CacheControlImmutable = "public, max-age=31536000, immutable"
+
+	// CacheControlNoCache lets clients store a file but revalidate it on
+	// every use.
+	CacheControlNoCache = "no-cache"
+)
+
+// CacheRule sets the Cache-Control header of the files it matches.
+type CacheRule struct {
+	match        func(name string) bool
+	cacheControl string
+}
+
+// CacheByPattern matches file names against a path.Match pattern. Patterns
+// without a slash, such as "*.woff2", match the base name; others, such as
+// "fonts/*", match the name relative to the root.
+func CacheByPattern(pattern, cacheControl string) CacheRule {
+
+	if _, err := path.Match(pattern, ""); err != nil {
+		panic("invalid cache pattern: " + pattern)
+	}
+
+	return CacheRule{
+		match: func(name string) bool {
+			if !strings.Contains(pattern, "/") {
+				name = path.Base(name)
+			}
+			ok, _ := path.Match(pattern, name)
+			return ok
+		},
+		cacheControl: cacheControl,
+	}
+}
+
+// CacheByExtension matches files with any of the extensions, such as
+// ".html".
+func CacheByExtension(cacheControl string, extensions ...string) CacheRule {
+	return CacheRule{
+		match: func(name string) bool {
+			ext := path.Ext(name)
+			for _, e := range extensions {
+				if strings.EqualFold(ext, e) {
+					return true
+				}
+			}
+			return false
+		},
+		cacheControl: cacheControl,
+	}
+}
+
+// CacheFingerprinted matches files with a content hash in their name, such
+// as "app.3f9a2c.js" or "app-B2xk9aQ1.js" (see IsFingerprinted).
+func CacheFingerprinted(cacheControl string) CacheRule {
+	return CacheRule{
+		match:        IsFingerprinted,
+		cacheControl: cacheControl,
+	}
+}
+
+// DefaultCacheRules caches fingerprinted files forever and makes clients
+// revalidate HTML documents.
+func DefaultCacheRules() []CacheRule {
+	return []CacheRule{
+		CacheFingerprinted(CacheControlImmutable),
+		CacheByExtension(CacheControlNoCache, ".html", ".htm"),
+	}
+}
+
+func (fsrv *fileServer) setCacheControl(w http.ResponseWriter, name string) {
+
+	if w.Header().Get("Cache-Control") != "" {
+		return
+	}
+
+	for _, rule := range fsrv.opts.CacheRules {
+		if rule.match(name) {
+			w.Header().Set("Cache-Control", rule.cacheControl)
+			return
+		}
+	}
+}
+
+// IsFingerprinted reports whether the base of name contains a content hash
+// before its extension: after a dot, at least 6 hexadecimal digits, or
+// after a dot or dash, at least 8 letters, digits or underscores mixing
+// letters and digits. Hex hashes made of letters only, such as "deadbeef",
+// need 8 digits too, to tell them from words such as "facade"; numbers
+// after a dash, such as the date in "backup-20240101.zip", are not hashes.
+// Use a Manifest to trust only the files a build tool listed.
+func IsFingerprinted(name string) bool {
+	_, hash := splitFingerprint(path.Base(name))
+	return hash != ""
+}
+
+// splitFingerprint splits the content hash out of a file name, returning
+// the name without it and the hash, or the name and an empty hash.
+func splitFingerprint(base string) (string, string) {
+
+	ext := path.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+
+	if ext == "" || stem == "" {
+		return base, ""
+	}
+
+	i := strings.LastIndexAny(stem, ".-")
+	if i <= 0 {
+		return base, ""
+	}
+
+	hash := stem[i+1:]
+	if !(stem[i] == '.' && isHexHash(hash)) && !isBase64Hash(hash) {
+		return base, ""
+	}
+
+	return stem[:i] + ext, hash
+}
+
+func isHexHash(s string) bool {
+
+	if len(s) < 6 {
+		return false
+	}
+
+	digit := false
+
+	for _, c := range s {
+		switch {
+		case '0' <= c && c <= '9':
+			digit = true
+		case 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F':
+		default:
+			return false
+		}
+	}
+
+	return digit || len(s) >= 8
+}
+
+func isBase64Hash(s string) bool {
+
+	if len(s) < 8 {
+		return false
+	}
+
+	letter, digit := false, false
+
+	for _, c := range s {
+		switch {
+		case '0' <= c && c <= '9':
+			digit = true
+		case 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z':
+			letter = true
+		case c != '_':
+			return false
+		}
+	}
+
+	return letter && digit
+}
@@ -3,47 +3,149 @@ package middleware
 import (
 	"log/slog"
 	"net/http"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 
 	"github.com/ironfang-ltd/go-router"
+	"github.com/ironfang-ltd/go-router/problem"
 )
 
 type CorsOption func(*CorsOptions)
 
+// CorsRejectMode controls what happens to an actual request whose origin is
+// not allowed.
+type CorsRejectMode int
+
+const (
+	// CorsRejectPassThrough runs the handler without CORS headers, leaving
+	// the browser to block the response.
+	CorsRejectPassThrough CorsRejectMode = iota
+	// CorsRejectForbidden answers 403 Forbidden without running the
+	// handler, with the ErrorHandler of the router if it has one and a
+	// problem details body otherwise.
+	CorsRejectForbidden
+	// CorsRejectAbort answers a bare 403 Forbidden without running the
+	// handler.
+	CorsRejectAbort
+)
+
 type CorsOptions struct {
-	AllowedOrigins   []string
-	AllowedMethods   []string
-	AllowedHeaders   []string
-	AllowCredentials bool
-	ExposedHeaders   []string
-	MaxAge           int
+	AllowedOrigins        []string
+	AllowedOriginPatterns []*regexp.Regexp
+	AllowOriginFunc       func(r *http.Request, origin string) bool
+	AllowedMethods        []string
+	AllowedHeaders        []string
+	AllowCredentials      bool
+	ExposedHeaders        []string
+	MaxAge                int
+	AllowPrivateNetwork   bool
+	RejectMode            CorsRejectMode
 }
 
+// WithAllowedOrigins sets the allowed origins. An origin is compared by
+// scheme, host and port; "https://*.example.com" allows every subdomain of
+// example.com and "*" allows any origin. Wildcards on a public suffix, such
+// as "https://*.github.io", panic, as they would match other people's sites.
 func WithAllowedOrigins(origins ...string) func(*CorsOptions) {
 	return func(opts *CorsOptions) {
 		opts.AllowedOrigins = origins
 	}
 }
 
+// WithAllowedOriginPatterns allows origins matching any of the regular
+// expressions. Patterns are anchored, so they must match the whole origin.
+// The opaque origin "null" is only allowed when listed with
+// WithAllowedOrigins, whatever the patterns or WithAllowOriginFunc say.
+func WithAllowedOriginPatterns(patterns ...string) func(*CorsOptions) {
+	return func(opts *CorsOptions) {
+		for _, pattern := range patterns {
+			opts.AllowedOriginPatterns = append(opts.AllowedOriginPatterns, regexp.MustCompile("^(?:"+pattern+")$"))
+		}
+	}
+}
+
+// WithAllowOriginFunc allows origins for which fn returns true, for example
+// after looking up the tenant the origin belongs to.
+func WithAllowOriginFunc(fn func(r *http.Request, origin string) bool) func(*CorsOptions) {
+	return func(opts *CorsOptions) {
+		opts.AllowOriginFunc = fn
+	}
+}
+
+// WithAllowedMethods sets the methods allowed in preflight requests. "*"
+// allows any method. Methods are case-sensitive, as in the Fetch standard.
 func WithAllowedMethods(methods ...string) func(*CorsOptions) {
 	return func(opts *CorsOptions) {
 		opts.AllowedMethods = methods
 	}
 }
 
+// WithAllowedHeaders sets the request headers allowed in preflight requests,
+// compared case-insensitively. "*" allows any header except Authorization,
+// which must always be listed explicitly.
 func WithAllowedHeaders(headers ...string) func(*CorsOptions) {
 	return func(opts *CorsOptions) {
 		opts.AllowedHeaders = headers
 	}
 }
 
+// WithAllowCredentials allows cookies and HTTP authentication. Wildcards in
+// the response are then replaced by the requested values, as browsers
+// ignore "*" for credentialed requests. Cors panics if credentials are
+// allowed for any origin, as any site could then act for the user; list
+// the allowed origins instead.
 func WithAllowCredentials(allow bool) func(*CorsOptions) {
 	return func(opts *CorsOptions) {
 		opts.AllowCredentials = allow
 	}
 }
 
+// WithExposedHeaders sets the response headers scripts may read in addition
+// to the CORS-safelisted ones.
+func WithExposedHeaders(headers ...string) func(*CorsOptions) {
+	return func(opts *CorsOptions) {
+		opts.ExposedHeaders = headers
+	}
+}
+
+// WithMaxAge sets how many seconds a preflight result may be cached. Zero
+// omits the header, leaving the browser default; a negative value disables
+// caching.
+func WithMaxAge(seconds int) func(*CorsOptions) {
+	return func(opts *CorsOptions) {
+		opts.MaxAge = seconds
+	}
+}
+
+// WithAllowPrivateNetwork answers Private Network Access preflights, sent by
+// browsers before a public site may reach a server on a private network.
+func WithAllowPrivateNetwork(allow bool) func(*CorsOptions) {
+	return func(opts *CorsOptions) {
+		opts.AllowPrivateNetwork = allow
+	}
+}
+
+// WithRejectMode sets how actual requests from disallowed origins are
+// handled. The default, CorsRejectPassThrough, still runs the handler.
+func WithRejectMode(mode CorsRejectMode) func(*CorsOptions) {
+	return func(opts *CorsOptions) {
+		opts.RejectMode = mode
+	}
+}
+
+type cors struct {
+	opts           *CorsOptions
+	origins        *originMatcher
+	allowedMethods []string
+	anyMethod      bool
+	allowedHeaders map[string]bool
+	anyHeader      bool
+	exposedHeaders string
+	maxAge         string
+}
+
 func Cors(options ...CorsOption) router.Middleware {
 
 	opts := &CorsOptions{
@@ -59,125 +161,227 @@ func Cors(options ...CorsOption) router.Middleware {
 		option(opts)
 	}
 
-	allowedHeaders := strings.Join(opts.AllowedHeaders, ", ")
-	exposedHeaders := strings.Join(opts.ExposedHeaders, ", ")
+	c := newCors(opts)
 
-	isPreflightRequest := func(r *http.Request) bool {
-		return r.Header.Get("Origin") != "" && r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
-	}
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
 
-	handlePreflightRequest := func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Add("Vary", "Access-Control-Request-Method")
-		w.Header().Add("Vary", "Access-Control-Request-Headers")
+			if isPreflightRequest(r) {
+				if !c.handlePreflightRequest(w, r) {
+					writeCorsRejection(w, r, problem.New(http.StatusForbidden).WithDetail("CORS preflight request rejected."))
+					return
+				}
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
 
-		origin := r.Header.Get("Origin")
+			// Browsers send Origin with same-origin POSTs too; those are not
+			// CORS requests and are never rejected.
+			if !c.handleRequest(w, r) && !isSameOrigin(r) {
+				switch opts.RejectMode {
+				case CorsRejectForbidden:
+					writeCorsRejection(w, r, problem.New(http.StatusForbidden).WithDetail("Origin not allowed."))
+					return
+				case CorsRejectAbort:
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+			}
 
-		// Check if the origin is allowed
-		if !isOriginAllowed(opts.AllowedOrigins, origin) {
-			slog.Info("CORS origin not allowed", "origin", origin)
-			return
+			next(w, r)
 		}
+	}
+}
 
-		// Check if the method is allowed
-		if !isMethodAllowed(opts.AllowedMethods, r.Header.Get("Access-Control-Request-Method")) {
-			slog.Info("CORS method not allowed", "method", r.Header.Get("Access-Control-Request-Method"))
-			return
-		}
+// writeCorsRejection writes err with the ErrorHandler of the router, or as
+// problem details if there is none.
+func writeCorsRejection(w http.ResponseWriter, r *http.Request, err error) {
 
-		// Check if the headers are allowed
-		if !isHeadersAllowed(opts.AllowedHeaders, r.Header.Get("Access-Control-Request-Headers")) {
-			slog.Info("CORS headers not allowed", "headers", r.Header.Get("Access-Control-Request-Headers"))
-			return
-		}
+	if router.HasErrorHandler(r) {
+		router.WriteError(w, r, err)
+		return
+	}
 
-		// Set the allowed origin
-		if len(opts.AllowedOrigins) > 0 {
-			w.Header().Set("Access-Control-Allow-Origin", origin)
-		} else {
-			w.Header().Set("Access-Control-Allow-Origin", "*")
-		}
+	router.WriteProblem(w, r, err)
+}
 
-		// Set the allowed method
-		w.Header().Set("Access-Control-Allow-Methods", strings.ToUpper(r.Header.Get("Access-Control-Request-Method")))
+func newCors(opts *CorsOptions) *cors {
 
-		// Set the allowed headers if set
-		if len(opts.AllowedHeaders) > 0 {
-			w.Header().Set("Access-Control-Allow-Headers", allowedHeaders)
-		}
+	c := &cors{
+		opts:           opts,
+		origins:        newOriginMatcher(opts),
+		allowedHeaders: make(map[string]bool),
+		exposedHeaders: strings.Join(opts.ExposedHeaders, ", "),
+	}
 
-		// Check if allow credentials is set
-		if opts.AllowCredentials {
-			w.Header().Set("Access-Control-Allow-Credentials", "true")
+	if opts.AllowCredentials && c.origins.allowsAny() {
+		panic("CORS credentials must not be allowed for any origin")
+	}
+
+	for _, method := range opts.AllowedMethods {
+		if method == "*" {
+			c.anyMethod = true
+			continue
 		}
+		c.allowedMethods = append(c.allowedMethods, normalizeMethod(method))
+	}
 
-		// Set the max age header if set
-		if opts.MaxAge > 0 {
-			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(opts.MaxAge))
+	for _, header := range opts.AllowedHeaders {
+		if header == "*" {
+			c.anyHeader = true
+			continue
 		}
+		c.allowedHeaders[strings.ToLower(strings.TrimSpace(header))] = true
 	}
 
-	handleRequest := func(w http.ResponseWriter, r *http.Request) {
+	if opts.MaxAge > 0 {
+		c.maxAge = strconv.Itoa(opts.MaxAge)
+	} else if opts.MaxAge < 0 {
+		c.maxAge = "0"
+	}
 
-		origin := r.Header.Get("Origin")
+	return c
+}
 
-		// Check if the origin is allowed
-		if !isOriginAllowed(opts.AllowedOrigins, origin) {
-			slog.Info("CORS origin not allowed", "origin", origin)
-			return
-		}
+// isPreflightRequest reports whether r is a CORS-preflight request: an
+// OPTIONS request with an Origin and an Access-Control-Request-Method.
+func isPreflightRequest(r *http.Request) bool {
+	return r.Method == http.MethodOptions &&
+		r.Header.Get("Origin") != "" &&
+		r.Header.Get("Access-Control-Request-Method") != ""
+}
 
-		// Check if the method is allowed
-		if !isMethodAllowed(opts.AllowedMethods, r.Method) {
-			slog.Info("CORS method not allowed", "method", r.Method)
-			return
-		}
+// handlePreflightRequest writes the headers of a successful preflight
+// response and reports whether the preflight is allowed.
+func (c *cors) handlePreflightRequest(w http.ResponseWriter, r *http.Request) bool {
 
-		// Set the allowed origin
-		if len(opts.AllowedOrigins) > 0 {
-			w.Header().Set("Access-Control-Allow-Origin", origin)
-		} else {
-			w.Header().Set("Access-Control-Allow-Origin", "*")
-		}
+	h := w.Header()
+	h.Add("Vary", "Origin")
+	h.Add("Vary", "Access-Control-Request-Method")
+	h.Add("Vary", "Access-Control-Request-Headers")
 
-		// Set the exposed headers
-		if len(opts.ExposedHeaders) > 0 {
-			w.Header().Add("Access-Control-Expose-Headers", exposedHeaders)
-		}
+	if r.Header.Get("Access-Control-Request-Private-Network") != "" {
+		h.Add("Vary", "Access-Control-Request-Private-Network")
+	}
 
-		// Check if allow credentials is set and set it
-		if opts.AllowCredentials {
-			w.Header().Set("Access-Control-Allow-Credentials", "true")
+	origin := r.Header.Get("Origin")
+	method := normalizeMethod(r.Header.Get("Access-Control-Request-Method"))
+	headers := parseHeaderList(r.Header.Values("Access-Control-Request-Headers"))
+
+	// Check if the origin is allowed
+	if !c.origins.allowed(r, origin) {
+		slog.Info("CORS origin not allowed", "origin", origin)
+		return false
+	}
+
+	// Check if the method is allowed, and registered when served by a router
+	routeMethods := router.AllowedMethods(r)
+
+	if !c.isMethodAllowed(method) || (routeMethods != nil && !slices.Contains(routeMethods, method)) {
+		slog.Info("CORS method not allowed", "method", method)
+		return false
+	}
+
+	// Check if every requested header is allowed
+	for _, header := range headers {
+		if !c.isHeaderAllowed(header) {
+			slog.Info("CORS header not allowed", "header", header)
+			return false
 		}
 	}
 
-	return func(next http.HandlerFunc) http.HandlerFunc {
-		return func(w http.ResponseWriter, r *http.Request) {
+	// Check if private network access is allowed
+	privateNetwork := strings.EqualFold(r.Header.Get("Access-Control-Request-Private-Network"), "true")
+
+	if privateNetwork && !c.opts.AllowPrivateNetwork {
+		slog.Info("CORS private network access not allowed", "origin", origin)
+		return false
+	}
 
-			w.Header().Add("Vary", "Origin")
+	c.setAllowOrigin(h, origin)
 
-			if isPreflightRequest(r) {
-				handlePreflightRequest(w, r)
-				w.WriteHeader(http.StatusOK)
-				return
-			}
+	if privateNetwork {
+		h.Set("Access-Control-Allow-Private-Network", "true")
+	}
 
-			handleRequest(w, r)
-			next(w, r)
+	// Behind a router, list the methods registered for the path. Otherwise
+	// echo the requested method, as wildcards are taken literally for
+	// credentialed requests.
+	if routeMethods != nil {
+		h.Set("Access-Control-Allow-Methods", strings.Join(c.filterMethods(routeMethods), ", "))
+	} else if c.anyMethod && !c.opts.AllowCredentials {
+		h.Set("Access-Control-Allow-Methods", "*")
+	} else {
+		h.Set("Access-Control-Allow-Methods", method)
+	}
+
+	if len(headers) > 0 {
+		if c.anyHeader && !c.opts.AllowCredentials && !containsFold(headers, "authorization") {
+			h.Set("Access-Control-Allow-Headers", "*")
+		} else {
+			h.Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
 		}
 	}
+
+	if c.maxAge != "" {
+		h.Set("Access-Control-Max-Age", c.maxAge)
+	}
+
+	return true
 }
 
-func isOriginAllowed(origins []string, requestedOrigin string) bool {
-	if len(origins) == 0 {
+// handleRequest adds the CORS headers to an actual request and reports
+// whether its origin is allowed. Requests without an Origin header are not
+// CORS requests and are left alone.
+func (c *cors) handleRequest(w http.ResponseWriter, r *http.Request) bool {
+
+	h := w.Header()
+	h.Add("Vary", "Origin")
+
+	origin := r.Header.Get("Origin")
+	if origin == "" {
 		return true
 	}
 
-	if requestedOrigin == "" {
+	// Check if the origin is allowed
+	if !c.origins.allowed(r, origin) {
+		slog.Info("CORS origin not allowed", "origin", origin)
 		return false
 	}
 
-	for _, origin := range origins {
-		if strings.EqualFold(requestedOrigin, origin) {
+	c.setAllowOrigin(h, origin)
+
+	// Set the exposed headers
+	if c.exposedHeaders != "" {
+		h.Set("Access-Control-Expose-Headers", c.exposedHeaders)
+	}
+
+	return true
+}
+
+// setAllowOrigin sets Access-Control-Allow-Origin, reflecting the origin
+// unless any origin is allowed without credentials.
+func (c *cors) setAllowOrigin(h http.Header, origin string) {
+
+	if c.origins.allowsAny() && !c.opts.AllowCredentials {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+
+	if c.opts.AllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func (c *cors) isMethodAllowed(method string) bool {
+
+	if c.anyMethod {
+		return true
+	}
+
+	for _, allowed := range c.allowedMethods {
+		if allowed == method {
 			return true
 		}
 	}
@@ -185,34 +389,65 @@ func isOriginAllowed(origins []string, requestedOrigin string) bool {
 	return false
 }
 
-func isHeadersAllowed(allowedHeaders []string, requestedHeaders string) bool {
-	if len(allowedHeaders) == 0 {
-		return true
-	}
+// filterMethods returns the methods that are also allowed by the policy.
+func (c *cors) filterMethods(methods []string) []string {
 
-	requested := strings.Split(requestedHeaders, ", ")
+	allowed := make([]string, 0, len(methods))
 
-	for _, requestedHeader := range requested {
-		for _, allowedHeader := range allowedHeaders {
-			if strings.EqualFold(requestedHeader, allowedHeader) {
-				return true
-			}
+	for _, method := range methods {
+		if c.isMethodAllowed(method) {
+			allowed = append(allowed, method)
 		}
 	}
 
-	return false
+	return allowed
 }
 
-func isMethodAllowed(methods []string, requestedMethod string) bool {
-	if len(methods) == 0 {
+func (c *cors) isHeaderAllowed(header string) bool {
+
+	if c.allowedHeaders[header] {
 		return true
 	}
 
-	for _, method := range methods {
-		if strings.EqualFold(requestedMethod, method) {
-			return true
+	// Authorization is never covered by the wildcard.
+	return c.anyHeader && header != "authorization"
+}
+
+// normalizeMethod upper-cases the methods the Fetch standard normalizes and
+// leaves every other method as is.
+func normalizeMethod(method string) string {
+
+	switch upper := strings.ToUpper(method); upper {
+	case http.MethodDelete, http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPost, http.MethodPut:
+		return upper
+	}
+
+	return method
+}
+
+// parseHeaderList splits comma separated header names, trimming optional
+// whitespace and lower-casing them. Empty elements are dropped.
+func parseHeaderList(values []string) []string {
+
+	var headers []string
+
+	for _, value := range values {
+		for _, header := range strings.Split(value, ",") {
+			header = strings.ToLower(strings.TrimSpace(header))
+			if header != "" {
+				headers = append(headers, header)
+			}
 		}
 	}
 
+	return headers
+}
+
+func containsFold(values []string, s string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
 	return false
 }
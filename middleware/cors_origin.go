@@ -0,0 +1,255 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// origin is a parsed serialized origin: scheme, host and port.
+type origin struct {
+	scheme string
+	host   string
+	port   string
+}
+
+// parseOrigin parses a serialized origin such as https://example.com:8443.
+// The port is normalized to the scheme default when omitted.
+func parseOrigin(s string) (origin, bool) {
+
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme == "" || u.Host == "" || u.User != nil {
+		return origin{}, false
+	}
+
+	if (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" {
+		return origin{}, false
+	}
+
+	o := origin{
+		scheme: strings.ToLower(u.Scheme),
+		host:   strings.ToLower(u.Hostname()),
+		port:   u.Port(),
+	}
+
+	if o.port == "" {
+		o.port = defaultPort(o.scheme)
+	}
+
+	return o, true
+}
+
+func defaultPort(scheme string) string {
+	switch scheme {
+	case "http", "ws":
+		return "80"
+	case "https", "wss":
+		return "443"
+	}
+	return ""
+}
+
+// isSameOrigin reports whether the Origin of r names the host r was sent
+// to, as it does for same-origin requests that are not GET or HEAD.
+func isSameOrigin(r *http.Request) bool {
+
+	u, err := url.Parse(r.Header.Get("Origin"))
+	if err != nil || u.Host == "" {
+		return false
+	}
+
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+// wildcardOrigin matches origins such as https://*.example.com, where the
+// wildcard stands for one or more labels in front of the suffix.
+type wildcardOrigin struct {
+	scheme string
+	suffix string
+	port   string
+}
+
+func (wo wildcardOrigin) match(o origin) bool {
+	return o.scheme == wo.scheme &&
+		o.port == wo.port &&
+		len(o.host) > len(wo.suffix) &&
+		strings.HasSuffix(o.host, wo.suffix)
+}
+
+// originMatcher decides whether an origin is allowed. Exact origins, wildcard
+// origins, regular expressions and a callback are checked in that order.
+type originMatcher struct {
+	any       bool
+	null      bool
+	exact     map[origin]bool
+	wildcards []wildcardOrigin
+	patterns  []*regexp.Regexp
+	fn        func(r *http.Request, origin string) bool
+}
+
+func newOriginMatcher(opts *CorsOptions) *originMatcher {
+
+	m := &originMatcher{
+		exact:    make(map[origin]bool),
+		patterns: opts.AllowedOriginPatterns,
+		fn:       opts.AllowOriginFunc,
+	}
+
+	if len(opts.AllowedOrigins) == 0 && len(opts.AllowedOriginPatterns) == 0 && opts.AllowOriginFunc == nil {
+		m.any = true
+	}
+
+	for _, allowed := range opts.AllowedOrigins {
+
+		if allowed == "*" {
+			m.any = true
+			continue
+		}
+
+		// Opaque origins, e.g. sandboxed iframes, serialize as "null" and
+		// are only allowed when listed explicitly.
+		if allowed == "null" {
+			m.null = true
+			continue
+		}
+
+		if scheme, rest, ok := strings.Cut(allowed, "://*."); ok {
+			m.wildcards = append(m.wildcards, parseWildcardOrigin(scheme, rest))
+			continue
+		}
+
+		o, ok := parseOrigin(allowed)
+		if !ok {
+			panic("invalid CORS origin: " + allowed)
+		}
+
+		m.exact[o] = true
+	}
+
+	return m
+}
+
+func parseWildcardOrigin(scheme, rest string) wildcardOrigin {
+
+	o, ok := parseOrigin(scheme + "://" + rest)
+	if !ok || strings.Contains(o.host, "*") || net.ParseIP(o.host) != nil {
+		panic("invalid CORS wildcard origin: " + scheme + "://*." + rest)
+	}
+
+	// The suffix must be a registrable domain, so a pattern such as
+	// https://*.co.uk or https://*.github.io cannot match other sites.
+	if isPublicSuffix(o.host) {
+		panic("CORS wildcard origin must name a registrable domain: " + scheme + "://*." + rest)
+	}
+
+	return wildcardOrigin{
+		scheme: o.scheme,
+		suffix: "." + o.host,
+		port:   o.port,
+	}
+}
+
+// allowsAny reports whether every origin is allowed.
+func (m *originMatcher) allowsAny() bool {
+	return m.any
+}
+
+func (m *originMatcher) allowed(r *http.Request, requestedOrigin string) bool {
+
+	if m.any {
+		return true
+	}
+
+	if requestedOrigin == "" {
+		return false
+	}
+
+	if requestedOrigin == "null" {
+		return m.null
+	}
+
+	if o, ok := parseOrigin(requestedOrigin); ok {
+
+		if m.exact[o] {
+			return true
+		}
+
+		for _, wo := range m.wildcards {
+			if wo.match(o) {
+				return true
+			}
+		}
+	}
+
+	for _, pattern := range m.patterns {
+		if pattern.MatchString(requestedOrigin) {
+			return true
+		}
+	}
+
+	if m.fn != nil && m.fn(r, requestedOrigin) {
+		return true
+	}
+
+	return false
+}
+
+// secondLevelSuffixes are common second-level labels under country code TLDs
+// that act as public suffixes, such as co.uk or com.au.
+var secondLevelSuffixes = map[string]bool{
+	"ac": true, "co": true, "com": true, "edu": true, "gov": true,
+	"ltd": true, "net": true, "org": true, "plc": true, "ne": true,
+	"or": true, "go": true,
+}
+
+// sharedHostSuffixes are domains of hosting services whose subdomains are
+// the sites of different customers.
+var sharedHostSuffixes = map[string]bool{
+	"appspot.com":       true,
+	"azurewebsites.net": true,
+	"blogspot.com":      true,
+	"cloudfront.net":    true,
+	"firebaseapp.com":   true,
+	"fly.dev":           true,
+	"github.io":         true,
+	"gitlab.io":         true,
+	"herokuapp.com":     true,
+	"netlify.app":       true,
+	"onrender.com":      true,
+	"pages.dev":         true,
+	"vercel.app":        true,
+	"web.app":           true,
+	"workers.dev":       true,
+}
+
+// specialUseNames are single-label names that are not top-level domains of
+// the DNS, such as localhost, so wildcards on them stay on one machine or
+// network.
+var specialUseNames = map[string]bool{
+	"example": true, "home": true, "internal": true, "invalid": true,
+	"lan": true, "local": true, "localhost": true, "test": true,
+}
+
+// isPublicSuffix reports whether host is a top-level domain, a common
+// second-level public suffix or the domain of a shared hosting service. It
+// is a conservative approximation of the Public Suffix List, good enough to
+// reject overly broad wildcards without depending on the list.
+func isPublicSuffix(host string) bool {
+
+	if sharedHostSuffixes[host] {
+		return true
+	}
+
+	labels := strings.Split(host, ".")
+
+	switch len(labels) {
+	case 1:
+		return !specialUseNames[host]
+	case 2:
+		return len(labels[1]) == 2 && secondLevelSuffixes[labels[0]]
+	}
+
+	return false
+}
@@ -1,9 +1,13 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+
+	"github.com/ironfang-ltd/go-router"
+	"github.com/ironfang-ltd/go-router/problem"
 )
 
 func TestCors(t *testing.T) {
@@ -64,6 +68,64 @@ func TestCors(t *testing.T) {
 				"Access-Control-Allow-Origin": "http://example.org",
 			},
 		},
+		{
+			name: "WildcardOrigin",
+			options: []CorsOption{
+				WithAllowedOrigins("https://*.example.com"),
+			},
+			method: "GET",
+			requestHeaders: map[string]string{
+				"Origin": "https://pr-123.preview.example.com",
+			},
+			responseHeaders: map[string]string{
+				"Vary":                        "Origin",
+				"Access-Control-Allow-Origin": "https://pr-123.preview.example.com",
+			},
+		},
+		{
+			name: "WildcardOriginOtherDomain",
+			options: []CorsOption{
+				WithAllowedOrigins("https://*.example.com"),
+			},
+			method: "GET",
+			requestHeaders: map[string]string{
+				"Origin": "https://evilexample.com",
+			},
+			responseHeaders: map[string]string{
+				"Vary":                        "Origin",
+				"Access-Control-Allow-Origin": "",
+			},
+		},
+		{
+			name: "PatternOrigin",
+			options: []CorsOption{
+				WithAllowedOriginPatterns(`https://tenant-[0-9]+\.example\.org`),
+			},
+			method: "GET",
+			requestHeaders: map[string]string{
+				"Origin": "https://tenant-42.example.org",
+			},
+			responseHeaders: map[string]string{
+				"Vary":                        "Origin",
+				"Access-Control-Allow-Origin": "https://tenant-42.example.org",
+			},
+		},
+		{
+			name: "OriginFunc",
+			options: []CorsOption{
+				WithAllowOriginFunc(func(r *http.Request, origin string) bool {
+					return origin == "https://customer.example.net"
+				}),
+			},
+			method: "GET",
+			requestHeaders: map[string]string{
+				"Origin": "https://customer.example.net",
+			},
+			responseHeaders: map[string]string{
+				"Vary":                        "Origin",
+				"Access-Control-Allow-Origin": "https://customer.example.net",
+			},
+		},
 	}
 
 	final := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -101,3 +163,778 @@ func assertResponseHeaders(t *testing.T, resHeader http.Header, expected map[str
 		}
 	}
 }
+
+func TestCors_OriginMatcher(t *testing.T) {
+
+	m := newOriginMatcher(&CorsOptions{
+		AllowedOrigins: []string{
+			"https://example.com",
+			"http://localhost:3000",
+			"https://*.preview.example.com",
+			"https://*.example.org:8443",
+		},
+	})
+
+	tests := map[string]bool{
+		"https://example.com":                      true,
+		"https://EXAMPLE.com":                      true,
+		"https://example.com:443":                  true,
+		"http://example.com":                       false,
+		"https://example.com:8443":                 false,
+		"http://localhost:3000":                    true,
+		"http://localhost:3001":                    false,
+		"https://pr-1.preview.example.com":         true,
+		"https://a.b.preview.example.com":          true,
+		"https://preview.example.com":              false,
+		"https://pr-1.preview.example.com.evil.io": false,
+		"https://evilpreview.example.com":          false,
+		"http://pr-1.preview.example.com":          false,
+		"https://app.example.org:8443":             true,
+		"https://app.example.org":                  false,
+		"null":                                     false,
+		"":                                         false,
+	}
+
+	req, _ := http.NewRequest("GET", "/", nil)
+
+	for requested, expected := range tests {
+		if got := m.allowed(req, requested); got != expected {
+			t.Errorf("origin '%s' allowed: %t, expected: %t", requested, got, expected)
+		}
+	}
+}
+
+func TestCors_CredentialsWithAnyOriginPanics(t *testing.T) {
+
+	tests := map[string][]CorsOption{
+		"NoOrigins": {WithAllowCredentials(true)},
+		"Wildcard":  {WithAllowedOrigins("*"), WithAllowCredentials(true)},
+	}
+
+	for name, options := range tests {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("expected credentials for any origin to panic")
+				}
+			}()
+
+			Cors(options...)
+		})
+	}
+}
+
+func TestCors_WildcardOnPublicSuffixPanics(t *testing.T) {
+
+	for _, allowed := range []string{
+		"https://*.com",
+		"https://*.co.uk",
+		"https://*.github.io",
+		"https://*.vercel.app",
+		"https://*.netlify.app",
+		"https://*.pages.dev",
+		"https://*.herokuapp.com",
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected wildcard origin '%s' to panic", allowed)
+				}
+			}()
+
+			Cors(WithAllowedOrigins(allowed))
+		}()
+	}
+
+	// Wildcards below a registrable domain, including the site of a single
+	// tenant of a shared host, and on special-use names used in development
+	// are accepted.
+	for _, allowed := range []string{
+		"https://*.example.com",
+		"https://*.example.co.uk",
+		"https://*.acme.github.io",
+		"http://*.localhost",
+		"http://*.localhost:3000",
+		"https://*.test",
+	} {
+		Cors(WithAllowedOrigins(allowed))
+	}
+}
+
+func TestCors_Preflight(t *testing.T) {
+
+	tests := []struct {
+		name            string
+		options         []CorsOption
+		requestHeaders  map[string]string
+		status          int
+		responseHeaders map[string]string
+	}{
+		{
+			name:    "AnyOrigin",
+			options: []CorsOption{},
+			requestHeaders: map[string]string{
+				"Origin":                        "https://app.example.com",
+				"Access-Control-Request-Method": "PUT",
+			},
+			status: http.StatusNoContent,
+			responseHeaders: map[string]string{
+				"Access-Control-Allow-Origin":      "*",
+				"Access-Control-Allow-Methods":     "PUT",
+				"Access-Control-Allow-Headers":     "",
+				"Access-Control-Allow-Credentials": "",
+				"Access-Control-Max-Age":           "600",
+			},
+		},
+		{
+			name:    "OriginNotAllowed",
+			options: []CorsOption{WithAllowedOrigins("https://app.example.com")},
+			requestHeaders: map[string]string{
+				"Origin":                        "https://evil.example.net",
+				"Access-Control-Request-Method": "GET",
+			},
+			status: http.StatusForbidden,
+			responseHeaders: map[string]string{
+				"Access-Control-Allow-Origin": "",
+			},
+		},
+		{
+			name:    "MethodNotAllowed",
+			options: []CorsOption{WithAllowedMethods("GET", "POST")},
+			requestHeaders: map[string]string{
+				"Origin":                        "https://app.example.com",
+				"Access-Control-Request-Method": "DELETE",
+			},
+			status: http.StatusForbidden,
+			responseHeaders: map[string]string{
+				"Access-Control-Allow-Origin":  "",
+				"Access-Control-Allow-Methods": "",
+			},
+		},
+		{
+			name:    "MethodIsCaseSensitive",
+			options: []CorsOption{WithAllowedMethods("PATCH")},
+			requestHeaders: map[string]string{
+				"Origin":                        "https://app.example.com",
+				"Access-Control-Request-Method": "patch",
+			},
+			status: http.StatusForbidden,
+		},
+		{
+			name:    "NormalizedMethod",
+			options: []CorsOption{WithAllowedMethods("put")},
+			requestHeaders: map[string]string{
+				"Origin":                        "https://app.example.com",
+				"Access-Control-Request-Method": "PUT",
+			},
+			status: http.StatusNoContent,
+			responseHeaders: map[string]string{
+				"Access-Control-Allow-Methods": "PUT",
+			},
+		},
+		{
+			name:    "AnyMethod",
+			options: []CorsOption{WithAllowedMethods("*")},
+			requestHeaders: map[string]string{
+				"Origin":                        "https://app.example.com",
+				"Access-Control-Request-Method": "PURGE",
+			},
+			status: http.StatusNoContent,
+			responseHeaders: map[string]string{
+				"Access-Control-Allow-Methods": "*",
+			},
+		},
+		{
+			name:    "AllHeadersAllowed",
+			options: []CorsOption{WithAllowedHeaders("Content-Type", "X-Requested-With")},
+			requestHeaders: map[string]string{
+				"Origin":                         "https://app.example.com",
+				"Access-Control-Request-Method":  "POST",
+				"Access-Control-Request-Headers": "x-requested-with,content-type",
+			},
+			status: http.StatusNoContent,
+			responseHeaders: map[string]string{
+				"Access-Control-Allow-Headers": "x-requested-with, content-type",
+			},
+		},
+		{
+			name:    "OneHeaderNotAllowed",
+			options: []CorsOption{WithAllowedHeaders("Content-Type")},
+			requestHeaders: map[string]string{
+				"Origin":                         "https://app.example.com",
+				"Access-Control-Request-Method":  "POST",
+				"Access-Control-Request-Headers": "content-type, x-secret",
+			},
+			status: http.StatusForbidden,
+			responseHeaders: map[string]string{
+				"Access-Control-Allow-Headers": "",
+			},
+		},
+		{
+			name:    "NoHeadersAllowedByDefault",
+			options: []CorsOption{},
+			requestHeaders: map[string]string{
+				"Origin":                         "https://app.example.com",
+				"Access-Control-Request-Method":  "POST",
+				"Access-Control-Request-Headers": "x-custom",
+			},
+			status: http.StatusForbidden,
+		},
+		{
+			name:    "AnyHeader",
+			options: []CorsOption{WithAllowedHeaders("*")},
+			requestHeaders: map[string]string{
+				"Origin":                         "https://app.example.com",
+				"Access-Control-Request-Method":  "POST",
+				"Access-Control-Request-Headers": "x-custom",
+			},
+			status: http.StatusNoContent,
+			responseHeaders: map[string]string{
+				"Access-Control-Allow-Headers": "*",
+			},
+		},
+		{
+			name:    "AnyHeaderExcludesAuthorization",
+			options: []CorsOption{WithAllowedHeaders("*")},
+			requestHeaders: map[string]string{
+				"Origin":                         "https://app.example.com",
+				"Access-Control-Request-Method":  "POST",
+				"Access-Control-Request-Headers": "authorization",
+			},
+			status: http.StatusForbidden,
+		},
+		{
+			name:    "ExplicitAuthorization",
+			options: []CorsOption{WithAllowedHeaders("*", "Authorization")},
+			requestHeaders: map[string]string{
+				"Origin":                         "https://app.example.com",
+				"Access-Control-Request-Method":  "POST",
+				"Access-Control-Request-Headers": "authorization, x-custom",
+			},
+			status: http.StatusNoContent,
+			responseHeaders: map[string]string{
+				"Access-Control-Allow-Headers": "authorization, x-custom",
+			},
+		},
+		{
+			name: "CredentialsAnyMethod",
+			options: []CorsOption{
+				WithAllowedOrigins("https://app.example.com"),
+				WithAllowCredentials(true),
+				WithAllowedMethods("*"),
+			},
+			requestHeaders: map[string]string{
+				"Origin":                        "https://app.example.com",
+				"Access-Control-Request-Method": "PUT",
+			},
+			status: http.StatusNoContent,
+			responseHeaders: map[string]string{
+				"Access-Control-Allow-Origin":      "https://app.example.com",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Allow-Methods":     "PUT",
+			},
+		},
+		{
+			name: "CredentialsEchoAnyHeader",
+			options: []CorsOption{
+				WithAllowedOrigins("https://app.example.com"),
+				WithAllowCredentials(true),
+				WithAllowedHeaders("*"),
+			},
+			requestHeaders: map[string]string{
+				"Origin":                         "https://app.example.com",
+				"Access-Control-Request-Method":  "POST",
+				"Access-Control-Request-Headers": "content-type, x-foo",
+			},
+			status: http.StatusNoContent,
+			responseHeaders: map[string]string{
+				"Access-Control-Allow-Headers":     "content-type, x-foo",
+				"Access-Control-Allow-Credentials": "true",
+			},
+		},
+		{
+			name: "CredentialsAnyHeaderExcludesAuthorization",
+			options: []CorsOption{
+				WithAllowedOrigins("https://app.example.com"),
+				WithAllowCredentials(true),
+				WithAllowedHeaders("*"),
+			},
+			requestHeaders: map[string]string{
+				"Origin":                         "https://app.example.com",
+				"Access-Control-Request-Method":  "POST",
+				"Access-Control-Request-Headers": "authorization, x-foo",
+			},
+			status: http.StatusForbidden,
+		},
+		{
+			name:    "CustomMaxAge",
+			options: []CorsOption{WithMaxAge(7200)},
+			requestHeaders: map[string]string{
+				"Origin":                        "https://app.example.com",
+				"Access-Control-Request-Method": "GET",
+			},
+			status: http.StatusNoContent,
+			responseHeaders: map[string]string{
+				"Access-Control-Max-Age": "7200",
+			},
+		},
+		{
+			name:    "DisabledMaxAge",
+			options: []CorsOption{WithMaxAge(-1)},
+			requestHeaders: map[string]string{
+				"Origin":                        "https://app.example.com",
+				"Access-Control-Request-Method": "GET",
+			},
+			status: http.StatusNoContent,
+			responseHeaders: map[string]string{
+				"Access-Control-Max-Age": "0",
+			},
+		},
+		{
+			name:    "NullOriginNotAllowedByDefault",
+			options: []CorsOption{WithAllowedOrigins("https://app.example.com")},
+			requestHeaders: map[string]string{
+				"Origin":                        "null",
+				"Access-Control-Request-Method": "GET",
+			},
+			status: http.StatusForbidden,
+		},
+		{
+			name: "NullOriginNotMatchedByPattern",
+			options: []CorsOption{
+				WithAllowedOriginPatterns(".*"),
+				WithAllowOriginFunc(func(r *http.Request, origin string) bool { return true }),
+				WithAllowCredentials(true),
+			},
+			requestHeaders: map[string]string{
+				"Origin":                        "null",
+				"Access-Control-Request-Method": "GET",
+			},
+			status: http.StatusForbidden,
+		},
+		{
+			name:    "NullOriginAllowed",
+			options: []CorsOption{WithAllowedOrigins("null")},
+			requestHeaders: map[string]string{
+				"Origin":                        "null",
+				"Access-Control-Request-Method": "GET",
+			},
+			status: http.StatusNoContent,
+			responseHeaders: map[string]string{
+				"Access-Control-Allow-Origin": "null",
+			},
+		},
+	}
+
+	final := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	for i := range tests {
+		tc := tests[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			mw := Cors(tc.options...)
+
+			req, _ := http.NewRequest(http.MethodOptions, "http://api.example.com/endpoint", nil)
+			for name, value := range tc.requestHeaders {
+				req.Header.Add(name, value)
+			}
+
+			res := httptest.NewRecorder()
+
+			mw(final).ServeHTTP(res, req)
+
+			if res.Code != tc.status {
+				t.Errorf("response code is: %d, expected: %d", res.Code, tc.status)
+			}
+
+			vary := res.Header().Values("Vary")
+			if len(vary) != 3 || vary[0] != "Origin" || vary[1] != "Access-Control-Request-Method" || vary[2] != "Access-Control-Request-Headers" {
+				t.Errorf("response header Vary is: %v", vary)
+			}
+
+			assertResponseHeaders(t, res.Header(), tc.responseHeaders)
+		})
+	}
+}
+
+func TestCors_ActualRequest(t *testing.T) {
+
+	tests := []struct {
+		name            string
+		options         []CorsOption
+		method          string
+		requestHeaders  map[string]string
+		responseHeaders map[string]string
+	}{
+		{
+			name:           "NoOrigin",
+			options:        []CorsOption{},
+			method:         "GET",
+			requestHeaders: map[string]string{},
+			responseHeaders: map[string]string{
+				"Access-Control-Allow-Origin": "",
+			},
+		},
+		{
+			name:    "ExposedHeaders",
+			options: []CorsOption{WithExposedHeaders("X-Total-Count", "ETag")},
+			method:  "GET",
+			requestHeaders: map[string]string{
+				"Origin": "https://app.example.com",
+			},
+			responseHeaders: map[string]string{
+				"Access-Control-Allow-Origin":   "*",
+				"Access-Control-Expose-Headers": "X-Total-Count, ETag",
+			},
+		},
+		{
+			name:    "CredentialsReflectOrigin",
+			options: []CorsOption{WithAllowedOrigins("https://app.example.com"), WithAllowCredentials(true)},
+			method:  "GET",
+			requestHeaders: map[string]string{
+				"Origin": "https://app.example.com",
+			},
+			responseHeaders: map[string]string{
+				"Access-Control-Allow-Origin":      "https://app.example.com",
+				"Access-Control-Allow-Credentials": "true",
+			},
+		},
+		{
+			name:    "OriginNotAllowed",
+			options: []CorsOption{WithAllowedOrigins("https://app.example.com"), WithExposedHeaders("ETag")},
+			method:  "GET",
+			requestHeaders: map[string]string{
+				"Origin": "https://evil.example.net",
+			},
+			responseHeaders: map[string]string{
+				"Access-Control-Allow-Origin":   "",
+				"Access-Control-Expose-Headers": "",
+			},
+		},
+		{
+			name:    "MethodListDoesNotApply",
+			options: []CorsOption{WithAllowedMethods("PUT")},
+			method:  "POST",
+			requestHeaders: map[string]string{
+				"Origin": "https://app.example.com",
+			},
+			responseHeaders: map[string]string{
+				"Access-Control-Allow-Origin": "*",
+			},
+		},
+		{
+			name:    "OptionsWithoutRequestMethod",
+			options: []CorsOption{},
+			method:  "OPTIONS",
+			requestHeaders: map[string]string{
+				"Origin": "https://app.example.com",
+			},
+			responseHeaders: map[string]string{
+				"Access-Control-Allow-Origin":  "*",
+				"Access-Control-Allow-Methods": "",
+			},
+		},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			called := false
+
+			mw := Cors(tc.options...)
+
+			req, _ := http.NewRequest(tc.method, "http://api.example.com/endpoint", nil)
+			for name, value := range tc.requestHeaders {
+				req.Header.Add(name, value)
+			}
+
+			res := httptest.NewRecorder()
+
+			mw(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				w.WriteHeader(http.StatusOK)
+			}).ServeHTTP(res, req)
+
+			if !called {
+				t.Error("expected the handler to be called")
+			}
+
+			if res.Header().Get("Vary") != "Origin" {
+				t.Errorf("response header Vary is: %s, expected: %s", res.Header().Get("Vary"), "Origin")
+			}
+
+			assertResponseHeaders(t, res.Header(), tc.responseHeaders)
+		})
+	}
+}
+
+func TestCors_RejectErrorHandler(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		method string
+		header map[string]string
+	}{
+		{name: "Request", method: "POST"},
+		{name: "Preflight", method: "OPTIONS", header: map[string]string{"Access-Control-Request-Method": "DELETE"}},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+
+			var handled error
+
+			r := router.New(router.WithErrorHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+				handled = err
+				router.WriteProblem(w, r, err)
+			}))
+
+			r.Post("/orders", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			r.Cors(Cors(WithAllowedOrigins("https://app.example.com"), WithRejectMode(CorsRejectForbidden)))
+
+			req, _ := http.NewRequest(tc.method, "http://api.example.com/orders", nil)
+			req.Header.Set("Origin", "https://evil.example.net")
+			for k, v := range tc.header {
+				req.Header.Set(k, v)
+			}
+
+			res := httptest.NewRecorder()
+
+			r.ServeHTTP(res, req)
+
+			if res.Code != http.StatusForbidden {
+				t.Errorf("response code is: %d, expected: %d", res.Code, http.StatusForbidden)
+			}
+
+			var prob *problem.Problem
+			if !errors.As(handled, &prob) {
+				t.Errorf("error handler got: %v, expected a problem", handled)
+			}
+
+			if res.Header().Get("Content-Type") != problem.ContentType {
+				t.Errorf("content type is: %s, expected: %s", res.Header().Get("Content-Type"), problem.ContentType)
+			}
+		})
+	}
+}
+
+func TestCors_Router(t *testing.T) {
+
+	r := router.New()
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	r.Get("/users/:id", handler)
+	r.Put("/users/:id", handler)
+
+	admin := r.Group("/admin")
+	admin.Use(func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") == "" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			next(w, r)
+		}
+	})
+	admin.Delete("/sessions", handler)
+	admin.Cors(Cors(WithAllowedOrigins("https://admin.example.com"), WithAllowCredentials(true)))
+
+	// Registered after the routes on purpose.
+	r.Cors(Cors(WithAllowedOrigins("https://app.example.com"), WithAllowedMethods("GET", "PUT", "DELETE")))
+
+	tests := []struct {
+		name            string
+		path            string
+		origin          string
+		method          string
+		status          int
+		responseHeaders map[string]string
+	}{
+		{
+			name:   "RegisteredMethod",
+			path:   "/users/42",
+			origin: "https://app.example.com",
+			method: "PUT",
+			status: http.StatusNoContent,
+			responseHeaders: map[string]string{
+				"Access-Control-Allow-Origin":  "https://app.example.com",
+				"Access-Control-Allow-Methods": "GET, PUT",
+			},
+		},
+		{
+			name:   "UnregisteredMethod",
+			path:   "/users/42",
+			origin: "https://app.example.com",
+			method: "DELETE",
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "UnregisteredPath",
+			path:   "/missing",
+			origin: "https://app.example.com",
+			method: "GET",
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "GroupPolicyReplacesParent",
+			path:   "/admin/sessions",
+			origin: "https://app.example.com",
+			method: "DELETE",
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "GroupPolicyRunsBeforeGroupMiddleware",
+			path:   "/admin/sessions",
+			origin: "https://admin.example.com",
+			method: "DELETE",
+			status: http.StatusNoContent,
+			responseHeaders: map[string]string{
+				"Access-Control-Allow-Origin":      "https://admin.example.com",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Allow-Methods":     "DELETE",
+			},
+		},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+
+			req, _ := http.NewRequest(http.MethodOptions, tc.path, nil)
+			req.Header.Set("Origin", tc.origin)
+			req.Header.Set("Access-Control-Request-Method", tc.method)
+
+			res := httptest.NewRecorder()
+
+			r.ServeHTTP(res, req)
+
+			if res.Code != tc.status {
+				t.Errorf("response code is: %d, expected: %d", res.Code, tc.status)
+			}
+
+			assertResponseHeaders(t, res.Header(), tc.responseHeaders)
+		})
+	}
+}
+
+func TestCors_PrivateNetworkAccess(t *testing.T) {
+
+	tests := []struct {
+		name            string
+		options         []CorsOption
+		status          int
+		responseHeaders map[string]string
+	}{
+		{
+			name:    "NotAllowed",
+			options: []CorsOption{},
+			status:  http.StatusForbidden,
+			responseHeaders: map[string]string{
+				"Access-Control-Allow-Private-Network": "",
+				"Access-Control-Allow-Origin":          "",
+			},
+		},
+		{
+			name:    "Allowed",
+			options: []CorsOption{WithAllowPrivateNetwork(true)},
+			status:  http.StatusNoContent,
+			responseHeaders: map[string]string{
+				"Access-Control-Allow-Private-Network": "true",
+				"Access-Control-Allow-Origin":          "*",
+			},
+		},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+
+			req, _ := http.NewRequest(http.MethodOptions, "http://192.168.1.10/dashboard", nil)
+			req.Header.Set("Origin", "https://dashboard.example.com")
+			req.Header.Set("Access-Control-Request-Method", "GET")
+			req.Header.Set("Access-Control-Request-Private-Network", "true")
+
+			res := httptest.NewRecorder()
+
+			Cors(tc.options...)(func(w http.ResponseWriter, r *http.Request) {}).ServeHTTP(res, req)
+
+			if res.Code != tc.status {
+				t.Errorf("response code is: %d, expected: %d", res.Code, tc.status)
+			}
+
+			vary := res.Header().Values("Vary")
+			if vary[len(vary)-1] != "Access-Control-Request-Private-Network" {
+				t.Errorf("response header Vary is: %v", vary)
+			}
+
+			assertResponseHeaders(t, res.Header(), tc.responseHeaders)
+		})
+	}
+}
+
+func TestCors_RejectMode(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		mode        CorsRejectMode
+		origin      string
+		called      bool
+		status      int
+		contentType string
+	}{
+		{name: "PassThrough", mode: CorsRejectPassThrough, origin: "https://evil.example.net", called: true, status: http.StatusOK},
+		{name: "Forbidden", mode: CorsRejectForbidden, origin: "https://evil.example.net", called: false, status: http.StatusForbidden, contentType: problem.ContentType},
+		{name: "Abort", mode: CorsRejectAbort, origin: "https://evil.example.net", called: false, status: http.StatusForbidden},
+		{name: "AllowedOrigin", mode: CorsRejectForbidden, origin: "https://app.example.com", called: true, status: http.StatusOK},
+		{name: "NoOrigin", mode: CorsRejectForbidden, origin: "", called: true, status: http.StatusOK},
+		{name: "SameOrigin", mode: CorsRejectForbidden, origin: "http://api.example.com", called: true, status: http.StatusOK},
+		{name: "SameHostOtherPort", mode: CorsRejectForbidden, origin: "http://api.example.com:8080", called: false, status: http.StatusForbidden, contentType: problem.ContentType},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+
+			req, _ := http.NewRequest(http.MethodPost, "http://api.example.com/orders", nil)
+			if tc.origin != "" {
+				req.Header.Set("Origin", tc.origin)
+			}
+
+			res := httptest.NewRecorder()
+			called := false
+
+			mw := Cors(WithAllowedOrigins("https://app.example.com"), WithRejectMode(tc.mode))
+
+			mw(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				w.WriteHeader(http.StatusOK)
+			}).ServeHTTP(res, req)
+
+			if called != tc.called {
+				t.Errorf("handler called: %t, expected: %t", called, tc.called)
+			}
+
+			if res.Code != tc.status {
+				t.Errorf("response code is: %d, expected: %d", res.Code, tc.status)
+			}
+
+			if res.Header().Get("Content-Type") != tc.contentType {
+				t.Errorf("content type is: %s, expected: %s", res.Header().Get("Content-Type"), tc.contentType)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"io/fs"
+	"sync"
+	"time"
+)
+
+type etagEntry struct {
+	modTime time.Time
+	size    int64
+	etag    string
+}
+
+// etagCache holds the content hash ETags of files by name.
+type etagCache struct {
+	mu      sync.RWMutex
+	entries map[string]etagEntry
+}
+
+func newETagCache() *etagCache {
+	return &etagCache{
+		entries: make(map[string]etagEntry),
+	}
+}
+
+// get returns the strong ETag of the file name, hashing content if the
+// cached ETag is missing or the file changed since it was computed. content
+// is rewound to its start.
+func (c *etagCache) get(name string, fi fs.FileInfo, content io.ReadSeeker) (string, error) {
+
+	c.mu.RLock()
+	entry, ok := c.entries[name]
+	c.mu.RUnlock()
+
+	if ok && entry.modTime.Equal(fi.ModTime()) && entry.size == fi.Size() {
+		return entry.etag, nil
+	}
+
+	etag, err := contentETag(content)
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	c.entries[name] = etagEntry{
+		modTime: fi.ModTime(),
+		size:    fi.Size(),
+		etag:    etag,
+	}
+	c.mu.Unlock()
+
+	return etag, nil
+}
+
+// contentETag returns a strong ETag for the content read from r, which is
+// rewound to its start afterwards.
+func contentETag(r io.ReadSeeker) (string, error) {
+
+	h := sha256.New()
+
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	return `"` + base64.RawURLEncoding.EncodeToString(h.Sum(nil)[:16]) + `"`, nil
+}
@@ -0,0 +1,328 @@
+package middleware
+
+import (
+	"bytes"
+	"container/list"
+	"errors"
+	"io"
+	"io/fs"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMemoryCacheMaxFileSize is the size of the largest file kept in
+	// the memory cache unless set with WithMemoryCacheMaxFileSize.
+	DefaultMemoryCacheMaxFileSize = 1 << 20
+
+	// DefaultMemoryCacheRevalidate is how long cached files are served
+	// before they are checked for changes, unless set with
+	// WithMemoryCacheRevalidate.
+	DefaultMemoryCacheRevalidate = 2 * time.Second
+
+	// DefaultMemoryCacheMaxMissing is the number of missing or denied names
+	// remembered by the memory cache unless set with
+	// WithMemoryCacheMaxMissing.
+	DefaultMemoryCacheMaxMissing = 1024
+
+	// memoryCacheEntrySize is the cost charged against the budget for each
+	// cached file besides its name and content.
+	memoryCacheEntrySize = 64
+)
+
+// WithMemoryCache keeps small files, and their precompressed variants, in
+// an in-memory LRU cache of at most budget bytes, so hot files are served
+// without opening them. Cached files are checked for changes with a stat
+// after DefaultMemoryCacheRevalidate.
+func WithMemoryCache(budget int64) func(*FilesOptions) {
+	return func(opts *FilesOptions) {
+		opts.MemoryCacheBudget = budget
+	}
+}
+
+// WithMemoryCacheMaxFileSize sets the size of the largest file kept in the
+// memory cache. Larger files are always read from the file system.
+func WithMemoryCacheMaxFileSize(size int64) func(*FilesOptions) {
+	return func(opts *FilesOptions) {
+		opts.MemoryCacheMaxFileSize = size
+	}
+}
+
+// WithMemoryCacheMaxMissing sets how many names that do not exist, or that
+// the access policy denies, the memory cache remembers. They are kept apart
+// from the files, so requests for random names cannot evict them.
+func WithMemoryCacheMaxMissing(n int) func(*FilesOptions) {
+	return func(opts *FilesOptions) {
+		opts.MemoryCacheMaxMissing = n
+	}
+}
+
+// WithMemoryCacheRevalidate sets how long cached files are served before
+// the file system is checked for changes. Zero checks on every request,
+// which still saves reading and hashing unchanged files.
+func WithMemoryCacheRevalidate(d time.Duration) func(*FilesOptions) {
+	return func(opts *FilesOptions) {
+		opts.MemoryCacheRevalidate = d
+	}
+}
+
+// memoryCacheEntry is a cached file or, when fi is nil, a name that does
+// not exist or that check denied, as told by err.
+type memoryCacheEntry struct {
+	name      string
+	fi        fs.FileInfo
+	err       error
+	content   []byte
+	etag      string
+	checkedAt time.Time
+}
+
+func (e *memoryCacheEntry) missing() bool {
+	return e.fi == nil
+}
+
+func (e *memoryCacheEntry) cost() int64 {
+
+	if e.missing() {
+		return 0
+	}
+
+	return int64(len(e.content)+len(e.name)) + memoryCacheEntrySize
+}
+
+// memoryCacheFS is an fs.FS serving small files of fsys from memory. Names
+// that do not exist are remembered too, which spares the lookups of
+// precompressed variants that were never built. They are kept in their own
+// LRU list, limited by count rather than by the byte budget of the files.
+//
+// If check is set, it is called with names before they are opened and its
+// error, such as errFileDenied, is remembered like a missing file, so the
+// access policy is not applied again to cached names until they are
+// revalidated.
+type memoryCacheFS struct {
+	fsys        fs.FS
+	budget      int64
+	maxFileSize int64
+	maxMissing  int
+	revalidate  time.Duration
+	check       func(name string) error
+	now         func() time.Time
+
+	mu      sync.Mutex
+	size    int64
+	lru     *list.List
+	missing *list.List
+	entries map[string]*list.Element
+}
+
+func newMemoryCacheFS(fsys fs.FS, budget, maxFileSize int64, maxMissing int, revalidate time.Duration) *memoryCacheFS {
+
+	if maxFileSize <= 0 || maxFileSize > budget {
+		maxFileSize = budget
+	}
+
+	return &memoryCacheFS{
+		fsys:        fsys,
+		budget:      budget,
+		maxFileSize: maxFileSize,
+		maxMissing:  maxMissing,
+		revalidate:  revalidate,
+		now:         time.Now,
+		lru:         list.New(),
+		missing:     list.New(),
+		entries:     make(map[string]*list.Element),
+	}
+}
+
+func (c *memoryCacheFS) Open(name string) (fs.File, error) {
+
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if entry := c.lookup(name); entry != nil {
+		return entry.open()
+	}
+
+	if c.check != nil {
+		if err := c.check(name); err != nil {
+			c.store(&memoryCacheEntry{name: name, err: err, checkedAt: c.now()})
+			return nil, err
+		}
+	}
+
+	f, err := c.fsys.Open(name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			c.store(&memoryCacheEntry{name: name, err: fs.ErrNotExist, checkedAt: c.now()})
+		}
+		return nil, err
+	}
+
+	fi, err := f.Stat()
+	if err != nil || fi.IsDir() || !fi.Mode().IsRegular() || fi.Size() > c.maxFileSize {
+		return f, nil
+	}
+
+	content, err := io.ReadAll(f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &memoryCacheEntry{
+		name:      name,
+		fi:        fi,
+		content:   content,
+		etag:      contentETagOf(content),
+		checkedAt: c.now(),
+	}
+
+	// The file changed while it was read, so it is not cached.
+	if int64(len(content)) != fi.Size() {
+		return entry.open()
+	}
+
+	c.store(entry)
+
+	return entry.open()
+}
+
+// lookup returns the cached entry for name, or nil if it is not cached or
+// the file changed since it was cached.
+func (c *memoryCacheFS) lookup(name string) *memoryCacheEntry {
+
+	c.mu.Lock()
+	elem, ok := c.entries[name]
+	if !ok {
+		c.mu.Unlock()
+		return nil
+	}
+	entry := elem.Value.(*memoryCacheEntry)
+	if entry.missing() {
+		c.missing.MoveToFront(elem)
+	} else {
+		c.lru.MoveToFront(elem)
+	}
+	c.mu.Unlock()
+
+	now := c.now()
+	if now.Sub(entry.checkedAt) < c.revalidate {
+		return entry
+	}
+
+	// Denied names, and names the policy now denies, are left for Open to
+	// check again.
+	if (entry.missing() && entry.err != fs.ErrNotExist) || (c.check != nil && c.check(name) != nil) {
+		c.remove(name)
+		return nil
+	}
+
+	fi, err := fs.Stat(c.fsys, name)
+
+	switch {
+	case entry.missing() && errors.Is(err, fs.ErrNotExist):
+	case !entry.missing() && err == nil && fi.ModTime().Equal(entry.fi.ModTime()) && fi.Size() == entry.fi.Size():
+	default:
+		c.remove(name)
+		return nil
+	}
+
+	// Entries are replaced rather than updated, as they are read without
+	// holding the lock.
+	revalidated := *entry
+	revalidated.checkedAt = now
+	c.store(&revalidated)
+
+	return &revalidated
+}
+
+func (c *memoryCacheFS) store(entry *memoryCacheEntry) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[entry.name]; ok {
+		c.removeElement(elem)
+	}
+
+	if entry.missing() {
+
+		if c.maxMissing <= 0 {
+			return
+		}
+
+		c.entries[entry.name] = c.missing.PushFront(entry)
+
+		for c.missing.Len() > c.maxMissing {
+			c.removeElement(c.missing.Back())
+		}
+
+		return
+	}
+
+	c.entries[entry.name] = c.lru.PushFront(entry)
+	c.size += entry.cost()
+
+	for c.size > c.budget {
+		c.removeElement(c.lru.Back())
+	}
+}
+
+func (c *memoryCacheFS) remove(name string) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[name]; ok {
+		c.removeElement(elem)
+	}
+}
+
+// removeElement must be called with c.mu held.
+func (c *memoryCacheFS) removeElement(elem *list.Element) {
+
+	entry := elem.Value.(*memoryCacheEntry)
+
+	if entry.missing() {
+		c.missing.Remove(elem)
+	} else {
+		c.lru.Remove(elem)
+		c.size -= entry.cost()
+	}
+
+	delete(c.entries, entry.name)
+}
+
+func (e *memoryCacheEntry) open() (fs.File, error) {
+
+	if e.missing() {
+		return nil, &fs.PathError{Op: "open", Path: e.name, Err: e.err}
+	}
+
+	return &memoryFile{entry: e, Reader: bytes.NewReader(e.content)}, nil
+}
+
+// memoryFile is an open cached file. It implements io.ReadSeeker, so it is
+// served without copying, and reports the ETag computed when it was cached.
+type memoryFile struct {
+	*bytes.Reader
+	entry *memoryCacheEntry
+}
+
+func (f *memoryFile) Stat() (fs.FileInfo, error) {
+	return f.entry.fi, nil
+}
+
+func (f *memoryFile) Close() error {
+	return nil
+}
+
+func (f *memoryFile) ETag() string {
+	return f.entry.etag
+}
+
+func contentETagOf(content []byte) string {
+	etag, _ := contentETag(bytes.NewReader(content))
+	return etag
+}
@@ -0,0 +1,271 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+type countingFS struct {
+	fs.FS
+	opens atomic.Int64
+}
+
+func (c *countingFS) Open(name string) (fs.File, error) {
+	c.opens.Add(1)
+	return c.FS.Open(name)
+}
+
+func TestFiles_MemoryCache(t *testing.T) {
+
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	fsys := &countingFS{FS: fstest.MapFS{
+		"app.js":    {Data: []byte("plain js"), ModTime: modTime},
+		"app.js.br": {Data: []byte("brotli js"), ModTime: modTime},
+		"large.bin": {Data: bytes.Repeat([]byte("x"), 64), ModTime: modTime},
+	}}
+
+	m := Files(WithFS(fsys), WithMemoryCache(1024), WithMemoryCacheMaxFileSize(32), WithETags())
+
+	first := serveFiles(t, m, "GET", "app.js", map[string]string{"Accept-Encoding": "br"})
+	opens := fsys.opens.Load()
+
+	for i := 0; i < 3; i++ {
+
+		w := serveFiles(t, m, "GET", "app.js", map[string]string{"Accept-Encoding": "br"})
+
+		if w.Body.String() != "brotli js" {
+			t.Errorf("response body is: %s, expected: %s", w.Body.String(), "brotli js")
+		}
+
+		if w.Header().Get("ETag") != first.Header().Get("ETag") || w.Header().Get("ETag") == "" {
+			t.Errorf("etag is: %s, expected: %s", w.Header().Get("ETag"), first.Header().Get("ETag"))
+		}
+	}
+
+	if fsys.opens.Load() != opens {
+		t.Errorf("cached file was opened %d more times", fsys.opens.Load()-opens)
+	}
+
+	// Missing variants are remembered, so only the first request opens them.
+	serveFiles(t, m, "GET", "app.js", map[string]string{"Accept-Encoding": "gzip"})
+	opens = fsys.opens.Load()
+	serveFiles(t, m, "GET", "app.js", map[string]string{"Accept-Encoding": "gzip"})
+
+	if fsys.opens.Load() != opens {
+		t.Errorf("missing variant was opened %d more times", fsys.opens.Load()-opens)
+	}
+
+	// Files over the size limit are read every time.
+	serveFiles(t, m, "GET", "large.bin", nil)
+	opens = fsys.opens.Load()
+	w := serveFiles(t, m, "GET", "large.bin", map[string]string{"Range": "bytes=0-3"})
+
+	if fsys.opens.Load() == opens {
+		t.Error("file over the size limit was served from the cache")
+	}
+
+	if w.Code != http.StatusPartialContent || w.Body.String() != "xxxx" {
+		t.Errorf("response is: %d %s, expected: %d %s", w.Code, w.Body.String(), http.StatusPartialContent, "xxxx")
+	}
+}
+
+func TestMemoryCacheFS_Eviction(t *testing.T) {
+
+	fsys := fstest.MapFS{
+		"a.txt": {Data: bytes.Repeat([]byte("a"), 100)},
+		"b.txt": {Data: bytes.Repeat([]byte("b"), 100)},
+		"c.txt": {Data: bytes.Repeat([]byte("c"), 100)},
+	}
+
+	// Room for two entries.
+	c := newMemoryCacheFS(fsys, 2*(100+5+memoryCacheEntrySize), 0, 0, time.Hour)
+
+	for _, name := range []string{"a.txt", "b.txt", "a.txt", "c.txt"} {
+		f, err := c.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+	}
+
+	for name, cached := range map[string]bool{"a.txt": true, "b.txt": false, "c.txt": true} {
+		if _, ok := c.entries[name]; ok != cached {
+			t.Errorf("%s cached is: %t, expected: %t", name, ok, cached)
+		}
+	}
+
+	if c.size > c.budget {
+		t.Errorf("cache size is: %d, expected at most: %d", c.size, c.budget)
+	}
+
+	if err := fstest.TestFS(c, "a.txt", "b.txt", "c.txt"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMemoryCacheFS_MaxMissing(t *testing.T) {
+
+	fsys := fstest.MapFS{
+		"a.txt": {Data: bytes.Repeat([]byte("a"), 100)},
+	}
+
+	c := newMemoryCacheFS(fsys, 1024, 0, 2, time.Hour)
+
+	if _, err := c.Open("a.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"x", "y", "z"} {
+		if _, err := c.Open(name); err == nil {
+			t.Fatalf("missing file %s was opened", name)
+		}
+	}
+
+	for name, cached := range map[string]bool{"a.txt": true, "x": false, "y": true, "z": true} {
+		if _, ok := c.entries[name]; ok != cached {
+			t.Errorf("%s cached is: %t, expected: %t", name, ok, cached)
+		}
+	}
+
+	if c.missing.Len() != 2 {
+		t.Errorf("missing entries are: %d, expected: %d", c.missing.Len(), 2)
+	}
+
+	if c.size != 100+5+memoryCacheEntrySize {
+		t.Errorf("cache size is: %d, expected: %d", c.size, 100+5+memoryCacheEntrySize)
+	}
+}
+
+func TestMemoryCacheFS_Check(t *testing.T) {
+
+	fsys := fstest.MapFS{
+		"a.txt":      {Data: []byte("a")},
+		"secret.txt": {Data: []byte("s")},
+	}
+
+	checks := 0
+
+	c := newMemoryCacheFS(fsys, 1024, 0, DefaultMemoryCacheMaxMissing, time.Hour)
+	c.check = func(name string) error {
+		checks++
+		if name == "secret.txt" {
+			return errFileDenied
+		}
+		return nil
+	}
+
+	for i := 0; i < 3; i++ {
+
+		if _, err := c.Open("a.txt"); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := c.Open("secret.txt"); !errors.Is(err, errFileDenied) {
+			t.Errorf("error is: %v, expected: %v", err, errFileDenied)
+		}
+	}
+
+	if checks != 2 {
+		t.Errorf("checks are: %d, expected: %d", checks, 2)
+	}
+}
+
+func TestMemoryCacheFS_Revalidate(t *testing.T) {
+
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	fsys := fstest.MapFS{
+		"app.js": {Data: []byte("v1"), ModTime: modTime},
+	}
+
+	now := modTime
+	c := newMemoryCacheFS(fsys, 1024, 0, DefaultMemoryCacheMaxMissing, time.Second)
+	c.now = func() time.Time { return now }
+
+	read := func() string {
+		t.Helper()
+		b, err := fs.ReadFile(c, "app.js")
+		if err != nil {
+			return err.Error()
+		}
+		return string(b)
+	}
+
+	if body := read(); body != "v1" {
+		t.Fatalf("content is: %s, expected: v1", body)
+	}
+
+	fsys["app.js"] = &fstest.MapFile{Data: []byte("v2"), ModTime: modTime.Add(time.Minute)}
+
+	if body := read(); body != "v1" {
+		t.Errorf("content before revalidation is: %s, expected: v1", body)
+	}
+
+	now = now.Add(time.Second)
+
+	if body := read(); body != "v2" {
+		t.Errorf("content after revalidation is: %s, expected: v2", body)
+	}
+
+	delete(fsys, "app.js")
+	now = now.Add(time.Second)
+
+	if _, err := c.Open("app.js"); err == nil {
+		t.Error("deleted file was served from the cache")
+	}
+
+	fsys["app.js"] = &fstest.MapFile{Data: []byte("v3"), ModTime: modTime.Add(time.Hour)}
+
+	if _, err := c.Open("app.js"); err == nil {
+		t.Error("missing file was not remembered until revalidation")
+	}
+
+	now = now.Add(time.Second)
+
+	if body := read(); body != "v3" {
+		t.Errorf("content of the recreated file is: %s, expected: v3", body)
+	}
+}
+
+func benchmarkFiles(b *testing.B, options ...FilesOption) {
+
+	dir := b.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "app.js"), bytes.Repeat([]byte("console.log(1);\n"), 1024), 0o644); err != nil {
+		b.Fatal(err)
+	}
+
+	handler := FileServer(append([]FilesOption{WithDirectory(dir), WithETags()}, options...)...)
+
+	req := httptest.NewRequest("GET", "/app.js", nil)
+	req.SetPathValue("filePath", "app.js")
+	req.Header.Set("Accept-Encoding", "br, gzip")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		w := httptest.NewRecorder()
+		handler(w, req)
+		if w.Code != http.StatusOK {
+			b.Fatalf("response code is: %d", w.Code)
+		}
+	}
+}
+
+func BenchmarkFiles_Uncached(b *testing.B) {
+	benchmarkFiles(b)
+}
+
+func BenchmarkFiles_MemoryCache(b *testing.B) {
+	benchmarkFiles(b, WithMemoryCache(1<<20))
+}
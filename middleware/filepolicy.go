@@ -0,0 +1,207 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// DotfilePolicy controls access to files and directories whose name starts
+// with a dot, such as ".env" or ".git/config". The ".well-known" directory
+// at the root of the served files (RFC 8615), used for ACME challenges and
+// security.txt, is not a dotfile; dotfiles inside it are.
+type DotfilePolicy int
+
+const (
+	// DotfilesDeny answers requests for dotfiles with 404 Not Found.
+	DotfilesDeny DotfilePolicy = iota
+	// DotfilesIgnore treats dotfiles as if they did not exist, so the SPA
+	// fallback is served in their place.
+	DotfilesIgnore
+	// DotfilesAllow serves dotfiles like any other file.
+	DotfilesAllow
+)
+
+// SymlinkPolicy controls how symbolic links below the directory set with
+// WithDirectory are served. It cannot be enforced on a file system set with
+// WithFS, which decides for itself: os.DirFS, for one, follows every link.
+type SymlinkPolicy int
+
+const (
+	// SymlinksConfine follows symbolic links whose target is inside the
+	// directory.
+	SymlinksConfine SymlinkPolicy = iota
+	// SymlinksDeny refuses every path that goes through a symbolic link.
+	SymlinksDeny
+	// SymlinksFollow follows every symbolic link, even out of the directory.
+	SymlinksFollow
+)
+
+// errFileDenied is returned for files refused by the access policy. Like
+// missing files they are answered with 404 Not Found, so clients cannot
+// tell whether they exist.
+var errFileDenied = errors.New("file denied by access policy")
+
+// WithDotfiles sets the policy for dotfiles. The default is DotfilesDeny.
+func WithDotfiles(policy DotfilePolicy) func(*FilesOptions) {
+	return func(opts *FilesOptions) {
+		opts.Dotfiles = policy
+	}
+}
+
+// WithAllowedExtensions only serves files with one of the extensions, such
+// as ".css" or ".js". Index and fallback files must be allowed too.
+func WithAllowedExtensions(extensions ...string) func(*FilesOptions) {
+	return func(opts *FilesOptions) {
+		opts.AllowedExtensions = extensions
+	}
+}
+
+// WithDeniedExtensions never serves files with one of the extensions, such
+// as ".map" or ".bak".
+func WithDeniedExtensions(extensions ...string) func(*FilesOptions) {
+	return func(opts *FilesOptions) {
+		opts.DeniedExtensions = extensions
+	}
+}
+
+// WithSymlinks sets the policy for symbolic links. The default is
+// SymlinksConfine. Files and FileServer panic if SymlinksConfine or
+// SymlinksDeny is set together with WithFS, as it would not be enforced;
+// serve the directory with WithDirectory instead.
+func WithSymlinks(policy SymlinkPolicy) func(*FilesOptions) {
+	return func(opts *FilesOptions) {
+		opts.Symlinks = policy
+		opts.symlinksSet = true
+	}
+}
+
+// WithMaxFileSize refuses files larger than size bytes. Zero, the default,
+// serves files of any size.
+func WithMaxFileSize(size int64) func(*FilesOptions) {
+	return func(opts *FilesOptions) {
+		opts.MaxFileSize = size
+	}
+}
+
+// checkPath applies the dotfile and symlink policies to name before it is
+// opened. With the memory cache the symlink policy is applied by the cache,
+// which remembers the result with the entry instead of resolving the path
+// on every request.
+func (fsrv *fileServer) checkPath(name string) error {
+
+	if fsrv.opts.Dotfiles != DotfilesAllow && hasDotSegment(name) {
+		if fsrv.opts.Dotfiles == DotfilesIgnore {
+			return fmt.Errorf("%s: %w", name, fs.ErrNotExist)
+		}
+		return errFileDenied
+	}
+
+	if fsrv.cached {
+		return nil
+	}
+
+	return fsrv.checkLinks(name)
+}
+
+// checkLinks applies the symlink policy to name.
+func (fsrv *fileServer) checkLinks(name string) error {
+
+	if fsrv.opts.FS != nil || fsrv.opts.Symlinks == SymlinksFollow {
+		return nil
+	}
+
+	return checkSymlinks(fsrv.opts.Directory, name, fsrv.opts.Symlinks)
+}
+
+// checkFile applies the extension and size limits to the file name.
+func (fsrv *fileServer) checkFile(name string, fi fs.FileInfo) error {
+
+	ext := path.Ext(name)
+
+	if len(fsrv.opts.AllowedExtensions) > 0 && !containsFold(fsrv.opts.AllowedExtensions, ext) {
+		return errFileDenied
+	}
+
+	if containsFold(fsrv.opts.DeniedExtensions, ext) {
+		return errFileDenied
+	}
+
+	if fsrv.opts.MaxFileSize > 0 && fi.Size() > fsrv.opts.MaxFileSize {
+		return errFileDenied
+	}
+
+	return nil
+}
+
+// listable reports whether a directory entry is shown in listings.
+func (fsrv *fileServer) listable(name string, fi fs.FileInfo) bool {
+
+	if fsrv.opts.Dotfiles != DotfilesAllow && hasDotSegment(name) {
+		return false
+	}
+
+	return fi.IsDir() || fsrv.checkFile(name, fi) == nil
+}
+
+func hasDotSegment(name string) bool {
+
+	for i, segment := range strings.Split(name, "/") {
+		if strings.HasPrefix(segment, ".") && segment != "." && !(i == 0 && segment == ".well-known") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkSymlinks checks the symbolic links on the path from the directory
+// root to name. Paths that do not exist are left for Open to report.
+func checkSymlinks(root, name string, policy SymlinkPolicy) error {
+
+	if name == "." {
+		return nil
+	}
+
+	if policy == SymlinksDeny {
+
+		p := root
+
+		for _, segment := range strings.Split(name, "/") {
+
+			p = filepath.Join(p, segment)
+
+			fi, err := os.Lstat(p)
+			if err != nil {
+				return nil
+			}
+
+			if fi.Mode()&fs.ModeSymlink != 0 {
+				return errFileDenied
+			}
+		}
+
+		return nil
+	}
+
+	resolvedRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return nil
+	}
+
+	resolved, err := filepath.EvalSymlinks(filepath.Join(root, filepath.FromSlash(name)))
+	if err != nil {
+		return nil
+	}
+
+	rel, err := filepath.Rel(resolvedRoot, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return errFileDenied
+	}
+
+	return nil
+}
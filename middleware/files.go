@@ -1,8 +1,16 @@
 package middleware
 
 import (
-	"fmt"
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
 	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
 
 	"github.com/ironfang-ltd/go-router"
 )
@@ -10,31 +18,178 @@ import (
 type FilesOption func(*FilesOptions)
 
 type FilesOptions struct {
-	Directory string
+	Directory        string
+	FS               fs.FS
+	IndexFiles       []string
+	Precompressed    []string
+	SPAFallback      string
+	DirectoryListing bool
+	CacheRules       []CacheRule
+	ETags            bool
+
+	Dotfiles          DotfilePolicy
+	AllowedExtensions []string
+	DeniedExtensions  []string
+	Symlinks          SymlinkPolicy
+	MaxFileSize       int64
+	Logger            *slog.Logger
+
+	// symlinksSet records that WithSymlinks was used.
+	symlinksSet bool
+
+	MemoryCacheBudget      int64
+	MemoryCacheMaxFileSize int64
+	MemoryCacheMaxMissing  int
+	MemoryCacheRevalidate  time.Duration
 }
 
+// WithDirectory serves files from a directory on disk.
 func WithDirectory(dir string) func(*FilesOptions) {
 	return func(opts *FilesOptions) {
 		opts.Directory = dir
+		opts.FS = nil
 	}
 }
 
-func Files(options ...FilesOption) router.Middleware {
+// WithFS serves files from fsys, such as an embed.FS, a zip.Reader or an
+// Overlay of several file systems. Use fs.Sub to serve a subdirectory.
+func WithFS(fsys fs.FS) func(*FilesOptions) {
+	return func(opts *FilesOptions) {
+		opts.FS = fsys
+	}
+}
+
+// WithFilesLogger sets the logger for files that cannot be served. The
+// default is slog.Default().
+func WithFilesLogger(logger *slog.Logger) func(*FilesOptions) {
+	return func(opts *FilesOptions) {
+		opts.Logger = logger
+	}
+}
+
+// WithIndexFiles sets the files served for a directory, tried in order. The
+// default is "index.html"; no names disables index files.
+func WithIndexFiles(names ...string) func(*FilesOptions) {
+	return func(opts *FilesOptions) {
+		opts.IndexFiles = names
+	}
+}
+
+// WithPrecompressed sets the content codings, in order of preference, whose
+// precompressed variants are served to clients that accept them. The
+// default is "br" and "gzip", served from files with a ".br" and ".gz"
+// suffix; "zstd" uses ".zst". No codings disables precompressed variants.
+func WithPrecompressed(encodings ...string) func(*FilesOptions) {
+
+	for _, encoding := range encodings {
+		if _, ok := precompressedExtensions[encoding]; !ok {
+			panic("unsupported precompressed encoding: " + encoding)
+		}
+	}
+
+	return func(opts *FilesOptions) {
+		opts.Precompressed = encodings
+	}
+}
+
+// WithSPA serves the fallback file, usually "index.html", for paths that do
+// not exist, so a single page application can route them on the client.
+// Missing paths with a file extension, such as "/app.js", are still 404s.
+func WithSPA(fallback string) func(*FilesOptions) {
+	return func(opts *FilesOptions) {
+		opts.SPAFallback = fallback
+	}
+}
+
+// WithDirectoryListing lists the contents of directories without an index
+// file, as HTML or as JSON depending on the Accept header.
+func WithDirectoryListing() func(*FilesOptions) {
+	return func(opts *FilesOptions) {
+		opts.DirectoryListing = true
+	}
+}
+
+// WithCacheControl sets the Cache-Control header of served files from the
+// first rule matching the file name, such as DefaultCacheRules. Files
+// without a matching rule get no Cache-Control header.
+func WithCacheControl(rules ...CacheRule) func(*FilesOptions) {
+	return func(opts *FilesOptions) {
+		opts.CacheRules = rules
+	}
+}
+
+// WithETags sets a strong ETag computed from the content of each served
+// file. Hashes are cached until the modification time or size of the file
+// changes.
+func WithETags() func(*FilesOptions) {
+	return func(opts *FilesOptions) {
+		opts.ETags = true
+	}
+}
+
+type fileServer struct {
+	opts   *FilesOptions
+	fsys   fs.FS
+	etags  *etagCache
+	cached bool
+}
+
+func newFileServer(options []FilesOption) *fileServer {
 
 	opts := &FilesOptions{
-		Directory: "./web/static",
+		Directory:     "./web/static",
+		IndexFiles:    []string{"index.html"},
+		Precompressed: []string{"br", "gzip"},
+		Logger:        slog.Default(),
+
+		MemoryCacheMaxFileSize: DefaultMemoryCacheMaxFileSize,
+		MemoryCacheMaxMissing:  DefaultMemoryCacheMaxMissing,
+		MemoryCacheRevalidate:  DefaultMemoryCacheRevalidate,
 	}
 
 	for _, option := range options {
 		option(opts)
 	}
 
-	fs := http.Dir(opts.Directory)
+	if opts.FS != nil && opts.symlinksSet && opts.Symlinks != SymlinksFollow {
+		panic("symlink policy cannot be enforced on a file system set with WithFS")
+	}
+
+	fsys := opts.FS
+	if fsys == nil {
+		fsys = os.DirFS(opts.Directory)
+	}
+
+	fsrv := &fileServer{
+		opts: opts,
+		fsys: fsys,
+	}
+
+	if opts.MemoryCacheBudget > 0 {
+		cache := newMemoryCacheFS(fsys, opts.MemoryCacheBudget, opts.MemoryCacheMaxFileSize, opts.MemoryCacheMaxMissing, opts.MemoryCacheRevalidate)
+		cache.check = fsrv.checkLinks
+		fsrv.fsys = cache
+		fsrv.cached = true
+	}
+
+	if opts.ETags {
+		fsrv.etags = newETagCache()
+	}
+
+	return fsrv
+}
+
+// Files serves GET and HEAD requests that have a "filePath" path value from
+// the configured file system and passes all other requests to the next
+// handler.
+func Files(options ...FilesOption) router.Middleware {
+
+	fsrv := newFileServer(options)
 
 	return func(next http.HandlerFunc) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
 
-			if r.Method == http.MethodGet {
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
 
 				filePath := r.PathValue("filePath")
 				if filePath == "" {
@@ -42,31 +197,224 @@ func Files(options ...FilesOption) router.Middleware {
 					return
 				}
 
-				f, err := fs.Open(filePath)
-				if err != nil {
-					fmt.Println("Error opening file: " + err.Error())
-					w.WriteHeader(http.StatusNotFound)
-					return
-				}
-				defer f.Close()
+				fsrv.serve(w, r, filePath)
 
-				fi, err := f.Stat()
-				if err != nil {
-					w.WriteHeader(http.StatusInternalServerError)
-					return
-				}
+				return
+			}
 
-				if fi.IsDir() {
-					w.WriteHeader(http.StatusNotFound)
-					return
-				}
+			next(w, r)
+		}
+	}
+}
+
+// FileServer returns a handler serving the "filePath" path value from the
+// configured file system, with an empty value naming the root. It is meant
+// for RouteGroup.Static:
+//
+//	r.Static("/assets", middleware.FileServer(middleware.WithFS(assets)))
+func FileServer(options ...FilesOption) http.HandlerFunc {
+
+	fsrv := newFileServer(options)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		fsrv.serve(w, r, r.PathValue("filePath"))
+	}
+}
+
+func (fsrv *fileServer) serve(w http.ResponseWriter, r *http.Request, filePath string) {
 
-				http.ServeContent(w, r, fi.Name(), fi.ModTime(), f)
+	name, ok := cleanFilePath(filePath)
+	if !ok {
+		fsrv.notFound(w, r)
+		return
+	}
 
+	f, fi, err := fsrv.open(name)
+	if err != nil {
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			if fsrv.opts.SPAFallback != "" && path.Ext(name) == "" {
+				fsrv.serveFallback(w, r)
 				return
 			}
+		case errors.Is(err, errFileDenied):
+			fsrv.opts.Logger.Debug("file denied", "name", name)
+		default:
+			fsrv.opts.Logger.Error("error opening file", "name", name, "error", err)
+		}
+		fsrv.notFound(w, r)
+		return
+	}
+	defer f.Close()
 
-			next(w, r)
+	if fi.IsDir() {
+		fsrv.serveDir(w, r, name)
+		return
+	}
+
+	fsrv.serveFile(w, r, name, f, fi)
+}
+
+// open opens and stats the file name if the access policy allows it.
+func (fsrv *fileServer) open(name string) (fs.File, fs.FileInfo, error) {
+
+	if err := fsrv.checkPath(name); err != nil {
+		return nil, nil, err
+	}
+
+	f, err := fsrv.fsys.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+
+	return f, fi, nil
+}
+
+// serveFile serves the file name, which is open as f, or a precompressed
+// variant of it.
+func (fsrv *fileServer) serveFile(w http.ResponseWriter, r *http.Request, name string, f fs.File, fi fs.FileInfo) {
+
+	if err := fsrv.checkFile(name, fi); err != nil {
+		fsrv.opts.Logger.Debug("file denied", "name", name)
+		fsrv.notFound(w, r)
+		return
+	}
+
+	fsrv.setCacheControl(w, name)
+
+	key := name
+
+	if variant, variantInfo, variantName := fsrv.precompressed(w, r, name); variant != nil {
+		defer variant.Close()
+		f, fi, key = variant, variantInfo, variantName
+	}
+
+	content, err := seekableContent(f)
+	if err != nil {
+		router.WriteError(w, r, err)
+		return
+	}
+
+	if fsrv.etags != nil && w.Header().Get("ETag") == "" {
+
+		etag := ""
+
+		if cached, ok := f.(*memoryFile); ok {
+			etag = cached.ETag()
+		} else if etag, err = fsrv.etags.get(key, fi, content); err != nil {
+			router.WriteError(w, r, err)
+			return
+		}
+
+		w.Header().Set("ETag", etag)
+	}
+
+	http.ServeContent(w, r, fi.Name(), fi.ModTime(), content)
+}
+
+// serveDir serves the index file of the directory name, or its listing.
+// Directories are only served with a trailing slash, so relative links in
+// the index resolve against the directory; other requests are redirected.
+func (fsrv *fileServer) serveDir(w http.ResponseWriter, r *http.Request, name string) {
+
+	// The redirect is relative, as in net/http, so a path such as
+	// "//evil.com" cannot turn it into a redirect to another host. The
+	// Location is set directly, as http.Redirect would make it absolute.
+	if !strings.HasSuffix(r.URL.Path, "/") {
+		target := "./" + path.Base(r.URL.Path) + "/"
+		if r.URL.RawQuery != "" {
+			target += "?" + r.URL.RawQuery
 		}
+		w.Header().Set("Location", target)
+		w.WriteHeader(http.StatusMovedPermanently)
+		return
 	}
+
+	for _, index := range fsrv.opts.IndexFiles {
+
+		indexName := path.Join(name, index)
+
+		f, fi, err := fsrv.open(indexName)
+		if err != nil {
+			continue
+		}
+
+		if fi.IsDir() {
+			f.Close()
+			continue
+		}
+
+		defer f.Close()
+
+		fsrv.serveFile(w, r, indexName, f, fi)
+
+		return
+	}
+
+	if fsrv.opts.DirectoryListing {
+		fsrv.serveListing(w, r, name)
+		return
+	}
+
+	fsrv.notFound(w, r)
+}
+
+func (fsrv *fileServer) serveFallback(w http.ResponseWriter, r *http.Request) {
+
+	name := strings.TrimPrefix(path.Clean("/"+fsrv.opts.SPAFallback), "/")
+
+	f, fi, err := fsrv.open(name)
+	if err != nil || fi.IsDir() {
+		if err == nil {
+			f.Close()
+		}
+		fsrv.notFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	fsrv.serveFile(w, r, name, f, fi)
+}
+
+func (fsrv *fileServer) notFound(w http.ResponseWriter, r *http.Request) {
+	router.WriteError(w, r, router.NewHTTPError(http.StatusNotFound, ""))
+}
+
+// cleanFilePath turns a request path into an fs.FS name. The path is
+// cleaned as if rooted, so ".." can never climb above the root, and names
+// that fs.FS would reject are refused.
+func cleanFilePath(filePath string) (string, bool) {
+
+	if strings.ContainsAny(filePath, "\\\x00") {
+		return "", false
+	}
+
+	name := strings.TrimPrefix(path.Clean("/"+filePath), "/")
+	if name == "" {
+		name = "."
+	}
+
+	return name, fs.ValidPath(name)
+}
+
+// seekableContent returns f as an io.ReadSeeker, reading it into memory if
+// the file system does not support seeking, as with zip archives.
+func seekableContent(f fs.File) (io.ReadSeeker, error) {
+
+	if rs, ok := f.(io.ReadSeeker); ok {
+		return rs, nil
+	}
+
+	b, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.NewReader(b), nil
 }
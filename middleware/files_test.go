@@ -1,9 +1,21 @@
 package middleware
 
 import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/fs"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/ironfang-ltd/go-router"
 )
 
 func TestFiles(t *testing.T) {
@@ -60,3 +72,791 @@ func TestFiles_WithPathOutsideRoot(t *testing.T) {
 		t.Error("response code is not 404, got:", w.Code)
 	}
 }
+
+func serveFiles(t *testing.T, m func(http.HandlerFunc) http.HandlerFunc, method, filePath string, headers map[string]string) *httptest.ResponseRecorder {
+
+	t.Helper()
+
+	req, err := http.NewRequest(method, "/"+filePath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.SetPathValue("filePath", filePath)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	w := httptest.NewRecorder()
+
+	handler := m(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	handler.ServeHTTP(w, req)
+
+	return w
+}
+
+func TestFiles_FS(t *testing.T) {
+
+	fsys := fstest.MapFS{
+		"index.html":    {Data: []byte("<h1>home</h1>")},
+		"css/site.css":  {Data: []byte("body{}")},
+		"assets/app.js": {Data: []byte("console.log(1)")},
+	}
+
+	m := Files(WithFS(fsys))
+
+	tests := []struct {
+		name        string
+		method      string
+		filePath    string
+		status      int
+		contentType string
+		body        string
+	}{
+		{name: "File", method: "GET", filePath: "css/site.css", status: http.StatusOK, contentType: "text/css; charset=utf-8", body: "body{}"},
+		{name: "Head", method: "HEAD", filePath: "assets/app.js", status: http.StatusOK, contentType: "text/javascript; charset=utf-8"},
+		{name: "Missing", method: "GET", filePath: "missing.txt", status: http.StatusNotFound},
+		{name: "Directory", method: "GET", filePath: "css/", status: http.StatusNotFound},
+		{name: "DirectoryRedirect", method: "GET", filePath: "css", status: http.StatusMovedPermanently},
+		{name: "Traversal", method: "GET", filePath: "../../etc/passwd", status: http.StatusNotFound},
+		{name: "TraversalInsideRoot", method: "GET", filePath: "css/../index.html", status: http.StatusOK, body: "<h1>home</h1>"},
+		{name: "Backslash", method: "GET", filePath: "..\\index.html", status: http.StatusNotFound},
+		{name: "OtherMethod", method: "POST", filePath: "index.html", status: http.StatusTeapot},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+
+			w := serveFiles(t, m, tc.method, tc.filePath, nil)
+
+			if w.Code != tc.status {
+				t.Errorf("response code is: %d, expected: %d", w.Code, tc.status)
+			}
+
+			if tc.contentType != "" && w.Header().Get("Content-Type") != tc.contentType {
+				t.Errorf("content type is: %s, expected: %s", w.Header().Get("Content-Type"), tc.contentType)
+			}
+
+			if tc.body != "" && w.Body.String() != tc.body {
+				t.Errorf("response body is: %s, expected: %s", w.Body.String(), tc.body)
+			}
+		})
+	}
+}
+
+func TestFiles_Index(t *testing.T) {
+
+	fsys := fstest.MapFS{
+		"docs/index.html":     {Data: []byte("docs index")},
+		"docs/index.htm":      {Data: []byte("legacy index")},
+		"legacy/index.htm":    {Data: []byte("legacy index")},
+		"nested/index.html/a": {Data: []byte("not an index")},
+	}
+
+	tests := []struct {
+		name     string
+		options  []FilesOption
+		filePath string
+		status   int
+		body     string
+		location string
+	}{
+		{name: "Index", filePath: "docs/", status: http.StatusOK, body: "docs index"},
+		{name: "Redirect", filePath: "docs", status: http.StatusMovedPermanently, location: "./docs/"},
+		{name: "NoIndex", filePath: "legacy/", status: http.StatusNotFound},
+		{name: "IndexIsDirectory", filePath: "nested/", status: http.StatusNotFound},
+		{name: "IndexFiles", options: []FilesOption{WithIndexFiles("index.htm")}, filePath: "legacy/", status: http.StatusOK, body: "legacy index"},
+		{name: "IndexFilesOrder", options: []FilesOption{WithIndexFiles("index.htm", "index.html")}, filePath: "docs/", status: http.StatusOK, body: "legacy index"},
+		{name: "IndexFilesDisabled", options: []FilesOption{WithIndexFiles()}, filePath: "docs/", status: http.StatusNotFound},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+
+			m := Files(append([]FilesOption{WithFS(fsys)}, tc.options...)...)
+			w := serveFiles(t, m, "GET", tc.filePath, nil)
+
+			if w.Code != tc.status {
+				t.Errorf("response code is: %d, expected: %d", w.Code, tc.status)
+			}
+
+			if tc.body != "" && w.Body.String() != tc.body {
+				t.Errorf("response body is: %s, expected: %s", w.Body.String(), tc.body)
+			}
+
+			if tc.location != "" && w.Header().Get("Location") != tc.location {
+				t.Errorf("location is: %s, expected: %s", w.Header().Get("Location"), tc.location)
+			}
+		})
+	}
+}
+
+func TestFiles_SPA(t *testing.T) {
+
+	fsys := fstest.MapFS{
+		"index.html":    {Data: []byte("app shell")},
+		"assets/app.js": {Data: []byte("console.log(1)")},
+	}
+
+	m := Files(WithFS(fsys), WithSPA("index.html"))
+
+	tests := []struct {
+		name     string
+		filePath string
+		status   int
+		body     string
+	}{
+		{name: "Asset", filePath: "assets/app.js", status: http.StatusOK, body: "console.log(1)"},
+		{name: "ClientRoute", filePath: "users/42", status: http.StatusOK, body: "app shell"},
+		{name: "MissingAsset", filePath: "assets/missing.js", status: http.StatusNotFound},
+		{name: "MissingFileWithExtension", filePath: "users/42.json", status: http.StatusNotFound},
+		{name: "Traversal", filePath: "../secret", status: http.StatusOK, body: "app shell"},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+
+			w := serveFiles(t, m, "GET", tc.filePath, nil)
+
+			if w.Code != tc.status {
+				t.Errorf("response code is: %d, expected: %d", w.Code, tc.status)
+			}
+
+			if tc.body != "" && w.Body.String() != tc.body {
+				t.Errorf("response body is: %s, expected: %s", w.Body.String(), tc.body)
+			}
+		})
+	}
+
+	w := serveFiles(t, Files(WithFS(fsys), WithSPA("missing.html")), "GET", "users/42", nil)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("response code is: %d, expected: %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestFiles_DirectoryListing(t *testing.T) {
+
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	fsys := fstest.MapFS{
+		"files/b.txt":            {Data: []byte("bb"), ModTime: modTime},
+		"files/a <script>.txt":   {Data: []byte("a"), ModTime: modTime},
+		"files/sub/c.txt":        {Data: []byte("ccc"), ModTime: modTime},
+		"files/with index/x.txt": {Data: []byte("x"), ModTime: modTime},
+	}
+
+	m := Files(WithFS(fsys), WithDirectoryListing())
+
+	t.Run("JSON", func(t *testing.T) {
+
+		w := serveFiles(t, m, "GET", "files/", map[string]string{"Accept": "application/json"})
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("response code is: %d, expected: %d", w.Code, http.StatusOK)
+		}
+
+		var entries []DirEntry
+		if err := json.Unmarshal(w.Body.Bytes(), &entries); err != nil {
+			t.Fatal(err)
+		}
+
+		expected := []DirEntry{
+			{Name: "sub", ModTime: modTime, IsDir: true},
+			{Name: "with index", ModTime: modTime, IsDir: true},
+			{Name: "a <script>.txt", Size: 1, ModTime: modTime},
+			{Name: "b.txt", Size: 2, ModTime: modTime},
+		}
+
+		if len(entries) != len(expected) {
+			t.Fatalf("entries are: %v, expected: %v", entries, expected)
+		}
+
+		for i := range expected {
+			if entries[i].Name != expected[i].Name || entries[i].Size != expected[i].Size || entries[i].IsDir != expected[i].IsDir {
+				t.Errorf("entry %d is: %v, expected: %v", i, entries[i], expected[i])
+			}
+		}
+
+		if w.Header().Get("Vary") != "Accept" {
+			t.Errorf("vary is: %s, expected: Accept", w.Header().Get("Vary"))
+		}
+	})
+
+	t.Run("HTML", func(t *testing.T) {
+
+		w := serveFiles(t, m, "GET", "files/", map[string]string{"Accept": "text/html"})
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("response code is: %d, expected: %d", w.Code, http.StatusOK)
+		}
+
+		if w.Header().Get("Content-Type") != "text/html; charset=utf-8" {
+			t.Errorf("content type is: %s, expected: text/html; charset=utf-8", w.Header().Get("Content-Type"))
+		}
+
+		body := w.Body.String()
+
+		for _, expected := range []string{`href="./sub/"`, `href="./with%20index/"`, "a &lt;script&gt;.txt", `href="./b.txt"`} {
+			if !strings.Contains(body, expected) {
+				t.Errorf("response body does not contain %s: %s", expected, body)
+			}
+		}
+
+		if strings.Contains(body, "<script>") {
+			t.Errorf("response body is not escaped: %s", body)
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+
+		w := serveFiles(t, Files(WithFS(fsys)), "GET", "files/", nil)
+
+		if w.Code != http.StatusNotFound {
+			t.Errorf("response code is: %d, expected: %d", w.Code, http.StatusNotFound)
+		}
+	})
+}
+
+func TestStatic(t *testing.T) {
+
+	fsys := fstest.MapFS{
+		"index.html":      {Data: []byte("home")},
+		"css/site.css":    {Data: []byte("body{}")},
+		"docs/index.html": {Data: []byte("docs")},
+	}
+
+	r := router.New()
+	r.Static("/assets", FileServer(WithFS(fsys), WithIndexFiles("index.html")))
+	r.Get("/api/users", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		status int
+		body   string
+	}{
+		{name: "File", method: "GET", path: "/assets/css/site.css", status: http.StatusOK, body: "body{}"},
+		{name: "Head", method: "HEAD", path: "/assets/css/site.css", status: http.StatusOK},
+		{name: "Root", method: "GET", path: "/assets/", status: http.StatusOK, body: "home"},
+		{name: "RootRedirect", method: "GET", path: "/assets", status: http.StatusMovedPermanently},
+		{name: "NestedIndex", method: "GET", path: "/assets/docs/", status: http.StatusOK, body: "docs"},
+		{name: "Missing", method: "GET", path: "/assets/missing.css", status: http.StatusNotFound},
+		{name: "Post", method: "POST", path: "/assets/css/site.css", status: http.StatusMethodNotAllowed},
+		{name: "OtherRoute", method: "GET", path: "/api/users", status: http.StatusNoContent},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, req)
+
+			if w.Code != tc.status {
+				t.Errorf("response code is: %d, expected: %d", w.Code, tc.status)
+			}
+
+			if tc.body != "" && w.Body.String() != tc.body {
+				t.Errorf("response body is: %s, expected: %s", w.Body.String(), tc.body)
+			}
+		})
+	}
+}
+
+func TestFileServer_RedirectStaysOnHost(t *testing.T) {
+
+	fsys := fstest.MapFS{
+		"evil.com/index.html": {Data: []byte("evil")},
+	}
+
+	r := router.New()
+	r.Static("/", FileServer(WithFS(fsys)))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.URL.Path = "//evil.com"
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusMovedPermanently {
+		t.Fatalf("response code is: %d, expected: %d", w.Code, http.StatusMovedPermanently)
+	}
+
+	if w.Header().Get("Location") != "./evil.com/" {
+		t.Errorf("location is: %s, expected: %s", w.Header().Get("Location"), "./evil.com/")
+	}
+}
+
+func TestFiles_Precompressed(t *testing.T) {
+
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	fsys := fstest.MapFS{
+		"app.js":      {Data: []byte("plain js"), ModTime: modTime},
+		"app.js.br":   {Data: []byte("brotli js"), ModTime: modTime},
+		"app.js.gz":   {Data: []byte("gzip js"), ModTime: modTime},
+		"site.css":    {Data: []byte("plain css"), ModTime: modTime},
+		"site.css.gz": {Data: []byte("gzip css"), ModTime: modTime},
+		"README":      {Data: []byte("plain readme"), ModTime: modTime},
+		"README.gz":   {Data: []byte("gzip readme"), ModTime: modTime},
+	}
+
+	tests := []struct {
+		name          string
+		options       []FilesOption
+		filePath      string
+		headers       map[string]string
+		status        int
+		body          string
+		contentType   string
+		contentEncode string
+		vary          string
+		contentRange  string
+	}{
+		{name: "Brotli", filePath: "app.js", headers: map[string]string{"Accept-Encoding": "gzip, br"}, status: http.StatusOK, body: "brotli js", contentType: "text/javascript; charset=utf-8", contentEncode: "br", vary: "Accept-Encoding"},
+		{name: "Gzip", filePath: "app.js", headers: map[string]string{"Accept-Encoding": "gzip"}, status: http.StatusOK, body: "gzip js", contentType: "text/javascript; charset=utf-8", contentEncode: "gzip", vary: "Accept-Encoding"},
+		{name: "Quality", filePath: "app.js", headers: map[string]string{"Accept-Encoding": "br;q=0.5, gzip"}, status: http.StatusOK, body: "gzip js", contentEncode: "gzip"},
+		{name: "Rejected", filePath: "app.js", headers: map[string]string{"Accept-Encoding": "br;q=0, gzip;q=0"}, status: http.StatusOK, body: "plain js", vary: "Accept-Encoding"},
+		{name: "Wildcard", filePath: "app.js", headers: map[string]string{"Accept-Encoding": "*"}, status: http.StatusOK, body: "brotli js", contentEncode: "br"},
+		{name: "MissingVariant", filePath: "site.css", headers: map[string]string{"Accept-Encoding": "br"}, status: http.StatusOK, body: "plain css", contentType: "text/css; charset=utf-8", vary: "Accept-Encoding"},
+		{name: "FallbackVariant", filePath: "site.css", headers: map[string]string{"Accept-Encoding": "br, gzip"}, status: http.StatusOK, body: "gzip css", contentType: "text/css; charset=utf-8", contentEncode: "gzip"},
+		{name: "NoAcceptEncoding", filePath: "app.js", status: http.StatusOK, body: "plain js", vary: "Accept-Encoding"},
+		{name: "UnknownType", filePath: "README", headers: map[string]string{"Accept-Encoding": "gzip"}, status: http.StatusOK, body: "plain readme"},
+		{name: "Disabled", options: []FilesOption{WithPrecompressed()}, filePath: "app.js", headers: map[string]string{"Accept-Encoding": "br"}, status: http.StatusOK, body: "plain js"},
+		{name: "Preference", options: []FilesOption{WithPrecompressed("gzip", "br")}, filePath: "app.js", headers: map[string]string{"Accept-Encoding": "br, gzip"}, status: http.StatusOK, body: "gzip js", contentEncode: "gzip"},
+		{name: "Range", filePath: "app.js", headers: map[string]string{"Accept-Encoding": "br", "Range": "bytes=0-5"}, status: http.StatusPartialContent, body: "brotli", contentEncode: "br", contentRange: "bytes 0-5/9"},
+		{name: "NotModified", filePath: "app.js", headers: map[string]string{"Accept-Encoding": "br", "If-Modified-Since": modTime.Format(http.TimeFormat)}, status: http.StatusNotModified},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+
+			m := Files(append([]FilesOption{WithFS(fsys)}, tc.options...)...)
+			w := serveFiles(t, m, "GET", tc.filePath, tc.headers)
+
+			if w.Code != tc.status {
+				t.Errorf("response code is: %d, expected: %d", w.Code, tc.status)
+			}
+
+			if w.Body.String() != tc.body {
+				t.Errorf("response body is: %s, expected: %s", w.Body.String(), tc.body)
+			}
+
+			if tc.contentType != "" && w.Header().Get("Content-Type") != tc.contentType {
+				t.Errorf("content type is: %s, expected: %s", w.Header().Get("Content-Type"), tc.contentType)
+			}
+
+			if w.Code != http.StatusNotModified && w.Header().Get("Content-Encoding") != tc.contentEncode {
+				t.Errorf("content encoding is: %s, expected: %s", w.Header().Get("Content-Encoding"), tc.contentEncode)
+			}
+
+			if tc.vary != "" && w.Header().Get("Vary") != tc.vary {
+				t.Errorf("vary is: %s, expected: %s", w.Header().Get("Vary"), tc.vary)
+			}
+
+			if tc.contentRange != "" && w.Header().Get("Content-Range") != tc.contentRange {
+				t.Errorf("content range is: %s, expected: %s", w.Header().Get("Content-Range"), tc.contentRange)
+			}
+		})
+	}
+}
+
+func TestFiles_CacheControl(t *testing.T) {
+
+	fsys := fstest.MapFS{
+		"index.html":              {Data: []byte("home")},
+		"assets/app.3f9a2c.js":    {Data: []byte("hashed")},
+		"assets/app.3f9a2c.js.br": {Data: []byte("hashed br")},
+		"assets/app.js":           {Data: []byte("unhashed")},
+		"fonts/inter.woff2":       {Data: []byte("font")},
+	}
+
+	handler := FileServer(WithFS(fsys), WithCacheControl(append(DefaultCacheRules(),
+		CacheByPattern("fonts/*", "public, max-age=86400"),
+	)...))
+
+	tests := []struct {
+		name         string
+		filePath     string
+		headers      map[string]string
+		cacheControl string
+	}{
+		{name: "Fingerprinted", filePath: "assets/app.3f9a2c.js", cacheControl: CacheControlImmutable},
+		{name: "FingerprintedPrecompressed", filePath: "assets/app.3f9a2c.js", headers: map[string]string{"Accept-Encoding": "br"}, cacheControl: CacheControlImmutable},
+		{name: "HTML", filePath: "index.html", cacheControl: CacheControlNoCache},
+		{name: "Index", filePath: "", cacheControl: CacheControlNoCache},
+		{name: "Pattern", filePath: "fonts/inter.woff2", cacheControl: "public, max-age=86400"},
+		{name: "NoRule", filePath: "assets/app.js"},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+
+			req := httptest.NewRequest("GET", "/"+tc.filePath, nil)
+			req.SetPathValue("filePath", tc.filePath)
+			for name, value := range tc.headers {
+				req.Header.Set(name, value)
+			}
+
+			w := httptest.NewRecorder()
+			handler(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Errorf("response code is: %d, expected: %d", w.Code, http.StatusOK)
+			}
+
+			if w.Header().Get("Cache-Control") != tc.cacheControl {
+				t.Errorf("cache control is: %s, expected: %s", w.Header().Get("Cache-Control"), tc.cacheControl)
+			}
+		})
+	}
+
+	req := httptest.NewRequest("GET", "/missing.js", nil)
+	req.SetPathValue("filePath", "missing.js")
+
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	if w.Header().Get("Cache-Control") != "" {
+		t.Errorf("cache control is: %s, expected none for a 404", w.Header().Get("Cache-Control"))
+	}
+}
+
+func TestIsFingerprinted(t *testing.T) {
+
+	tests := map[string]bool{
+		"app.3f9a2c.js":          true,
+		"assets/app-B2xk9aQ1.js": true,
+		"chunk.0123456789ab.css": true,
+		"app.12345678.js":        true,
+		"app.deadbeef.js":        true,
+		"app-3f9a2c1b.js":        true,
+		"app.js":                 false,
+		"app-settings.js":        false,
+		"app.facade.js":          false,
+		"app.3f9a.js":            false,
+		"3f9a2c1d.js":            false,
+		"jquery-3.7.1.min.js":    false,
+		"invoice-123456.pdf":     false,
+		"backup-20240101.zip":    false,
+	}
+
+	for name, expected := range tests {
+		if IsFingerprinted(name) != expected {
+			t.Errorf("IsFingerprinted(%q) is: %t, expected: %t", name, !expected, expected)
+		}
+	}
+}
+
+func TestFiles_ETags(t *testing.T) {
+
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	fsys := fstest.MapFS{
+		"app.js":    {Data: []byte("plain js"), ModTime: modTime},
+		"app.js.br": {Data: []byte("brotli js"), ModTime: modTime},
+		"copy.js":   {Data: []byte("plain js"), ModTime: modTime},
+	}
+
+	m := Files(WithFS(fsys), WithETags())
+
+	w := serveFiles(t, m, "GET", "app.js", nil)
+
+	etag := w.Header().Get("ETag")
+	if !strings.HasPrefix(etag, `"`) || !strings.HasSuffix(etag, `"`) || len(etag) < 3 {
+		t.Fatalf("etag is not a strong etag: %s", etag)
+	}
+
+	if w.Body.String() != "plain js" {
+		t.Errorf("response body is: %s, expected: %s", w.Body.String(), "plain js")
+	}
+
+	if copied := serveFiles(t, m, "GET", "copy.js", nil).Header().Get("ETag"); copied != etag {
+		t.Errorf("etag of identical content is: %s, expected: %s", copied, etag)
+	}
+
+	if br := serveFiles(t, m, "GET", "app.js", map[string]string{"Accept-Encoding": "br"}).Header().Get("ETag"); br == etag || br == "" {
+		t.Errorf("etag of the brotli variant is: %s, expected a different etag than: %s", br, etag)
+	}
+
+	w = serveFiles(t, m, "GET", "app.js", map[string]string{"If-None-Match": etag})
+	if w.Code != http.StatusNotModified {
+		t.Errorf("response code is: %d, expected: %d", w.Code, http.StatusNotModified)
+	}
+
+	w = serveFiles(t, m, "GET", "app.js", map[string]string{"Range": "bytes=0-4", "If-Range": etag})
+	if w.Code != http.StatusPartialContent {
+		t.Errorf("response code is: %d, expected: %d", w.Code, http.StatusPartialContent)
+	}
+
+	fsys["app.js"] = &fstest.MapFile{Data: []byte("changed js"), ModTime: modTime.Add(time.Second)}
+
+	w = serveFiles(t, m, "GET", "app.js", map[string]string{"If-None-Match": etag})
+	if w.Code != http.StatusOK {
+		t.Errorf("response code is: %d, expected: %d", w.Code, http.StatusOK)
+	}
+
+	if w.Header().Get("ETag") == etag {
+		t.Errorf("etag was not invalidated after the file changed: %s", etag)
+	}
+}
+
+func TestFiles_AccessPolicy(t *testing.T) {
+
+	fsys := fstest.MapFS{
+		"index.html":               {Data: []byte("app shell")},
+		".env":                     {Data: []byte("SECRET=1")},
+		".git/config":              {Data: []byte("[core]")},
+		".well-known/security.txt": {Data: []byte("contact")},
+		".well-known/.htaccess":    {Data: []byte("deny")},
+		"assets/.well-known/x.txt": {Data: []byte("nested")},
+		"app.js":                   {Data: []byte("app")},
+		"app.js.map":               {Data: []byte("map")},
+		"large.bin":                {Data: bytes.Repeat([]byte("x"), 100)},
+	}
+
+	tests := []struct {
+		name     string
+		options  []FilesOption
+		filePath string
+		status   int
+		body     string
+	}{
+		{name: "DotfileDenied", filePath: ".env", status: http.StatusNotFound},
+		{name: "DotDirectoryDenied", filePath: ".git/config", status: http.StatusNotFound},
+		{name: "DotfileDeniedSkipsFallback", options: []FilesOption{WithSPA("index.html")}, filePath: ".git/config", status: http.StatusNotFound},
+		{name: "DotfileIgnored", options: []FilesOption{WithDotfiles(DotfilesIgnore), WithSPA("index.html")}, filePath: ".git/config", status: http.StatusOK, body: "app shell"},
+		{name: "WellKnownServed", filePath: ".well-known/security.txt", status: http.StatusOK, body: "contact"},
+		{name: "WellKnownDotfileDenied", filePath: ".well-known/.htaccess", status: http.StatusNotFound},
+		{name: "NestedWellKnownDenied", filePath: "assets/.well-known/x.txt", status: http.StatusNotFound},
+		{name: "DotfileAllowed", options: []FilesOption{WithDotfiles(DotfilesAllow)}, filePath: ".well-known/security.txt", status: http.StatusOK, body: "contact"},
+		{name: "ExtensionDenied", options: []FilesOption{WithDeniedExtensions(".map")}, filePath: "app.js.map", status: http.StatusNotFound},
+		{name: "ExtensionNotDenied", options: []FilesOption{WithDeniedExtensions(".map")}, filePath: "app.js", status: http.StatusOK, body: "app"},
+		{name: "ExtensionAllowed", options: []FilesOption{WithAllowedExtensions(".JS", ".html")}, filePath: "app.js", status: http.StatusOK, body: "app"},
+		{name: "ExtensionNotAllowed", options: []FilesOption{WithAllowedExtensions(".js", ".html")}, filePath: "large.bin", status: http.StatusNotFound},
+		{name: "ExtensionNotAllowedIndex", options: []FilesOption{WithAllowedExtensions(".js")}, filePath: "", status: http.StatusNotFound},
+		{name: "TooLarge", options: []FilesOption{WithMaxFileSize(99)}, filePath: "large.bin", status: http.StatusNotFound},
+		{name: "MaxSize", options: []FilesOption{WithMaxFileSize(100)}, filePath: "large.bin", status: http.StatusOK},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+
+			req := httptest.NewRequest("GET", "/"+tc.filePath, nil)
+			req.SetPathValue("filePath", tc.filePath)
+
+			w := httptest.NewRecorder()
+			FileServer(append([]FilesOption{WithFS(fsys)}, tc.options...)...)(w, req)
+
+			if w.Code != tc.status {
+				t.Errorf("response code is: %d, expected: %d", w.Code, tc.status)
+			}
+
+			if tc.body != "" && w.Body.String() != tc.body {
+				t.Errorf("response body is: %s, expected: %s", w.Body.String(), tc.body)
+			}
+		})
+	}
+
+	t.Run("Listing", func(t *testing.T) {
+
+		m := Files(WithFS(fsys), WithIndexFiles(), WithDirectoryListing(), WithDeniedExtensions(".map"))
+		w := serveFiles(t, m, "GET", "./", map[string]string{"Accept": "application/json"})
+
+		var entries []DirEntry
+		if err := json.Unmarshal(w.Body.Bytes(), &entries); err != nil {
+			t.Fatal(err)
+		}
+
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name)
+		}
+
+		if strings.Join(names, ",") != ".well-known,assets,app.js,index.html,large.bin" {
+			t.Errorf("listed entries are: %v, expected: [.well-known assets app.js index.html large.bin]", names)
+		}
+	})
+}
+
+func TestFiles_Symlinks(t *testing.T) {
+
+	outside := t.TempDir()
+	root := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "real.txt"), []byte("real"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(root, "real.txt"), filepath.Join(root, "inside.txt")); err != nil {
+		t.Skip("symlinks are not supported:", err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "escape")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		policy   []FilesOption
+		filePath string
+		status   int
+	}{
+		{name: "ConfineInside", filePath: "inside.txt", status: http.StatusOK},
+		{name: "ConfineEscape", filePath: "escape/secret.txt", status: http.StatusNotFound},
+		{name: "DenyInside", policy: []FilesOption{WithSymlinks(SymlinksDeny)}, filePath: "inside.txt", status: http.StatusNotFound},
+		{name: "DenyRegular", policy: []FilesOption{WithSymlinks(SymlinksDeny)}, filePath: "real.txt", status: http.StatusOK},
+		{name: "FollowEscape", policy: []FilesOption{WithSymlinks(SymlinksFollow)}, filePath: "escape/secret.txt", status: http.StatusOK},
+		{name: "CachedConfineInside", policy: []FilesOption{WithMemoryCache(1024)}, filePath: "inside.txt", status: http.StatusOK},
+		{name: "CachedConfineEscape", policy: []FilesOption{WithMemoryCache(1024)}, filePath: "escape/secret.txt", status: http.StatusNotFound},
+		{name: "CachedDenyInside", policy: []FilesOption{WithMemoryCache(1024), WithSymlinks(SymlinksDeny)}, filePath: "inside.txt", status: http.StatusNotFound},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+
+			m := Files(append([]FilesOption{WithDirectory(root)}, tc.policy...)...)
+
+			// The second request is answered from the memory cache, if any.
+			for j := 0; j < 2; j++ {
+				w := serveFiles(t, m, "GET", tc.filePath, nil)
+
+				if w.Code != tc.status {
+					t.Errorf("response code is: %d, expected: %d", w.Code, tc.status)
+				}
+			}
+		})
+	}
+}
+
+func TestFiles_SymlinksWithFS(t *testing.T) {
+
+	dir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		options []FilesOption
+		panics  bool
+	}{
+		{name: "Confine", options: []FilesOption{WithFS(os.DirFS(dir)), WithSymlinks(SymlinksConfine)}, panics: true},
+		{name: "Deny", options: []FilesOption{WithSymlinks(SymlinksDeny), WithFS(os.DirFS(dir))}, panics: true},
+		{name: "Follow", options: []FilesOption{WithFS(os.DirFS(dir)), WithSymlinks(SymlinksFollow)}},
+		{name: "Default", options: []FilesOption{WithFS(os.DirFS(dir))}},
+		{name: "Directory", options: []FilesOption{WithFS(os.DirFS(dir)), WithSymlinks(SymlinksDeny), WithDirectory(dir)}},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+
+			defer func() {
+				if panicked := recover() != nil; panicked != tc.panics {
+					t.Errorf("panicked: %t, expected: %t", panicked, tc.panics)
+				}
+			}()
+
+			FileServer(tc.options...)
+		})
+	}
+}
+
+func TestFiles_ZipFS(t *testing.T) {
+
+	var buf bytes.Buffer
+
+	zw := zip.NewWriter(&buf)
+	fw, err := zw.Create("docs/readme.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = fw.Write([]byte("zipped readme"))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := serveFiles(t, Files(WithFS(zr)), "GET", "docs/readme.txt", map[string]string{"Range": "bytes=0-5"})
+
+	if w.Code != http.StatusPartialContent {
+		t.Errorf("response code is: %d, expected: %d", w.Code, http.StatusPartialContent)
+	}
+
+	if w.Body.String() != "zipped" {
+		t.Errorf("response body is: %s, expected: %s", w.Body.String(), "zipped")
+	}
+}
+
+func TestOverlay(t *testing.T) {
+
+	overrides := fstest.MapFS{
+		"logo.svg":     {Data: []byte("custom logo")},
+		"css/site.css": {Data: []byte("custom css")},
+	}
+
+	defaults := fstest.MapFS{
+		"logo.svg":     {Data: []byte("default logo")},
+		"index.html":   {Data: []byte("default index")},
+		"css/base.css": {Data: []byte("base css")},
+	}
+
+	fsys := Overlay(overrides, defaults)
+
+	for name, expected := range map[string]string{
+		"logo.svg":     "custom logo",
+		"index.html":   "default index",
+		"css/site.css": "custom css",
+		"css/base.css": "base css",
+	} {
+		b, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			t.Errorf("reading %s: %v", name, err)
+			continue
+		}
+		if string(b) != expected {
+			t.Errorf("%s is: %s, expected: %s", name, string(b), expected)
+		}
+	}
+
+	if _, err := fsys.Open("missing.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("open error is: %v, expected: %v", err, fs.ErrNotExist)
+	}
+
+	if err := fstest.TestFS(fsys, "logo.svg", "index.html", "css/site.css", "css/base.css"); err != nil {
+		t.Error(err)
+	}
+
+	w := serveFiles(t, Files(WithFS(fsys)), "GET", "logo.svg", nil)
+
+	if w.Body.String() != "custom logo" {
+		t.Errorf("response body is: %s, expected: %s", w.Body.String(), "custom logo")
+	}
+}
@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"encoding/json"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/ironfang-ltd/go-router"
+)
+
+// DirEntry describes a file in a directory listing.
+type DirEntry struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	IsDir   bool      `json:"isDir"`
+}
+
+var listingTemplate = template.Must(template.New("listing").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Index of {{.Path}}</title></head>
+<body>
+<h1>Index of {{.Path}}</h1>
+<ul>
+{{range .Entries}}<li><a href="{{.Href}}">{{.Name}}{{if .IsDir}}/{{end}}</a></li>
+{{end}}</ul>
+</body>
+</html>
+`))
+
+type listingEntry struct {
+	DirEntry
+	Href string
+}
+
+// serveListing writes the entries of the directory name, directories first
+// and then by name.
+func (fsrv *fileServer) serveListing(w http.ResponseWriter, r *http.Request, name string) {
+
+	dirEntries, err := fs.ReadDir(fsrv.fsys, name)
+	if err != nil {
+		router.WriteError(w, r, err)
+		return
+	}
+
+	entries := make([]DirEntry, 0, len(dirEntries))
+
+	for _, de := range dirEntries {
+
+		fi, err := de.Info()
+		if err != nil || !fsrv.listable(path.Join(name, de.Name()), fi) {
+			continue
+		}
+
+		entry := DirEntry{
+			Name:    de.Name(),
+			ModTime: fi.ModTime().UTC(),
+			IsDir:   de.IsDir(),
+		}
+
+		if !entry.IsDir {
+			entry.Size = fi.Size()
+		}
+
+		entries = append(entries, entry)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].IsDir != entries[j].IsDir {
+			return entries[i].IsDir
+		}
+		return entries[i].Name < entries[j].Name
+	})
+
+	w.Header().Add("Vary", "Accept")
+
+	switch router.Negotiate(r, router.MIMETextHTML, router.MIMEApplicationJSON) {
+	case router.MIMEApplicationJSON:
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(entries)
+	case router.MIMETextHTML:
+		data := struct {
+			Path    string
+			Entries []listingEntry
+		}{
+			Path:    r.URL.Path,
+			Entries: make([]listingEntry, len(entries)),
+		}
+
+		for i, entry := range entries {
+			href := (&url.URL{Path: entry.Name}).EscapedPath()
+			if entry.IsDir {
+				href += "/"
+			}
+			data.Entries[i] = listingEntry{DirEntry: entry, Href: "./" + href}
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_ = listingTemplate.Execute(w, data)
+	default:
+		router.WriteError(w, r, router.NewHTTPError(http.StatusNotAcceptable, ""))
+	}
+}
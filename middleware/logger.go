@@ -0,0 +1,434 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ironfang-ltd/go-router"
+)
+
+// LogFormat selects how Logger writes requests.
+type LogFormat int
+
+const (
+	// LogFormatStructured writes a record with one attribute per field
+	// through the configured slog.Logger.
+	LogFormatStructured LogFormat = iota
+	// LogFormatJSON writes the structured record as a JSON line to the
+	// configured output.
+	LogFormatJSON
+	// LogFormatCommon writes a line in the Common Log Format to the
+	// configured output.
+	LogFormatCommon
+	// LogFormatCombined writes a line in the Combined Log Format, which adds
+	// the referer and user agent to the Common Log Format.
+	LogFormatCombined
+)
+
+const (
+	// LogSampleKey is the route metadata key of the fraction of requests to
+	// a route that are logged, a float64 between 0 and 1.
+	LogSampleKey = "log.sample"
+
+	// LogSkipKey is the route metadata key that turns logging off for a
+	// route when set to true.
+	LogSkipKey = "log.skip"
+
+	redacted = "REDACTED"
+)
+
+type LoggerOption func(*LoggerOptions)
+
+type LoggerOptions struct {
+	Logger          *slog.Logger
+	Output          io.Writer
+	Format          LogFormat
+	SampleRate      float64
+	Skip            func(r *http.Request) bool
+	RedactQuery     []string
+	Headers         []string
+	RedactHeaders   []string
+	RequestIDHeader string
+}
+
+// WithLogger sets the logger of LogFormatStructured. The default is
+// slog.Default().
+func WithLogger(logger *slog.Logger) func(*LoggerOptions) {
+	return func(opts *LoggerOptions) {
+		opts.Logger = logger
+	}
+}
+
+// WithLogFormat sets the log format. The default is LogFormatStructured.
+func WithLogFormat(format LogFormat) func(*LoggerOptions) {
+	return func(opts *LoggerOptions) {
+		opts.Format = format
+	}
+}
+
+// WithLogOutput sets where the JSON, Common and Combined formats are
+// written. The default is os.Stdout.
+func WithLogOutput(w io.Writer) func(*LoggerOptions) {
+	return func(opts *LoggerOptions) {
+		opts.Output = w
+	}
+}
+
+// WithLogSampleRate logs only the given fraction of requests, client
+// errors included, so a flood of 4xx responses is sampled too. Requests
+// answered with a 5xx status are always logged. Routes can override the
+// rate with the LogSampleKey metadata.
+func WithLogSampleRate(rate float64) func(*LoggerOptions) {
+	return func(opts *LoggerOptions) {
+		opts.SampleRate = rate
+	}
+}
+
+// WithLogSkip does not log requests for which skip returns true.
+func WithLogSkip(skip func(r *http.Request) bool) func(*LoggerOptions) {
+	return func(opts *LoggerOptions) {
+		opts.Skip = skip
+	}
+}
+
+// WithLogSkipPaths does not log requests for the given paths, such as
+// health checks.
+func WithLogSkipPaths(paths ...string) func(*LoggerOptions) {
+	return WithLogSkip(func(r *http.Request) bool {
+		for _, p := range paths {
+			if r.URL.Path == p {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// WithLogRedactQuery replaces the values of the given query parameters,
+// such as tokens, in the logged query.
+func WithLogRedactQuery(params ...string) func(*LoggerOptions) {
+	return func(opts *LoggerOptions) {
+		opts.RedactQuery = params
+	}
+}
+
+// WithLogHeaders logs the given request headers in a "headers" group of
+// structured records.
+func WithLogHeaders(names ...string) func(*LoggerOptions) {
+	return func(opts *LoggerOptions) {
+		opts.Headers = names
+	}
+}
+
+// WithLogRedactHeaders sets the logged headers whose values are replaced.
+// The default is Authorization, Proxy-Authorization and Cookie.
+func WithLogRedactHeaders(names ...string) func(*LoggerOptions) {
+	return func(opts *LoggerOptions) {
+		opts.RedactHeaders = names
+	}
+}
+
+// WithLogRequestIDHeader sets the header whose value is logged as the
+// request ID when RequestID has not stored one in the request context. The
+// default is DefaultRequestIDHeader.
+func WithLogRequestIDHeader(name string) func(*LoggerOptions) {
+	return func(opts *LoggerOptions) {
+		opts.RequestIDHeader = name
+	}
+}
+
+// Logger writes one access log record per request. Wrap the router with it
+// to log requests that match no route as well:
+//
+//	http.ListenAndServe(":8080", middleware.Logger()(r.ServeHTTP))
+//
+// Added to a group with Use, it only logs requests routed to the group.
+func Logger(options ...LoggerOption) router.Middleware {
+
+	opts := &LoggerOptions{
+		Logger:          slog.Default(),
+		Output:          os.Stdout,
+		Format:          LogFormatStructured,
+		SampleRate:      1,
+		RedactHeaders:   []string{"Authorization", "Proxy-Authorization", "Cookie"},
+		RequestIDHeader: DefaultRequestIDHeader,
+	}
+
+	for _, option := range options {
+		option(opts)
+	}
+
+	// Lines are written with a single call each, under a lock, so they do
+	// not interleave on outputs that are not safe for concurrent use.
+	var mu sync.Mutex
+
+	logger := opts.Logger
+	if opts.Format == LogFormatJSON {
+		logger = slog.New(slog.NewJSONHandler(opts.Output, nil))
+	}
+
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+
+			if opts.Skip != nil && opts.Skip(r) {
+				next(w, r)
+				return
+			}
+
+			start := time.Now()
+
+			r = router.WithRouteContext(r)
+			rw := NewResponseWriter(w)
+
+			next(rw, r)
+
+			route, _ := router.RouteFromContext(r.Context())
+
+			if !opts.sampled(route, rw.Status()) {
+				return
+			}
+
+			entry := accessLogEntry{
+				start:    start,
+				duration: time.Since(start),
+				route:    router.PatternFromContext(r.Context()),
+				status:   rw.Status(),
+				bytes:    rw.BytesWritten(),
+				header:   rw.Header(),
+			}
+
+			switch opts.Format {
+			case LogFormatCommon, LogFormatCombined:
+				line := opts.formatCLF(r, entry)
+				mu.Lock()
+				_, _ = io.WriteString(opts.Output, line)
+				mu.Unlock()
+			default:
+				opts.log(r.Context(), logger, r, entry)
+			}
+		}
+	}
+}
+
+type accessLogEntry struct {
+	start    time.Time
+	duration time.Duration
+	route    string
+	status   int
+	bytes    int64
+	header   http.Header
+}
+
+// sampled reports whether a request is logged, using the sampling and
+// skipping metadata of its route.
+func (opts *LoggerOptions) sampled(route router.RouteDescriptor, status int) bool {
+
+	if skip, _ := route.Meta[LogSkipKey].(bool); skip {
+		return false
+	}
+
+	if status >= http.StatusInternalServerError {
+		return true
+	}
+
+	rate := opts.SampleRate
+	if sample, ok := route.Meta[LogSampleKey].(float64); ok {
+		rate = sample
+	}
+
+	return rate >= 1 || rate > 0 && rand.Float64() < rate
+}
+
+func (opts *LoggerOptions) log(ctx context.Context, logger *slog.Logger, r *http.Request, entry accessLogEntry) {
+
+	level := slog.LevelInfo
+	if entry.status >= http.StatusInternalServerError {
+		level = slog.LevelError
+	}
+
+	if !logger.Enabled(ctx, level) {
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.String("method", r.Method),
+		slog.String("route", entry.route),
+		slog.String("path", r.URL.Path),
+	}
+
+	if query := opts.redactQuery(r.URL.RawQuery); query != "" {
+		attrs = append(attrs, slog.String("query", query))
+	}
+
+	attrs = append(attrs,
+		slog.Int("status", entry.status),
+		slog.Int64("bytes", entry.bytes),
+		slog.Duration("duration", entry.duration),
+		slog.String("remote_ip", remoteIP(r)),
+		slog.String("user_agent", r.UserAgent()),
+	)
+
+	if id := opts.requestID(r, entry.header); id != "" {
+		attrs = append(attrs, slog.String("request_id", id))
+	}
+
+	if len(opts.Headers) > 0 {
+		headers := make([]any, 0, len(opts.Headers))
+		for _, name := range opts.Headers {
+			if value := r.Header.Get(name); value != "" {
+				if containsFold(opts.RedactHeaders, name) {
+					value = redacted
+				}
+				headers = append(headers, slog.String(name, value))
+			}
+		}
+		attrs = append(attrs, slog.Group("headers", headers...))
+	}
+
+	logger.LogAttrs(ctx, level, "request", attrs...)
+}
+
+// formatCLF formats a Common or Combined Log Format line.
+func (opts *LoggerOptions) formatCLF(r *http.Request, entry accessLogEntry) string {
+
+	uri := r.URL.EscapedPath()
+	if query := opts.redactQuery(r.URL.RawQuery); query != "" {
+		uri += "?" + query
+	}
+
+	bytes := "-"
+	if entry.bytes > 0 {
+		bytes = strconv.FormatInt(entry.bytes, 10)
+	}
+
+	var sb strings.Builder
+
+	sb.WriteString(remoteIP(r))
+	sb.WriteString(" - ")
+	if user, _, ok := r.BasicAuth(); ok && user != "" {
+		sb.WriteString(clfEscape(user))
+	} else {
+		sb.WriteString("-")
+	}
+	sb.WriteString(" [")
+	sb.WriteString(entry.start.Format("02/Jan/2006:15:04:05 -0700"))
+	sb.WriteString(`] "`)
+	sb.WriteString(r.Method)
+	sb.WriteString(" ")
+	sb.WriteString(clfEscape(uri))
+	sb.WriteString(" ")
+	sb.WriteString(r.Proto)
+	sb.WriteString(`" `)
+	sb.WriteString(strconv.Itoa(entry.status))
+	sb.WriteString(" ")
+	sb.WriteString(bytes)
+
+	if opts.Format == LogFormatCombined {
+		sb.WriteString(` "`)
+		sb.WriteString(clfQuoted(r.Referer()))
+		sb.WriteString(`" "`)
+		sb.WriteString(clfQuoted(r.UserAgent()))
+		sb.WriteString(`"`)
+	}
+
+	sb.WriteString("\n")
+
+	return sb.String()
+}
+
+// redactQuery replaces the values of the redacted parameters in a raw
+// query, keeping the order of the parameters.
+func (opts *LoggerOptions) redactQuery(rawQuery string) string {
+
+	if rawQuery == "" || len(opts.RedactQuery) == 0 {
+		return rawQuery
+	}
+
+	parts := strings.Split(rawQuery, "&")
+
+	for i, part := range parts {
+		key, _, _ := strings.Cut(part, "=")
+		name, err := url.QueryUnescape(key)
+		if err != nil {
+			name = key
+		}
+		for _, param := range opts.RedactQuery {
+			if name == param {
+				parts[i] = key + "=" + redacted
+				break
+			}
+		}
+	}
+
+	return strings.Join(parts, "&")
+}
+
+// requestID returns the ID given to the request by RequestID. When Logger
+// wraps RequestID the ID is not in the context of r, so it is taken from
+// the response header, and then from the request header.
+func (opts *LoggerOptions) requestID(r *http.Request, header http.Header) string {
+
+	if id := RequestIDFromContext(r.Context()); id != "" {
+		return id
+	}
+
+	if opts.RequestIDHeader == "" {
+		return ""
+	}
+
+	if id := header.Get(opts.RequestIDHeader); id != "" {
+		return id
+	}
+
+	return r.Header.Get(opts.RequestIDHeader)
+}
+
+// remoteIP returns the IP address of the client connection, without the
+// port.
+func remoteIP(r *http.Request) string {
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// clfEscape keeps a value on one line and free of spaces.
+func clfEscape(s string) string {
+	return strings.Map(func(c rune) rune {
+		if c < ' ' || c == 0x7f || c == ' ' || c == '"' {
+			return '_'
+		}
+		return c
+	}, s)
+}
+
+// clfQuoted escapes a value written between double quotes.
+func clfQuoted(s string) string {
+
+	if s == "" {
+		return "-"
+	}
+
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+
+	return strings.Map(func(c rune) rune {
+		if c < ' ' || c == 0x7f {
+			return '_'
+		}
+		return c
+	}, s)
+}
@@ -0,0 +1,207 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/ironfang-ltd/go-router"
+)
+
+func newLoggedRouter(options ...LoggerOption) http.HandlerFunc {
+
+	r := router.New()
+
+	r.Get("/users/:id", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("user"))
+	})
+
+	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}).Meta(LogSkipKey, true)
+
+	r.Get("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}).Meta(LogSampleKey, 0.0)
+
+	r.Get("/fail", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}).Meta(LogSampleKey, 0.0)
+
+	return Logger(options...)(r.ServeHTTP)
+}
+
+func readLogRecords(t *testing.T, buf *bytes.Buffer) []map[string]any {
+
+	t.Helper()
+
+	var records []map[string]any
+
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("invalid log line %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+
+	return records
+}
+
+func TestLogger_Structured(t *testing.T) {
+
+	var buf bytes.Buffer
+
+	handler := newLoggedRouter(
+		WithLogger(slog.New(slog.NewJSONHandler(&buf, nil))),
+		WithLogRedactQuery("token"),
+		WithLogHeaders("Authorization", "X-Tenant"),
+	)
+
+	req := httptest.NewRequest("GET", "/users/7?token=secret&page=2", nil)
+	req.RemoteAddr = "203.0.113.9:51234"
+	req.Header.Set("User-Agent", "test-agent")
+	req.Header.Set("X-Request-Id", "req-1")
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("X-Tenant", "acme")
+
+	handler(httptest.NewRecorder(), req)
+
+	records := readLogRecords(t, &buf)
+	if len(records) != 1 {
+		t.Fatalf("expected 1 record, got: %d", len(records))
+	}
+
+	record := records[0]
+
+	expected := map[string]any{
+		"msg":        "request",
+		"level":      "INFO",
+		"method":     "GET",
+		"route":      "/users/:id",
+		"path":       "/users/7",
+		"query":      "token=REDACTED&page=2",
+		"status":     float64(200),
+		"bytes":      float64(4),
+		"remote_ip":  "203.0.113.9",
+		"user_agent": "test-agent",
+		"request_id": "req-1",
+	}
+
+	for key, value := range expected {
+		if record[key] != value {
+			t.Errorf("%s is: %v, expected: %v", key, record[key], value)
+		}
+	}
+
+	if _, ok := record["duration"]; !ok {
+		t.Error("duration is not logged")
+	}
+
+	headers, _ := record["headers"].(map[string]any)
+	if headers["Authorization"] != "REDACTED" || headers["X-Tenant"] != "acme" {
+		t.Errorf("headers are: %v", headers)
+	}
+
+	if strings.Contains(buf.String(), "secret") {
+		t.Errorf("log contains a redacted value: %s", buf.String())
+	}
+}
+
+func TestLogger_SkipAndSample(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		options []LoggerOption
+		logged  bool
+		level   string
+		status  float64
+		route   string
+	}{
+		{name: "Logged", path: "/users/1", logged: true, level: "INFO", status: 200, route: "/users/:id"},
+		{name: "NotFound", path: "/missing", logged: true, level: "INFO", status: 404, route: ""},
+		{name: "MethodNotAllowed", method: "POST", path: "/users/1", logged: true, level: "INFO", status: 405, route: "/users/:id"},
+		{name: "ClientErrorSampled", path: "/missing", options: []LoggerOption{WithLogSampleRate(0)}, logged: false},
+		{name: "RouteSkip", path: "/health", logged: false},
+		{name: "RouteSample", path: "/metrics", logged: false},
+		{name: "ServerErrorAlwaysLogged", path: "/fail", logged: true, level: "ERROR", status: 500, route: "/fail"},
+		{name: "SkipPaths", path: "/users/1", options: []LoggerOption{WithLogSkipPaths("/users/1")}, logged: false},
+		{name: "SampleRate", path: "/users/1", options: []LoggerOption{WithLogSampleRate(0)}, logged: false},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+
+			var buf bytes.Buffer
+
+			method := tc.method
+			if method == "" {
+				method = "GET"
+			}
+
+			options := append([]LoggerOption{WithLogFormat(LogFormatJSON), WithLogOutput(&buf)}, tc.options...)
+			newLoggedRouter(options...)(httptest.NewRecorder(), httptest.NewRequest(method, tc.path, nil))
+
+			records := readLogRecords(t, &buf)
+
+			if (len(records) == 1) != tc.logged {
+				t.Fatalf("records are: %v, expected logged: %t", records, tc.logged)
+			}
+
+			if !tc.logged {
+				return
+			}
+
+			if records[0]["level"] != tc.level || records[0]["status"] != tc.status || records[0]["route"] != tc.route {
+				t.Errorf("record is: %v, expected level %s, status %v and route %s", records[0], tc.level, tc.status, tc.route)
+			}
+		})
+	}
+}
+
+func TestLogger_CLF(t *testing.T) {
+
+	tests := []struct {
+		format   LogFormat
+		expected string
+	}{
+		{
+			format:   LogFormatCommon,
+			expected: `^192\.0\.2\.1 - alice \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] "GET /users/7\?token=REDACTED HTTP/1\.1" 200 4\n$`,
+		},
+		{
+			format:   LogFormatCombined,
+			expected: `^192\.0\.2\.1 - alice \[[^\]]+\] "GET /users/7\?token=REDACTED HTTP/1\.1" 200 4 "https://example\.com/" "agent \\"quoted\\""\n$`,
+		},
+	}
+
+	for _, tc := range tests {
+
+		var buf bytes.Buffer
+
+		handler := newLoggedRouter(WithLogFormat(tc.format), WithLogOutput(&buf), WithLogRedactQuery("token"))
+
+		req := httptest.NewRequest("GET", "/users/7?token=secret", nil)
+		req.SetBasicAuth("alice", "password")
+		req.Header.Set("Referer", "https://example.com/")
+		req.Header.Set("User-Agent", `agent "quoted"`)
+
+		handler(httptest.NewRecorder(), req)
+
+		if !regexp.MustCompile(tc.expected).MatchString(buf.String()) {
+			t.Errorf("log line is: %q, expected to match: %s", buf.String(), tc.expected)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+)
+
+// Manifest maps logical asset names, such as "js/app.js", to the URLs of
+// their fingerprinted files, such as "/assets/js/app.3f9a2c.js", so
+// templates can link to assets that are cached with CacheControlImmutable.
+type Manifest struct {
+	prefix string
+	assets map[string]string
+}
+
+// NewManifest builds a manifest from the fingerprinted files in fsys,
+// served below the URL prefix. If a directory holds several fingerprints of
+// the same name the most recently modified one is used. Precompressed
+// variants are ignored.
+func NewManifest(fsys fs.FS, prefix string) (*Manifest, error) {
+
+	m := newManifest(prefix)
+	modTimes := make(map[string]time.Time)
+
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+
+		if err != nil || d.IsDir() || isPrecompressedVariant(name) {
+			return err
+		}
+
+		base, hash := splitFingerprint(path.Base(name))
+		if hash == "" {
+			return nil
+		}
+
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		logical := path.Join(path.Dir(name), base)
+
+		if modTime, ok := modTimes[logical]; ok && !fi.ModTime().After(modTime) {
+			return nil
+		}
+
+		modTimes[logical] = fi.ModTime()
+		m.assets[logical] = name
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// LoadManifest reads a manifest written by a frontend build from the JSON
+// file name in fsys. The file maps logical names either to file names, as
+// in {"app.js": "app.3f9a2c.js"}, or to objects with a "file" member, as
+// written by Vite. File names are relative to the root of fsys, which is
+// served below the URL prefix.
+func LoadManifest(fsys fs.FS, name, prefix string) (*Manifest, error) {
+
+	b, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries map[string]json.RawMessage
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return nil, fmt.Errorf("manifest %s: %w", name, err)
+	}
+
+	m := newManifest(prefix)
+
+	for logical, raw := range entries {
+
+		var file string
+
+		if err := json.Unmarshal(raw, &file); err != nil {
+			var entry struct {
+				File string `json:"file"`
+			}
+			if err := json.Unmarshal(raw, &entry); err != nil || entry.File == "" {
+				return nil, fmt.Errorf("manifest %s: invalid entry for %q", name, logical)
+			}
+			file = entry.File
+		}
+
+		m.assets[strings.TrimPrefix(logical, "/")] = strings.TrimPrefix(file, "/")
+	}
+
+	return m, nil
+}
+
+func newManifest(prefix string) *Manifest {
+	return &Manifest{
+		prefix: strings.TrimSuffix(prefix, "/"),
+		assets: make(map[string]string),
+	}
+}
+
+// Lookup returns the URL of the fingerprinted file for the logical name, or
+// false if the manifest has no such asset.
+func (m *Manifest) Lookup(name string) (string, bool) {
+
+	file, ok := m.assets[strings.TrimPrefix(name, "/")]
+	if !ok {
+		return "", false
+	}
+
+	return m.prefix + "/" + file, true
+}
+
+// URL returns the URL of the fingerprinted file for the logical name. Names
+// that are not in the manifest are served unfingerprinted below the prefix.
+func (m *Manifest) URL(name string) string {
+
+	if url, ok := m.Lookup(name); ok {
+		return url
+	}
+
+	return m.prefix + "/" + strings.TrimPrefix(name, "/")
+}
+
+// FuncMap returns template functions for the manifest, with "asset"
+// mapping a logical name to its URL:
+//
+//	<script src="{{asset "js/app.js"}}"></script>
+func (m *Manifest) FuncMap() template.FuncMap {
+	return template.FuncMap{
+		"asset": m.URL,
+	}
+}
+
+func isPrecompressedVariant(name string) bool {
+
+	ext := path.Ext(name)
+
+	for _, e := range precompressedExtensions {
+		if ext == e {
+			return true
+		}
+	}
+
+	return false
+}
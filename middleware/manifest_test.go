@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"bytes"
+	"html/template"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestNewManifest(t *testing.T) {
+
+	old := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	fsys := fstest.MapFS{
+		"js/app.3f9a2c.js":      {Data: []byte("old"), ModTime: old},
+		"js/app.7b1e04.js":      {Data: []byte("new"), ModTime: old.Add(time.Hour)},
+		"js/app.7b1e04.js.br":   {Data: []byte("new br"), ModTime: old.Add(2 * time.Hour)},
+		"css/site-B2xk9aQ1.css": {Data: []byte("css"), ModTime: old},
+		"logo.svg":              {Data: []byte("logo"), ModTime: old},
+	}
+
+	m, err := NewManifest(fsys, "/assets/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]string{
+		"js/app.js":     "/assets/js/app.7b1e04.js",
+		"/css/site.css": "/assets/css/site-B2xk9aQ1.css",
+		"logo.svg":      "/assets/logo.svg",
+	}
+
+	for name, expected := range tests {
+		if url := m.URL(name); url != expected {
+			t.Errorf("URL(%q) is: %s, expected: %s", name, url, expected)
+		}
+	}
+
+	if _, ok := m.Lookup("logo.svg"); ok {
+		t.Error("Lookup found an asset that is not fingerprinted")
+	}
+}
+
+func TestLoadManifest(t *testing.T) {
+
+	fsys := fstest.MapFS{
+		"manifest.json": {Data: []byte(`{
+			"app.js": "js/app.3f9a2c.js",
+			"src/main.ts": {"file": "assets/main-B2xk9aQ1.js", "isEntry": true}
+		}`)},
+		"invalid.json": {Data: []byte(`{"app.js": 42}`)},
+	}
+
+	m, err := LoadManifest(fsys, "manifest.json", "/static")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if url := m.URL("app.js"); url != "/static/js/app.3f9a2c.js" {
+		t.Errorf("URL is: %s, expected: %s", url, "/static/js/app.3f9a2c.js")
+	}
+
+	if url := m.URL("src/main.ts"); url != "/static/assets/main-B2xk9aQ1.js" {
+		t.Errorf("URL is: %s, expected: %s", url, "/static/assets/main-B2xk9aQ1.js")
+	}
+
+	if _, err := LoadManifest(fsys, "invalid.json", "/static"); err == nil {
+		t.Error("expected an error for an invalid manifest entry")
+	}
+
+	tmpl := template.Must(template.New("page").Funcs(m.FuncMap()).Parse(`<script src="{{asset "app.js"}}"></script>`))
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if buf.String() != `<script src="/static/js/app.3f9a2c.js"></script>` {
+		t.Errorf("template output is: %s", buf.String())
+	}
+}
@@ -0,0 +1,410 @@
+package middleware
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ironfang-ltd/go-router"
+)
+
+// DefaultDurationBuckets are the upper bounds, in seconds, of the request
+// duration histogram.
+var DefaultDurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// DefaultSizeBuckets are the upper bounds, in bytes, of the response size
+// histogram.
+var DefaultSizeBuckets = []float64{100, 1000, 10000, 100000, 1e6, 1e7}
+
+// DefaultMetricsRegistry is the registry used by Metrics unless another
+// one is set with WithMetricsRegistry.
+var DefaultMetricsRegistry = NewMetricsRegistry()
+
+type MetricsOption func(*MetricsOptions)
+
+type MetricsOptions struct {
+	Registry        *MetricsRegistry
+	Namespace       string
+	DurationBuckets []float64
+	SizeBuckets     []float64
+}
+
+// WithMetricsRegistry sets the registry the metrics are recorded in.
+func WithMetricsRegistry(registry *MetricsRegistry) func(*MetricsOptions) {
+	return func(opts *MetricsOptions) {
+		opts.Registry = registry
+	}
+}
+
+// WithMetricsNamespace prefixes the metric names with namespace and an
+// underscore.
+func WithMetricsNamespace(namespace string) func(*MetricsOptions) {
+	return func(opts *MetricsOptions) {
+		opts.Namespace = namespace
+	}
+}
+
+// WithDurationBuckets sets the buckets of the request duration histogram.
+func WithDurationBuckets(buckets ...float64) func(*MetricsOptions) {
+	return func(opts *MetricsOptions) {
+		opts.DurationBuckets = buckets
+	}
+}
+
+// WithSizeBuckets sets the buckets of the response size histogram.
+func WithSizeBuckets(buckets ...float64) func(*MetricsOptions) {
+	return func(opts *MetricsOptions) {
+		opts.SizeBuckets = buckets
+	}
+}
+
+// Metrics records the requests it serves in a MetricsRegistry:
+//
+//   - http_requests_total, a counter
+//   - http_requests_in_flight, a gauge labeled by method only
+//   - http_request_duration_seconds, a histogram
+//   - http_response_size_bytes, a histogram
+//
+// Requests are labeled by method, route pattern and status class, such as
+// "2xx", so the number of series does not grow with the paths requested.
+// Wrap the router with it, using router.WithRouteContext, to count
+// requests that match no route, which are labeled with an empty route.
+func Metrics(options ...MetricsOption) router.Middleware {
+
+	opts := &MetricsOptions{
+		Registry:        DefaultMetricsRegistry,
+		DurationBuckets: DefaultDurationBuckets,
+		SizeBuckets:     DefaultSizeBuckets,
+	}
+
+	for _, option := range options {
+		option(opts)
+	}
+
+	prefix := ""
+	if opts.Namespace != "" {
+		prefix = opts.Namespace + "_"
+	}
+
+	requests := opts.Registry.family(prefix+"http_requests_total", "Total number of HTTP requests.", metricCounter, nil)
+	inFlight := opts.Registry.family(prefix+"http_requests_in_flight", "Number of HTTP requests being served.", metricGauge, nil)
+	durations := opts.Registry.family(prefix+"http_request_duration_seconds", "Duration of HTTP requests in seconds.", metricHistogram, opts.DurationBuckets)
+	sizes := opts.Registry.family(prefix+"http_response_size_bytes", "Size of HTTP response bodies in bytes.", metricHistogram, opts.SizeBuckets)
+
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+
+			start := time.Now()
+			method := metricMethod(r.Method)
+
+			inFlight.add([]string{"method", method}, 1)
+			defer inFlight.add([]string{"method", method}, -1)
+
+			r = router.WithRouteContext(r)
+			rw := NewResponseWriter(w)
+
+			next(rw, r)
+
+			labels := []string{
+				"method", method,
+				"route", router.PatternFromContext(r.Context()),
+				"status", statusClass(rw.Status()),
+			}
+
+			requests.add(labels, 1)
+			durations.observe(labels, time.Since(start).Seconds())
+			sizes.observe(labels, float64(rw.BytesWritten()))
+		}
+	}
+}
+
+// metricMethod bounds the method label to the standard methods.
+func metricMethod(method string) string {
+
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+
+	return "OTHER"
+}
+
+func statusClass(status int) string {
+
+	if status < 100 || status > 599 {
+		return "unknown"
+	}
+
+	return strconv.Itoa(status/100) + "xx"
+}
+
+type metricType string
+
+const (
+	metricCounter   metricType = "counter"
+	metricGauge     metricType = "gauge"
+	metricHistogram metricType = "histogram"
+)
+
+// MetricsRegistry holds metrics and writes them in the Prometheus text
+// exposition format.
+type MetricsRegistry struct {
+	mu       sync.Mutex
+	families map[string]*metricFamily
+}
+
+func NewMetricsRegistry() *MetricsRegistry {
+	return &MetricsRegistry{
+		families: make(map[string]*metricFamily),
+	}
+}
+
+// family returns the metric family name, creating it on first use, so
+// several Metrics middleware can share a registry.
+func (reg *MetricsRegistry) family(name, help string, typ metricType, buckets []float64) *metricFamily {
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	if f, ok := reg.families[name]; ok {
+		if f.typ != typ {
+			panic("metric " + name + " is already registered as a " + string(f.typ))
+		}
+		return f
+	}
+
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+
+	f := &metricFamily{
+		name:    name,
+		help:    help,
+		typ:     typ,
+		buckets: sorted,
+		series:  make(map[string]*metricSeries),
+	}
+
+	reg.families[name] = f
+
+	return f
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format, so
+// the registry can be mounted on a router:
+//
+//	r.Get("/metrics", middleware.DefaultMetricsRegistry.ServeHTTP)
+func (reg *MetricsRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = reg.WriteTo(w)
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format,
+// sorted by name and labels.
+func (reg *MetricsRegistry) WriteTo(w io.Writer) (int64, error) {
+
+	reg.mu.Lock()
+	families := make([]*metricFamily, 0, len(reg.families))
+	for _, f := range reg.families {
+		families = append(families, f)
+	}
+	reg.mu.Unlock()
+
+	sort.Slice(families, func(i, j int) bool {
+		return families[i].name < families[j].name
+	})
+
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+
+	for _, f := range families {
+		f.write(cw)
+	}
+
+	if err := cw.w.Flush(); err != nil && cw.err == nil {
+		cw.err = err
+	}
+
+	return cw.n, cw.err
+}
+
+type metricFamily struct {
+	name    string
+	help    string
+	typ     metricType
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*metricSeries
+}
+
+type metricSeries struct {
+	labels []string
+	value  float64
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// get returns the series with the label name and value pairs. It must be
+// called with f.mu held.
+func (f *metricFamily) get(labels []string) *metricSeries {
+
+	key := strings.Join(labels, "\xff")
+
+	s, ok := f.series[key]
+	if !ok {
+		s = &metricSeries{labels: append([]string(nil), labels...)}
+		if f.typ == metricHistogram {
+			s.counts = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+
+	return s
+}
+
+func (f *metricFamily) add(labels []string, v float64) {
+	f.mu.Lock()
+	f.get(labels).value += v
+	f.mu.Unlock()
+}
+
+func (f *metricFamily) observe(labels []string, v float64) {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	s := f.get(labels)
+
+	// Buckets are cumulative, so the observation counts in every bucket
+	// whose bound it does not exceed.
+	for i, bound := range f.buckets {
+		if v <= bound {
+			s.counts[i]++
+		}
+	}
+
+	s.sum += v
+	s.count++
+}
+
+func (f *metricFamily) write(w *countingWriter) {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(f.series) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	w.write("# HELP ", f.name, " ", f.help, "\n")
+	w.write("# TYPE ", f.name, " ", string(f.typ), "\n")
+
+	for _, key := range keys {
+
+		s := f.series[key]
+
+		if f.typ != metricHistogram {
+			w.write(f.name, formatLabels(s.labels, "", ""), " ", formatMetricValue(s.value), "\n")
+			continue
+		}
+
+		for i, bound := range f.buckets {
+			w.write(f.name, "_bucket", formatLabels(s.labels, "le", formatMetricValue(bound)), " ", strconv.FormatUint(s.counts[i], 10), "\n")
+		}
+
+		w.write(f.name, "_bucket", formatLabels(s.labels, "le", "+Inf"), " ", strconv.FormatUint(s.count, 10), "\n")
+		w.write(f.name, "_sum", formatLabels(s.labels, "", ""), " ", formatMetricValue(s.sum), "\n")
+		w.write(f.name, "_count", formatLabels(s.labels, "", ""), " ", strconv.FormatUint(s.count, 10), "\n")
+	}
+}
+
+// formatLabels formats label name and value pairs, followed by the extra
+// label if its name is not empty.
+func formatLabels(labels []string, extraName, extraValue string) string {
+
+	if len(labels) == 0 && extraName == "" {
+		return ""
+	}
+
+	var sb strings.Builder
+
+	sb.WriteByte('{')
+
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(labels[i])
+		sb.WriteString(`="`)
+		sb.WriteString(escapeLabelValue(labels[i+1]))
+		sb.WriteByte('"')
+	}
+
+	if extraName != "" {
+		if len(labels) > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(extraName)
+		sb.WriteString(`="`)
+		sb.WriteString(extraValue)
+		sb.WriteByte('"')
+	}
+
+	sb.WriteByte('}')
+
+	return sb.String()
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(v string) string {
+	return labelValueEscaper.Replace(v)
+}
+
+func formatMetricValue(v float64) string {
+
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// countingWriter writes strings and remembers the first error.
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (cw *countingWriter) write(parts ...string) {
+
+	for _, part := range parts {
+
+		if cw.err != nil {
+			return
+		}
+
+		n, err := cw.w.WriteString(part)
+		cw.n += int64(n)
+		cw.err = err
+	}
+}
@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ironfang-ltd/go-router"
+)
+
+func TestMetrics(t *testing.T) {
+
+	registry := NewMetricsRegistry()
+
+	r := router.New()
+
+	r.Get("/users/:id", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("hello"))
+	})
+
+	r.Post("/users", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	})
+
+	r.Get("/metrics", registry.ServeHTTP)
+
+	handler := Metrics(WithMetricsRegistry(registry), WithDurationBuckets(0.1, 1), WithSizeBuckets(1, 10))(r.ServeHTTP)
+
+	for _, req := range []struct {
+		method string
+		path   string
+	}{
+		{method: "GET", path: "/users/1"},
+		{method: "GET", path: "/users/2"},
+		{method: "POST", path: "/users"},
+		{method: "GET", path: "/missing"},
+		{method: "BREW", path: "/missing"},
+	} {
+		handler(httptest.NewRecorder(), httptest.NewRequest(req.method, req.path, nil))
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	if w.Header().Get("Content-Type") != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Errorf("content type is: %s", w.Header().Get("Content-Type"))
+	}
+
+	body := w.Body.String()
+
+	expected := []string{
+		"# HELP http_requests_total Total number of HTTP requests.\n# TYPE http_requests_total counter\n",
+		`http_requests_total{method="GET",route="/users/:id",status="2xx"} 2` + "\n",
+		`http_requests_total{method="POST",route="/users",status="4xx"} 1` + "\n",
+		`http_requests_total{method="GET",route="",status="4xx"} 1` + "\n",
+		`http_requests_total{method="OTHER",route="",status="4xx"} 1` + "\n",
+		`http_requests_in_flight{method="GET"} 0` + "\n",
+		"# TYPE http_request_duration_seconds histogram\n",
+		`http_request_duration_seconds_bucket{method="GET",route="/users/:id",status="2xx",le="+Inf"} 2` + "\n",
+		`http_request_duration_seconds_count{method="GET",route="/users/:id",status="2xx"} 2` + "\n",
+		`http_response_size_bytes_bucket{method="GET",route="/users/:id",status="2xx",le="1"} 0` + "\n",
+		`http_response_size_bytes_bucket{method="GET",route="/users/:id",status="2xx",le="10"} 2` + "\n",
+		`http_response_size_bytes_sum{method="GET",route="/users/:id",status="2xx"} 10` + "\n",
+	}
+
+	for _, e := range expected {
+		if !strings.Contains(body, e) {
+			t.Errorf("metrics do not contain %q:\n%s", e, body)
+		}
+	}
+
+	if strings.Contains(body, "/users/1") {
+		t.Errorf("metrics are labeled by path:\n%s", body)
+	}
+}
+
+func TestMetrics_InFlight(t *testing.T) {
+
+	registry := NewMetricsRegistry()
+
+	var during string
+
+	handler := Metrics(WithMetricsRegistry(registry), WithMetricsNamespace("shop"))(func(w http.ResponseWriter, r *http.Request) {
+		var sb strings.Builder
+		_, _ = registry.WriteTo(&sb)
+		during = sb.String()
+	})
+
+	handler(httptest.NewRecorder(), httptest.NewRequest("PUT", "/", nil))
+
+	if !strings.Contains(during, `shop_http_requests_in_flight{method="PUT"} 1`) {
+		t.Errorf("in-flight gauge during the request is not 1:\n%s", during)
+	}
+}
+
+func TestFormatLabels(t *testing.T) {
+
+	labels := formatLabels([]string{"route", "a\"b\\c\nd"}, "le", "0.5")
+
+	if labels != `{route="a\"b\\c\nd",le="0.5"}` {
+		t.Errorf("labels are: %s", labels)
+	}
+}
@@ -0,0 +1,149 @@
+package middleware
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"sort"
+)
+
+// overlayFS layers file systems on top of each other.
+type overlayFS struct {
+	layers []fs.FS
+}
+
+// Overlay returns a file system that looks files up in each layer in turn,
+// so earlier layers override later ones. Directory listings are merged. A
+// typical use layers a local override directory over embedded defaults:
+//
+//	Overlay(os.DirFS("./overrides"), embedded)
+func Overlay(layers ...fs.FS) fs.FS {
+	return &overlayFS{layers: layers}
+}
+
+func (o *overlayFS) Open(name string) (fs.File, error) {
+
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	var firstErr error
+
+	for _, layer := range o.layers {
+
+		f, err := layer.Open(name)
+		if err != nil {
+			if firstErr == nil || !errors.Is(err, fs.ErrNotExist) {
+				firstErr = err
+			}
+			continue
+		}
+
+		fi, err := f.Stat()
+		if err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+
+		if fi.IsDir() {
+			return &overlayDir{File: f, fsys: o, name: name}, nil
+		}
+
+		return f, nil
+	}
+
+	if firstErr == nil {
+		firstErr = fs.ErrNotExist
+	}
+
+	return nil, &fs.PathError{Op: "open", Path: name, Err: unwrapPathError(firstErr)}
+}
+
+// ReadDir merges the entries of name across all layers, earlier layers
+// winning for entries with the same name.
+func (o *overlayFS) ReadDir(name string) ([]fs.DirEntry, error) {
+
+	seen := make(map[string]bool)
+	var entries []fs.DirEntry
+	found := false
+
+	for _, layer := range o.layers {
+
+		layerEntries, err := fs.ReadDir(layer, name)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+
+		found = true
+
+		for _, entry := range layerEntries {
+			if seen[entry.Name()] {
+				continue
+			}
+			seen[entry.Name()] = true
+			entries = append(entries, entry)
+		}
+	}
+
+	if !found {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	return entries, nil
+}
+
+// overlayDir is a directory opened from the first layer containing it whose
+// entries are merged across every layer.
+type overlayDir struct {
+	fs.File
+	fsys    *overlayFS
+	name    string
+	entries []fs.DirEntry
+	read    bool
+}
+
+func (d *overlayDir) ReadDir(n int) ([]fs.DirEntry, error) {
+
+	if !d.read {
+		entries, err := d.fsys.ReadDir(d.name)
+		if err != nil {
+			return nil, err
+		}
+		d.entries = entries
+		d.read = true
+	}
+
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+
+	if n > len(d.entries) {
+		n = len(d.entries)
+	}
+
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+
+	return entries, nil
+}
+
+func unwrapPathError(err error) error {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return pathErr.Err
+	}
+	return err
+}
@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var precompressedExtensions = map[string]string{
+	"br":   ".br",
+	"gzip": ".gz",
+	"zstd": ".zst",
+}
+
+// precompressed opens the preferred precompressed variant of name accepted
+// by the request and returns it with its name, or nil if there is none.
+// When a variant is served Content-Encoding and the Content-Type of name are
+// set, so ranges and validators apply to the encoded bytes as RFC 9110
+// requires.
+func (fsrv *fileServer) precompressed(w http.ResponseWriter, r *http.Request, name string) (fs.File, fs.FileInfo, string) {
+
+	if len(fsrv.opts.Precompressed) == 0 {
+		return nil, nil, ""
+	}
+
+	// Without a type from the extension ServeContent would sniff the
+	// compressed bytes, so such files are always served as they are.
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		return nil, nil, ""
+	}
+
+	w.Header().Add("Vary", "Accept-Encoding")
+
+	for _, encoding := range acceptedEncodings(r, fsrv.opts.Precompressed) {
+
+		variantName := name + precompressedExtensions[encoding]
+
+		f, fi, err := fsrv.open(variantName)
+		if err != nil {
+			continue
+		}
+
+		if fi.IsDir() {
+			f.Close()
+			continue
+		}
+
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", contentType)
+		}
+		w.Header().Set("Content-Encoding", encoding)
+
+		return f, fi, variantName
+	}
+
+	return nil, nil, ""
+}
+
+// acceptedEncodings returns the offered content codings accepted by the
+// Accept-Encoding header of r, by descending quality and then in the order
+// of the offers.
+func acceptedEncodings(r *http.Request, offers []string) []string {
+
+	header := r.Header.Values("Accept-Encoding")
+	if len(header) == 0 {
+		return nil
+	}
+
+	qualities := make(map[string]float64)
+	wildcard := -1.0
+
+	for _, part := range strings.Split(strings.Join(header, ","), ",") {
+
+		coding, params, _ := strings.Cut(part, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding == "" {
+			continue
+		}
+
+		q := 1.0
+
+		name, value, _ := strings.Cut(strings.TrimSpace(params), "=")
+		if strings.EqualFold(strings.TrimSpace(name), "q") {
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil || parsed < 0 || parsed > 1 {
+				parsed = 0
+			}
+			q = parsed
+		}
+
+		if coding == "*" {
+			wildcard = q
+			continue
+		}
+
+		qualities[coding] = q
+	}
+
+	type accepted struct {
+		encoding string
+		q        float64
+	}
+
+	var encodings []accepted
+
+	for _, offer := range offers {
+
+		q, ok := qualities[offer]
+		if !ok {
+			q = wildcard
+		}
+
+		if q > 0 {
+			encodings = append(encodings, accepted{encoding: offer, q: q})
+		}
+	}
+
+	sort.SliceStable(encodings, func(i, j int) bool {
+		return encodings[i].q > encodings[j].q
+	})
+
+	result := make([]string, len(encodings))
+	for i, e := range encodings {
+		result[i] = e.encoding
+	}
+
+	return result
+}
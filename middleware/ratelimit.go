@@ -0,0 +1,313 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ironfang-ltd/go-router"
+	"github.com/ironfang-ltd/go-router/problem"
+)
+
+// RateLimitKey is the route metadata key of a RateLimitPolicy replacing the
+// policy of RateLimit for the route. A policy with no limit disables rate
+// limiting:
+//
+//	r.Post("/login", login).Meta(middleware.RateLimitKey, middleware.RateLimitPolicy{Limit: 5, Window: time.Minute})
+//	r.Get("/health", health).Meta(middleware.RateLimitKey, middleware.RateLimitPolicy{})
+const RateLimitKey = "ratelimit"
+
+// RateLimitPolicy allows Limit requests per Window.
+type RateLimitPolicy struct {
+	Limit  int
+	Window time.Duration
+}
+
+type RateLimitAlgorithm int
+
+const (
+	// TokenBucket allows bursts of up to Limit requests and refills the
+	// bucket steadily, at Limit requests per Window.
+	TokenBucket RateLimitAlgorithm = iota
+
+	// SlidingWindow counts the requests of the last Window, weighting the
+	// previous fixed window by how much of it the sliding window overlaps.
+	SlidingWindow
+)
+
+type RateLimitOption func(*RateLimitOptions)
+
+type RateLimitOptions struct {
+	Algorithm RateLimitAlgorithm
+	Key       func(r *http.Request) string
+	Store     RateLimitStore
+	Handler   http.HandlerFunc
+	Logger    *slog.Logger
+}
+
+// WithRateLimitAlgorithm sets the algorithm. The default is TokenBucket.
+func WithRateLimitAlgorithm(algorithm RateLimitAlgorithm) func(*RateLimitOptions) {
+	return func(opts *RateLimitOptions) {
+		opts.Algorithm = algorithm
+	}
+}
+
+// WithRateLimitKey sets the function returning the key requests are
+// counted under, such as RateLimitByHeader("X-Api-Key"). Requests with an
+// empty key are not limited. The default is RateLimitByIP.
+func WithRateLimitKey(key func(r *http.Request) string) func(*RateLimitOptions) {
+	return func(opts *RateLimitOptions) {
+		opts.Key = key
+	}
+}
+
+// WithRateLimitStore sets the store keeping the state of the keys. The
+// default is a MemoryRateLimitStore, which is not shared between
+// instances of the service.
+func WithRateLimitStore(store RateLimitStore) func(*RateLimitOptions) {
+	return func(opts *RateLimitOptions) {
+		opts.Store = store
+	}
+}
+
+// WithRateLimitHandler sets the handler answering limited requests, after
+// the rate limit headers and Retry-After are set. The default writes a 429
+// Too Many Requests problem.
+func WithRateLimitHandler(handler http.HandlerFunc) func(*RateLimitOptions) {
+	return func(opts *RateLimitOptions) {
+		opts.Handler = handler
+	}
+}
+
+// WithRateLimitLogger sets the logger store errors are reported to. The
+// default is slog.Default().
+func WithRateLimitLogger(logger *slog.Logger) func(*RateLimitOptions) {
+	return func(opts *RateLimitOptions) {
+		opts.Logger = logger
+	}
+}
+
+// RateLimitByIP keys requests by client IP address.
+func RateLimitByIP(r *http.Request) string {
+	return remoteIP(r)
+}
+
+// RateLimitByRoute keys requests by route pattern, limiting each route as
+// a whole rather than each client.
+func RateLimitByRoute(r *http.Request) string {
+	return router.PatternFromContext(r.Context())
+}
+
+// RateLimitByHeader keys requests by the value of a header, such as an API
+// key. Requests without the header are keyed by client IP address.
+func RateLimitByHeader(name string) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		if v := r.Header.Get(name); v != "" {
+			return name + ":" + v
+		}
+		return RateLimitByIP(r)
+	}
+}
+
+// RateLimitBySubject keys requests by the authenticated subject returned
+// by subject, typically read from a context value set by authentication
+// middleware. Anonymous requests, for which subject returns an empty
+// string, are keyed by client IP address.
+func RateLimitBySubject(subject func(r *http.Request) string) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		if s := subject(r); s != "" {
+			return "subject:" + s
+		}
+		return RateLimitByIP(r)
+	}
+}
+
+// RateLimit limits requests to limit per window for every key, answering
+// the others with 429 Too Many Requests. Responses carry the
+// RateLimit-Policy, RateLimit-Limit, RateLimit-Remaining and
+// RateLimit-Reset headers of the IETF RateLimit header fields draft, and
+// limited ones Retry-After.
+//
+// Routes can set their own policy with the RateLimitKey metadata; their
+// requests are then counted apart from those of other routes. Add RateLimit
+// with Use, so the route is known. If the store fails, requests are let
+// through.
+func RateLimit(limit int, window time.Duration, options ...RateLimitOption) router.Middleware {
+
+	opts := &RateLimitOptions{
+		Algorithm: TokenBucket,
+		Key:       RateLimitByIP,
+		Logger:    slog.Default(),
+	}
+
+	for _, option := range options {
+		option(opts)
+	}
+
+	if opts.Store == nil {
+		opts.Store = NewMemoryRateLimitStore()
+	}
+
+	if opts.Handler == nil {
+		opts.Handler = func(w http.ResponseWriter, r *http.Request) {
+			router.WriteProblem(w, r, problem.New(http.StatusTooManyRequests).WithDetail("Rate limit exceeded."))
+		}
+	}
+
+	defaultPolicy := RateLimitPolicy{Limit: limit, Window: window}
+
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+
+			policy, scope := defaultPolicy, ""
+			if p, ok := router.MetaFromContext[RateLimitPolicy](r.Context(), RateLimitKey); ok {
+				policy, scope = p, router.PatternFromContext(r.Context())
+			}
+
+			if policy.Limit <= 0 || policy.Window <= 0 {
+				next(w, r)
+				return
+			}
+
+			key := opts.Key(r)
+			if key == "" {
+				next(w, r)
+				return
+			}
+
+			if scope != "" {
+				key = scope + "\x00" + key
+			}
+
+			result, err := takeRateLimit(r.Context(), opts.Store, opts.Algorithm, key, policy, time.Now())
+			if err != nil {
+				opts.Logger.Error("rate limit store failed", "key", key, "error", err)
+				next(w, r)
+				return
+			}
+
+			h := w.Header()
+			h.Set("RateLimit-Policy", strconv.Itoa(policy.Limit)+";w="+strconv.Itoa(ceilSeconds(policy.Window)))
+			h.Set("RateLimit-Limit", strconv.Itoa(policy.Limit))
+			h.Set("RateLimit-Remaining", strconv.Itoa(result.remaining))
+			h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.reset)))
+
+			if !result.allowed {
+				h.Set("Retry-After", strconv.Itoa(max(1, ceilSeconds(result.retryAfter))))
+				opts.Handler(w, r)
+				return
+			}
+
+			next(w, r)
+		}
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+type rateLimitResult struct {
+	allowed    bool
+	remaining  int
+	reset      time.Duration
+	retryAfter time.Duration
+}
+
+// takeRateLimit counts a request for key at now, in a single update of the
+// store so concurrent requests cannot both take the last unit.
+func takeRateLimit(ctx context.Context, store RateLimitStore, algorithm RateLimitAlgorithm, key string, policy RateLimitPolicy, now time.Time) (rateLimitResult, error) {
+
+	var result rateLimitResult
+
+	// State is kept for two windows, as long as the sliding window needs
+	// the previous one; a token bucket is full again after one.
+	err := store.Update(ctx, key, 2*policy.Window, func(state *RateLimitState) {
+		if algorithm == SlidingWindow {
+			result = slidingWindow(state, policy, now)
+		} else {
+			result = tokenBucket(state, policy, now)
+		}
+	})
+
+	return result, err
+}
+
+// tokenBucket keeps the number of tokens in Value and the time they were
+// counted in Time. A new key starts with a full bucket.
+func tokenBucket(state *RateLimitState, policy RateLimitPolicy, now time.Time) rateLimitResult {
+
+	limit := float64(policy.Limit)
+	perToken := policy.Window / time.Duration(policy.Limit)
+
+	if state.Time.IsZero() {
+		state.Value = limit
+	} else if elapsed := now.Sub(state.Time); elapsed > 0 {
+		state.Value = min(limit, state.Value+float64(elapsed)/float64(perToken))
+	}
+
+	state.Time = now
+
+	var result rateLimitResult
+
+	if state.Value >= 1 {
+		state.Value--
+		result.allowed = true
+	} else {
+		result.retryAfter = time.Duration((1 - state.Value) * float64(perToken))
+	}
+
+	result.remaining = int(state.Value)
+	result.reset = time.Duration((limit - state.Value) * float64(perToken))
+
+	return result
+}
+
+// slidingWindow keeps the count of the current fixed window in Value, the
+// count of the previous one in Previous and the start of the current one
+// in Time.
+func slidingWindow(state *RateLimitState, policy RateLimitPolicy, now time.Time) rateLimitResult {
+
+	limit := float64(policy.Limit)
+	start := now.Truncate(policy.Window)
+
+	if !state.Time.Equal(start) {
+		if state.Time.Equal(start.Add(-policy.Window)) {
+			state.Previous = state.Value
+		} else {
+			state.Previous = 0
+		}
+		state.Value = 0
+		state.Time = start
+	}
+
+	elapsed := now.Sub(start)
+	weight := 1 - float64(elapsed)/float64(policy.Window)
+	count := state.Previous*weight + state.Value
+
+	result := rateLimitResult{
+		reset: policy.Window - elapsed,
+	}
+
+	if count+1 <= limit {
+		state.Value++
+		result.allowed = true
+		result.remaining = int(limit - count - 1)
+		return result
+	}
+
+	// Requests of the previous window weigh less as time passes; wait for
+	// the count to drop by one, or for the next window if the current one
+	// is full on its own.
+	retryAt := policy.Window
+	if state.Value+1 <= limit && state.Previous > 0 {
+		retryAt = time.Duration((1 - (limit-state.Value-1)/state.Previous) * float64(policy.Window))
+	}
+
+	result.retryAfter = retryAt - elapsed
+
+	return result
+}
@@ -0,0 +1,319 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ironfang-ltd/go-router"
+)
+
+func TestRateLimit(t *testing.T) {
+
+	for _, algorithm := range []RateLimitAlgorithm{TokenBucket, SlidingWindow} {
+
+		r := router.New()
+		r.Use(RateLimit(2, time.Minute, WithRateLimitAlgorithm(algorithm)))
+
+		r.Get("/", func(w http.ResponseWriter, r *http.Request) {})
+
+		tests := []struct {
+			remoteAddr string
+			status     int
+			remaining  string
+		}{
+			{remoteAddr: "192.0.2.1:1000", status: http.StatusOK, remaining: "1"},
+			{remoteAddr: "192.0.2.1:1001", status: http.StatusOK, remaining: "0"},
+			{remoteAddr: "192.0.2.1:1002", status: http.StatusTooManyRequests, remaining: "0"},
+			{remoteAddr: "192.0.2.2:1000", status: http.StatusOK, remaining: "1"},
+		}
+
+		for _, tc := range tests {
+
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tc.remoteAddr
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, req)
+
+			if w.Code != tc.status {
+				t.Errorf("algorithm %d: response code is: %d, expected: %d", algorithm, w.Code, tc.status)
+			}
+
+			h := w.Header()
+
+			if h.Get("RateLimit-Limit") != "2" || h.Get("RateLimit-Remaining") != tc.remaining || h.Get("RateLimit-Policy") != "2;w=60" {
+				t.Errorf("algorithm %d: headers are: %v", algorithm, h)
+			}
+
+			if reset, err := strconv.Atoi(h.Get("RateLimit-Reset")); err != nil || reset < 0 || reset > 60 {
+				t.Errorf("algorithm %d: RateLimit-Reset is: %s", algorithm, h.Get("RateLimit-Reset"))
+			}
+
+			if tc.status != http.StatusTooManyRequests {
+				continue
+			}
+
+			if retry, err := strconv.Atoi(h.Get("Retry-After")); err != nil || retry < 1 || retry > 60 {
+				t.Errorf("algorithm %d: Retry-After is: %s", algorithm, h.Get("Retry-After"))
+			}
+
+			if h.Get("Content-Type") != "application/problem+json" {
+				t.Errorf("algorithm %d: content type is: %s", algorithm, h.Get("Content-Type"))
+			}
+		}
+	}
+}
+
+func TestRateLimit_Routes(t *testing.T) {
+
+	r := router.New()
+	r.Use(RateLimit(1, time.Minute))
+
+	r.Get("/a", func(w http.ResponseWriter, r *http.Request) {})
+	r.Get("/b", func(w http.ResponseWriter, r *http.Request) {})
+
+	r.Get("/login", func(w http.ResponseWriter, r *http.Request) {}).
+		Meta(RateLimitKey, RateLimitPolicy{Limit: 3, Window: time.Minute})
+
+	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {}).
+		Meta(RateLimitKey, RateLimitPolicy{})
+
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{path: "/a", status: http.StatusOK},
+		{path: "/b", status: http.StatusTooManyRequests},
+		{path: "/login", status: http.StatusOK},
+		{path: "/login", status: http.StatusOK},
+		{path: "/login", status: http.StatusOK},
+		{path: "/login", status: http.StatusTooManyRequests},
+		{path: "/health", status: http.StatusOK},
+		{path: "/health", status: http.StatusOK},
+	}
+
+	for _, tc := range tests {
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", tc.path, nil))
+
+		if w.Code != tc.status {
+			t.Errorf("%s: response code is: %d, expected: %d", tc.path, w.Code, tc.status)
+		}
+	}
+}
+
+func TestRateLimit_Keys(t *testing.T) {
+
+	type subjectKey struct{}
+
+	subject := func(r *http.Request) string {
+		s, _ := r.Context().Value(subjectKey{}).(string)
+		return s
+	}
+
+	tests := []struct {
+		name    string
+		key     func(r *http.Request) string
+		prepare func(r *http.Request, i int) *http.Request
+		limited bool
+	}{
+		{
+			name: "HeaderDiffers",
+			key:  RateLimitByHeader("X-Api-Key"),
+			prepare: func(r *http.Request, i int) *http.Request {
+				r.Header.Set("X-Api-Key", strconv.Itoa(i))
+				return r
+			},
+		},
+		{
+			name: "HeaderSame",
+			key:  RateLimitByHeader("X-Api-Key"),
+			prepare: func(r *http.Request, i int) *http.Request {
+				r.Header.Set("X-Api-Key", "key")
+				r.RemoteAddr = "192.0.2." + strconv.Itoa(i) + ":1000"
+				return r
+			},
+			limited: true,
+		},
+		{
+			name: "SubjectDiffers",
+			key:  RateLimitBySubject(subject),
+			prepare: func(r *http.Request, i int) *http.Request {
+				return r.WithContext(context.WithValue(r.Context(), subjectKey{}, strconv.Itoa(i)))
+			},
+		},
+		{
+			name: "AnonymousSubject",
+			key:  RateLimitBySubject(subject),
+			prepare: func(r *http.Request, i int) *http.Request {
+				return r
+			},
+			limited: true,
+		},
+		{
+			name: "Route",
+			key:  RateLimitByRoute,
+			prepare: func(r *http.Request, i int) *http.Request {
+				r.RemoteAddr = "192.0.2." + strconv.Itoa(i) + ":1000"
+				return r
+			},
+			limited: true,
+		},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+
+			r := router.New()
+			r.Use(RateLimit(1, time.Minute, WithRateLimitKey(tc.key)))
+			r.Get("/", func(w http.ResponseWriter, r *http.Request) {})
+
+			limited := false
+
+			for i := 1; i <= 2; i++ {
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, tc.prepare(httptest.NewRequest("GET", "/", nil), i))
+				limited = w.Code == http.StatusTooManyRequests
+			}
+
+			if limited != tc.limited {
+				t.Errorf("second request limited: %t, expected: %t", limited, tc.limited)
+			}
+		})
+	}
+}
+
+func TestRateLimit_Handler(t *testing.T) {
+
+	handler := RateLimit(1, time.Second, WithRateLimitHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))(func(w http.ResponseWriter, r *http.Request) {})
+
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/", nil))
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("response code is: %d, expected: %d", w.Code, http.StatusServiceUnavailable)
+	}
+
+	if w.Header().Get("Retry-After") != "1" {
+		t.Errorf("Retry-After is: %s, expected: 1", w.Header().Get("Retry-After"))
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+
+	policy := RateLimitPolicy{Limit: 2, Window: 2 * time.Second}
+	start := time.Unix(1000, 0)
+
+	tests := []struct {
+		at         time.Duration
+		allowed    bool
+		remaining  int
+		retryAfter time.Duration
+	}{
+		{at: 0, allowed: true, remaining: 1},
+		{at: 0, allowed: true, remaining: 0},
+		{at: 500 * time.Millisecond, allowed: false, retryAfter: 500 * time.Millisecond},
+		{at: time.Second, allowed: true, remaining: 0},
+		{at: 10 * time.Second, allowed: true, remaining: 1},
+	}
+
+	var state RateLimitState
+
+	for i, tc := range tests {
+
+		result := tokenBucket(&state, policy, start.Add(tc.at))
+
+		if result.allowed != tc.allowed || result.remaining != tc.remaining || result.retryAfter != tc.retryAfter {
+			t.Errorf("request %d: result is: %+v, expected: %+v", i, result, tc)
+		}
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+
+	policy := RateLimitPolicy{Limit: 4, Window: 10 * time.Second}
+	start := time.Unix(1000, 0).Truncate(policy.Window)
+
+	tests := []struct {
+		at         time.Duration
+		allowed    bool
+		retryAfter time.Duration
+	}{
+		{at: 0, allowed: true},
+		{at: time.Second, allowed: true},
+		{at: 2 * time.Second, allowed: true},
+		{at: 3 * time.Second, allowed: true},
+		// The current window is full until it ends.
+		{at: 4 * time.Second, allowed: false, retryAfter: 6 * time.Second},
+		// The previous window weighs 4 * 0.5 = 2, so two requests fit.
+		{at: 15 * time.Second, allowed: true},
+		{at: 15 * time.Second, allowed: true},
+		// Three requests counted: wait for the previous window to weigh
+		// 4 * 0.25 = 1 at 17.5s.
+		{at: 15 * time.Second, allowed: false, retryAfter: 2500 * time.Millisecond},
+		// Two windows later nothing is counted.
+		{at: 35 * time.Second, allowed: true},
+	}
+
+	var state RateLimitState
+
+	for i, tc := range tests {
+
+		result := slidingWindow(&state, policy, start.Add(tc.at))
+
+		if result.allowed != tc.allowed || result.retryAfter != tc.retryAfter {
+			t.Errorf("request %d: result is: %+v, expected: %+v", i, result, tc)
+		}
+	}
+}
+
+func TestMemoryRateLimitStore_Eviction(t *testing.T) {
+
+	now := time.Unix(1000, 0)
+
+	store := NewMemoryRateLimitStore()
+	store.now = func() time.Time { return now }
+
+	ctx := context.Background()
+
+	for i := 0; i < 1000; i++ {
+		_ = store.Update(ctx, strconv.Itoa(i), time.Second, func(state *RateLimitState) {
+			state.Value = 1
+		})
+	}
+
+	if store.Len() != 1000 {
+		t.Fatalf("store has %d keys, expected: 1000", store.Len())
+	}
+
+	// An expired key starts from a zero state even before it is evicted.
+	now = now.Add(2 * time.Second)
+
+	_ = store.Update(ctx, "0", time.Second, func(state *RateLimitState) {
+		if state.Value != 0 {
+			t.Errorf("expired state is: %+v", state)
+		}
+	})
+
+	// Shards are swept once the sweep interval has passed.
+	now = now.Add(rateLimitSweepInterval)
+
+	for i := 0; i < 1000; i++ {
+		_ = store.Update(ctx, "new"+strconv.Itoa(i), time.Hour, func(state *RateLimitState) {})
+	}
+
+	if store.Len() != 1000 {
+		t.Errorf("store has %d keys, expected: 1000", store.Len())
+	}
+}
@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"context"
+	"hash/maphash"
+	"sync"
+	"time"
+)
+
+// RateLimitState is the state RateLimit keeps for a key. Its meaning
+// depends on the algorithm, and stores only need to keep it.
+type RateLimitState struct {
+	Value    float64
+	Previous float64
+	Time     time.Time
+}
+
+// RateLimitStore keeps the state of rate limited keys. Implementations
+// backed by a shared database, such as Redis, let several instances of a
+// service enforce a common limit.
+type RateLimitStore interface {
+	// Update calls fn with the state of key, a zero state if there is none
+	// or it has expired, and stores the modified state for ttl. Updates of
+	// the same key must not interleave, for example by retrying on a
+	// conflicting write.
+	Update(ctx context.Context, key string, ttl time.Duration, fn func(state *RateLimitState)) error
+}
+
+const (
+	rateLimitShards = 64
+
+	// rateLimitSweepInterval is how often a shard is swept of expired keys.
+	rateLimitSweepInterval = time.Minute
+)
+
+// MemoryRateLimitStore is a RateLimitStore kept in memory. Keys are spread
+// over shards, each with its own lock, and expired keys are evicted as the
+// shards are used.
+type MemoryRateLimitStore struct {
+	seed   maphash.Seed
+	shards [rateLimitShards]rateLimitShard
+
+	// now is replaced in tests.
+	now func() time.Time
+}
+
+type rateLimitShard struct {
+	mu      sync.Mutex
+	entries map[string]*rateLimitEntry
+	swept   time.Time
+}
+
+type rateLimitEntry struct {
+	state   RateLimitState
+	expires time.Time
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+
+	s := &MemoryRateLimitStore{
+		seed: maphash.MakeSeed(),
+		now:  time.Now,
+	}
+
+	for i := range s.shards {
+		s.shards[i].entries = make(map[string]*rateLimitEntry)
+	}
+
+	return s
+}
+
+func (s *MemoryRateLimitStore) Update(ctx context.Context, key string, ttl time.Duration, fn func(state *RateLimitState)) error {
+
+	shard := &s.shards[maphash.String(s.seed, key)%rateLimitShards]
+	now := s.now()
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if now.Sub(shard.swept) >= rateLimitSweepInterval {
+		for k, e := range shard.entries {
+			if !now.Before(e.expires) {
+				delete(shard.entries, k)
+			}
+		}
+		shard.swept = now
+	}
+
+	e, ok := shard.entries[key]
+	if !ok || !now.Before(e.expires) {
+		e = &rateLimitEntry{}
+		shard.entries[key] = e
+	}
+
+	fn(&e.state)
+	e.expires = now.Add(ttl)
+
+	return nil
+}
+
+// Len returns the number of keys in the store, including expired keys not
+// evicted yet.
+func (s *MemoryRateLimitStore) Len() int {
+
+	n := 0
+
+	for i := range s.shards {
+		s.shards[i].mu.Lock()
+		n += len(s.shards[i].entries)
+		s.shards[i].mu.Unlock()
+	}
+
+	return n
+}
@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/ironfang-ltd/go-router"
+)
+
+type RecoverOption func(*RecoverOptions)
+
+type RecoverOptions struct {
+	Logger     *slog.Logger
+	PrintStack bool
+}
+
+func WithRecoverLogger(logger *slog.Logger) func(*RecoverOptions) {
+	return func(opts *RecoverOptions) {
+		opts.Logger = logger
+	}
+}
+
+func WithRecoverStack(print bool) func(*RecoverOptions) {
+	return func(opts *RecoverOptions) {
+		opts.PrintStack = print
+	}
+}
+
+// Recover recovers panics raised by the handler, logs them and answers with
+// a 500 Internal Server Error through router.WriteError, unless the response
+// header was already sent. http.ErrAbortHandler is re-panicked so the server
+// can abort the connection as intended.
+func Recover(options ...RecoverOption) router.Middleware {
+
+	opts := &RecoverOptions{
+		Logger:     slog.Default(),
+		PrintStack: true,
+	}
+
+	for _, option := range options {
+		option(opts)
+	}
+
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+
+			rw := NewResponseWriter(w)
+
+			defer func() {
+				rec := recover()
+				if rec == nil {
+					return
+				}
+
+				if rec == http.ErrAbortHandler {
+					panic(rec)
+				}
+
+				attrs := []any{"method", r.Method, "path", r.URL.Path, "panic", fmt.Sprint(rec)}
+				if id := RequestIDFromContext(r.Context()); id != "" {
+					attrs = append(attrs, "request_id", id)
+				}
+				if opts.PrintStack {
+					attrs = append(attrs, "stack", string(debug.Stack()))
+				}
+
+				opts.Logger.Error("panic recovered", attrs...)
+
+				if rw.HeaderWritten() {
+					return
+				}
+
+				router.WriteError(rw, r, router.NewHTTPError(http.StatusInternalServerError, ""))
+			}()
+
+			next(rw, r)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ironfang-ltd/go-router"
+	"github.com/ironfang-ltd/go-router/problem"
+)
+
+func TestRecover(t *testing.T) {
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+	req, _ := http.NewRequest("GET", "/boom", nil)
+	w := httptest.NewRecorder()
+
+	r := router.New()
+	r.Use(Recover(WithRecoverLogger(logger), WithRecoverStack(false)))
+
+	r.Get("/boom", func(w http.ResponseWriter, r *http.Request) {
+		panic("something broke")
+	})
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("response code is: %d, expected: %d", w.Code, http.StatusInternalServerError)
+	}
+
+	if !strings.Contains(buf.String(), "something broke") {
+		t.Errorf("log output is: %s, expected it to contain the panic value", buf.String())
+	}
+}
+
+func TestRecover_ProblemDetails(t *testing.T) {
+
+	req, _ := http.NewRequest("GET", "/boom", nil)
+	w := httptest.NewRecorder()
+
+	r := router.New(router.WithProblemDetails())
+	r.Use(Recover(WithRecoverLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))))
+
+	r.Get("/boom", func(w http.ResponseWriter, r *http.Request) {
+		panic("something broke")
+	})
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("response code is: %d, expected: %d", w.Code, http.StatusInternalServerError)
+	}
+
+	if w.Header().Get("Content-Type") != problem.ContentType {
+		t.Errorf("content type is: %s, expected: %s", w.Header().Get("Content-Type"), problem.ContentType)
+	}
+
+	if strings.Contains(w.Body.String(), "something broke") {
+		t.Error("panic value leaked into the response body")
+	}
+}
+
+func TestRecover_AbortHandler(t *testing.T) {
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+
+	handler := Recover()(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	})
+
+	defer func() {
+		if rec := recover(); rec != http.ErrAbortHandler {
+			t.Errorf("recovered: %v, expected: %v", rec, http.ErrAbortHandler)
+		}
+	}()
+
+	handler.ServeHTTP(w, req)
+}
@@ -0,0 +1,220 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/ironfang-ltd/go-router"
+)
+
+const (
+	DefaultRequestIDHeader    = "X-Request-Id"
+	DefaultRequestIDMaxLength = 128
+)
+
+type RequestIDOption func(*RequestIDOptions)
+
+type RequestIDOptions struct {
+	Header        string
+	MaxLength     int
+	TrustIncoming bool
+	Validate      func(id string) bool
+	Generate      func() string
+}
+
+// WithRequestIDHeader sets the header the request ID is read from and
+// echoed in. The default is DefaultRequestIDHeader.
+func WithRequestIDHeader(name string) func(*RequestIDOptions) {
+	return func(opts *RequestIDOptions) {
+		opts.Header = name
+	}
+}
+
+// WithRequestIDMaxLength sets the length of the longest incoming ID that is
+// accepted. The default is DefaultRequestIDMaxLength.
+func WithRequestIDMaxLength(n int) func(*RequestIDOptions) {
+	return func(opts *RequestIDOptions) {
+		opts.MaxLength = n
+	}
+}
+
+// WithTrustIncomingRequestID sets whether IDs sent by clients are used. The
+// default is true; services facing untrusted clients may always generate
+// their own.
+func WithTrustIncomingRequestID(trust bool) func(*RequestIDOptions) {
+	return func(opts *RequestIDOptions) {
+		opts.TrustIncoming = trust
+	}
+}
+
+// WithRequestIDValidator sets the check incoming IDs must pass, in addition
+// to the length limit. The default allows letters, digits and "-_.:+/=".
+func WithRequestIDValidator(validate func(id string) bool) func(*RequestIDOptions) {
+	return func(opts *RequestIDOptions) {
+		opts.Validate = validate
+	}
+}
+
+// WithRequestIDGenerator sets the function generating IDs for requests
+// without a valid one, such as NewULID. The default is NewUUIDv7.
+func WithRequestIDGenerator(generate func() string) func(*RequestIDOptions) {
+	return func(opts *RequestIDOptions) {
+		opts.Generate = generate
+	}
+}
+
+// RequestID gives every request an ID, taken from the request header when
+// it is valid and generated otherwise. The ID is echoed in the response
+// header and stored in the request context, where RequestIDFromContext,
+// Logger, Recover and the error responses of the router find it.
+func RequestID(options ...RequestIDOption) router.Middleware {
+
+	opts := &RequestIDOptions{
+		Header:        DefaultRequestIDHeader,
+		MaxLength:     DefaultRequestIDMaxLength,
+		TrustIncoming: true,
+		Validate:      validRequestID,
+		Generate:      NewUUIDv7,
+	}
+
+	for _, option := range options {
+		option(opts)
+	}
+
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+
+			id := ""
+
+			if opts.TrustIncoming {
+				id = r.Header.Get(opts.Header)
+				if len(id) > opts.MaxLength || id != "" && !opts.Validate(id) {
+					id = ""
+				}
+			}
+
+			if id == "" {
+				id = opts.Generate()
+			}
+
+			w.Header().Set(opts.Header, id)
+
+			next(w, r.WithContext(router.ContextWithRequestID(r.Context(), id)))
+		}
+	}
+}
+
+// RequestIDFromContext returns the ID given to the request by RequestID, or
+// an empty string.
+func RequestIDFromContext(ctx context.Context) string {
+	return router.RequestIDFromContext(ctx)
+}
+
+// RequestIDTransport is an http.RoundTripper that forwards the request ID
+// of the outgoing request's context to the next service.
+type RequestIDTransport struct {
+	// Base is the transport making the requests. If nil,
+	// http.DefaultTransport is used.
+	Base http.RoundTripper
+
+	// Header carries the ID. If empty, DefaultRequestIDHeader is used.
+	Header string
+}
+
+func (t *RequestIDTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	header := t.Header
+	if header == "" {
+		header = DefaultRequestIDHeader
+	}
+
+	if id := RequestIDFromContext(req.Context()); id != "" && req.Header.Get(header) == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set(header, id)
+	}
+
+	return base.RoundTrip(req)
+}
+
+// NewUUIDv7 returns a random, time-ordered UUID as defined by RFC 9562.
+func NewUUIDv7() string {
+
+	var b [16]byte
+
+	_, _ = rand.Read(b[6:])
+
+	ms := uint64(time.Now().UnixMilli())
+	binary.BigEndian.PutUint16(b[0:], uint16(ms>>32))
+	binary.BigEndian.PutUint32(b[2:], uint32(ms))
+
+	b[6] = b[6]&0x0f | 0x70
+	b[8] = b[8]&0x3f | 0x80
+
+	var s [36]byte
+
+	hex.Encode(s[0:8], b[0:4])
+	s[8] = '-'
+	hex.Encode(s[9:13], b[4:6])
+	s[13] = '-'
+	hex.Encode(s[14:18], b[6:8])
+	s[18] = '-'
+	hex.Encode(s[19:23], b[8:10])
+	s[23] = '-'
+	hex.Encode(s[24:], b[10:])
+
+	return string(s[:])
+}
+
+const crockfordBase32 = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// NewULID returns a random, lexically sortable ULID: a millisecond
+// timestamp and 80 random bits in 26 characters of Crockford's base32.
+func NewULID() string {
+
+	var b [16]byte
+
+	_, _ = rand.Read(b[6:])
+
+	ms := uint64(time.Now().UnixMilli())
+	binary.BigEndian.PutUint16(b[0:], uint16(ms>>32))
+	binary.BigEndian.PutUint32(b[2:], uint32(ms))
+
+	hi := binary.BigEndian.Uint64(b[0:])
+	lo := binary.BigEndian.Uint64(b[8:])
+
+	var s [26]byte
+
+	// The 128 bits are encoded 5 at a time from the end, so the first
+	// character holds the top 3 bits.
+	for i := 25; i >= 0; i-- {
+		s[i] = crockfordBase32[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+
+	return string(s[:])
+}
+
+func validRequestID(id string) bool {
+
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':', c == '+', c == '/', c == '=':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
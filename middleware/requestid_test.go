@@ -0,0 +1,179 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/ironfang-ltd/go-router"
+)
+
+var uuidv7Pattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestRequestID(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		options  []RequestIDOption
+		incoming string
+		expected string
+		pattern  *regexp.Regexp
+	}{
+		{name: "Generated", pattern: uuidv7Pattern},
+		{name: "Incoming", incoming: "abc-123", expected: "abc-123"},
+		{name: "InvalidCharacters", incoming: "abc 123\n", pattern: uuidv7Pattern},
+		{name: "TooLong", incoming: strings.Repeat("a", 129), pattern: uuidv7Pattern},
+		{name: "MaxLength", options: []RequestIDOption{WithRequestIDMaxLength(4)}, incoming: "abcde", pattern: uuidv7Pattern},
+		{name: "Untrusted", options: []RequestIDOption{WithTrustIncomingRequestID(false)}, incoming: "abc-123", pattern: uuidv7Pattern},
+		{name: "Validator", options: []RequestIDOption{WithRequestIDValidator(func(id string) bool { return strings.HasPrefix(id, "req-") })}, incoming: "abc-123", pattern: uuidv7Pattern},
+		{name: "Generator", options: []RequestIDOption{WithRequestIDGenerator(NewULID)}, pattern: regexp.MustCompile(`^[0-9A-HJKMNP-TV-Z]{26}$`)},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+
+			var fromContext string
+
+			handler := RequestID(tc.options...)(func(w http.ResponseWriter, r *http.Request) {
+				fromContext = RequestIDFromContext(r.Context())
+			})
+
+			req := httptest.NewRequest("GET", "/", nil)
+			if tc.incoming != "" {
+				req.Header.Set("X-Request-Id", tc.incoming)
+			}
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			id := w.Header().Get("X-Request-Id")
+
+			if id != fromContext {
+				t.Errorf("response header is: %s, context is: %s", id, fromContext)
+			}
+
+			if tc.expected != "" && id != tc.expected {
+				t.Errorf("request id is: %s, expected: %s", id, tc.expected)
+			}
+
+			if tc.pattern != nil && !tc.pattern.MatchString(id) {
+				t.Errorf("request id is: %s, expected to match: %s", id, tc.pattern)
+			}
+		})
+	}
+}
+
+func TestRequestID_Header(t *testing.T) {
+
+	handler := RequestID(WithRequestIDHeader("X-Correlation-Id"))(func(w http.ResponseWriter, r *http.Request) {})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Correlation-Id", "corr-1")
+	w := httptest.NewRecorder()
+
+	handler(w, req)
+
+	if w.Header().Get("X-Correlation-Id") != "corr-1" {
+		t.Errorf("X-Correlation-Id is: %s, expected: %s", w.Header().Get("X-Correlation-Id"), "corr-1")
+	}
+}
+
+func TestRequestID_Sortable(t *testing.T) {
+
+	for _, generate := range []func() string{NewUUIDv7, NewULID} {
+
+		previous := generate()
+
+		for i := 0; i < 100; i++ {
+			id := generate()
+			if id == previous {
+				t.Fatalf("duplicate id: %s", id)
+			}
+			// Only the timestamp is ordered, so compare at millisecond
+			// granularity: the first 8 characters of both formats.
+			if id[:8] < previous[:8] {
+				t.Fatalf("id %s sorts before %s", id, previous)
+			}
+			previous = id
+		}
+	}
+}
+
+func TestRequestID_PickedUp(t *testing.T) {
+
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logs, nil))
+
+	r := router.New(router.WithProblemDetails())
+	r.Use(RequestID(), Recover(WithRecoverLogger(logger), WithRecoverStack(false)))
+
+	r.Get("/boom", func(w http.ResponseWriter, r *http.Request) {
+		panic("something broke")
+	})
+
+	handler := Logger(WithLogger(logger))(r.ServeHTTP)
+
+	req := httptest.NewRequest("GET", "/boom", nil)
+	req.Header.Set("X-Request-Id", "req-7")
+	w := httptest.NewRecorder()
+
+	handler(w, req)
+
+	var body map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+
+	if body["requestId"] != "req-7" {
+		t.Errorf("problem is: %v, expected requestId: req-7", body)
+	}
+
+	records := readLogRecords(t, &logs)
+	if len(records) != 2 {
+		t.Fatalf("expected a panic and an access log record, got: %v", records)
+	}
+
+	for _, record := range records {
+		if record["request_id"] != "req-7" {
+			t.Errorf("record is: %v, expected request_id: req-7", record)
+		}
+	}
+}
+
+func TestRequestIDTransport(t *testing.T) {
+
+	var received string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get("X-Request-Id")
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: &RequestIDTransport{}}
+
+	handler := RequestID()(func(w http.ResponseWriter, r *http.Request) {
+		req, _ := http.NewRequestWithContext(r.Context(), "GET", srv.URL, nil)
+		res, err := client.Do(req)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		res.Body.Close()
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Request-Id", "req-9")
+
+	handler(httptest.NewRecorder(), req)
+
+	if received != "req-9" {
+		t.Errorf("forwarded request id is: %s, expected: %s", received, "req-9")
+	}
+}
@@ -1,57 +1,215 @@
 package middleware
 
 import (
+	"context"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/ironfang-ltd/go-router"
 )
 
-type customWriter struct {
-	w      http.ResponseWriter
-	before func()
+const DefaultTimeHeader = "X-Request-Time-Ms"
+
+type TimeOption func(*TimeOptions)
+
+type TimeOptions struct {
+	Header        string
+	Precision     time.Duration
+	ServerTiming  bool
+	SlowThreshold time.Duration
+	OnSlow        func(r *http.Request, taken time.Duration)
+}
+
+// WithTimeHeader sets the header carrying the time taken in milliseconds.
+// The default is DefaultTimeHeader; an empty name disables the header.
+func WithTimeHeader(name string) func(*TimeOptions) {
+	return func(opts *TimeOptions) {
+		opts.Header = name
+	}
 }
 
-func (cw customWriter) WriteHeader(code int) {
-	if cw.before != nil {
-		cw.before()
+// WithTimePrecision sets the precision of reported durations, which are
+// always in milliseconds: time.Millisecond, the default, gives "12" and
+// time.Microsecond gives "12.345".
+func WithTimePrecision(precision time.Duration) func(*TimeOptions) {
+	return func(opts *TimeOptions) {
+		opts.Precision = precision
 	}
-	cw.w.WriteHeader(code)
 }
 
-func (cw customWriter) Write(b []byte) (int, error) {
-	if cw.before != nil {
-		cw.before()
+// WithServerTiming adds a W3C Server-Timing header with a "total" metric
+// and the spans recorded with RecordTiming and StartTiming.
+func WithServerTiming() func(*TimeOptions) {
+	return func(opts *TimeOptions) {
+		opts.ServerTiming = true
 	}
-	return cw.w.Write(b)
 }
 
-func (cw customWriter) Header() http.Header {
-	return cw.w.Header()
+// WithSlowRequest calls fn after every request that took at least
+// threshold, for example to log it.
+func WithSlowRequest(threshold time.Duration, fn func(r *http.Request, taken time.Duration)) func(*TimeOptions) {
+	return func(opts *TimeOptions) {
+		opts.SlowThreshold = threshold
+		opts.OnSlow = fn
+	}
 }
 
-func Time() router.Middleware {
+// Time reports the time taken by the handler in a response header, measured
+// when the header is sent or, if the handler writes nothing, when it
+// returns.
+func Time(options ...TimeOption) router.Middleware {
+
+	opts := &TimeOptions{
+		Header:    DefaultTimeHeader,
+		Precision: time.Millisecond,
+	}
+
+	for _, option := range options {
+		option(opts)
+	}
+
 	return func(next http.HandlerFunc) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
 
 			start := time.Now()
-			writtenHeader := false
-
-			cw := customWriter{
-				w: w,
-				before: func() {
-					if writtenHeader {
-						return
-					}
-					writtenHeader = true
-
-					taken := time.Since(start)
-					w.Header().Set("X-Request-Time-Ms", strconv.FormatInt(taken.Milliseconds(), 10))
-				},
+
+			var timings *serverTimings
+			if opts.ServerTiming {
+				timings = &serverTimings{}
+				r = r.WithContext(context.WithValue(r.Context(), serverTimingKey, timings))
 			}
 
-			next(cw, r)
+			rw := NewResponseWriter(w)
+
+			setHeaders := func() {
+
+				taken := time.Since(start)
+
+				if opts.Header != "" {
+					rw.Header().Set(opts.Header, formatMillis(taken, opts.Precision))
+				}
+
+				if timings != nil {
+					rw.Header().Set("Server-Timing", timings.header(taken, opts.Precision))
+				}
+			}
+
+			rw.OnWriteHeader(func(int) {
+				setHeaders()
+			})
+
+			next(rw, r)
+
+			// The handler wrote nothing, so net/http sends the header after
+			// it returns.
+			if !rw.HeaderWritten() {
+				setHeaders()
+			}
+
+			if opts.OnSlow != nil {
+				if taken := time.Since(start); taken >= opts.SlowThreshold {
+					opts.OnSlow(r, taken)
+				}
+			}
 		}
 	}
 }
+
+type serverTimingContextKey int
+
+const serverTimingKey serverTimingContextKey = iota
+
+type serverTiming struct {
+	name     string
+	duration time.Duration
+}
+
+type serverTimings struct {
+	mu      sync.Mutex
+	metrics []serverTiming
+}
+
+// RecordTiming records a Server-Timing metric named name that took d. It
+// does nothing unless the request is served by Time with WithServerTiming.
+// Metrics recorded after the response header is sent are not reported.
+func RecordTiming(ctx context.Context, name string, d time.Duration) {
+
+	timings, ok := ctx.Value(serverTimingKey).(*serverTimings)
+	if !ok {
+		return
+	}
+
+	timings.mu.Lock()
+	timings.metrics = append(timings.metrics, serverTiming{name: name, duration: d})
+	timings.mu.Unlock()
+}
+
+// StartTiming starts a Server-Timing metric named name and returns the
+// function that records it:
+//
+//	defer middleware.StartTiming(r.Context(), "db")()
+func StartTiming(ctx context.Context, name string) func() {
+
+	start := time.Now()
+
+	return func() {
+		RecordTiming(ctx, name, time.Since(start))
+	}
+}
+
+func (t *serverTimings) header(total time.Duration, precision time.Duration) string {
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var sb strings.Builder
+
+	for _, m := range t.metrics {
+		sb.WriteString(timingName(m.name))
+		sb.WriteString(";dur=")
+		sb.WriteString(formatMillis(m.duration, precision))
+		sb.WriteString(", ")
+	}
+
+	sb.WriteString("total;dur=")
+	sb.WriteString(formatMillis(total, precision))
+
+	return sb.String()
+}
+
+// timingName replaces the characters that are not allowed in a metric name,
+// which is an HTTP token.
+func timingName(name string) string {
+
+	if name == "" {
+		return "_"
+	}
+
+	return strings.Map(func(c rune) rune {
+		if c > 0x7e || c <= ' ' || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, c) {
+			return '_'
+		}
+		return c
+	}, name)
+}
+
+// formatMillis formats d in milliseconds with as many decimals as needed to
+// show precision.
+func formatMillis(d, precision time.Duration) string {
+
+	if precision <= 0 {
+		precision = time.Nanosecond
+	}
+
+	decimals := 0
+	for p := time.Millisecond; p > precision && decimals < 6; p /= 10 {
+		decimals++
+	}
+
+	d = d.Round(precision)
+
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', decimals, 64)
+}
@@ -3,7 +3,9 @@ package middleware
 import (
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestTime(t *testing.T) {
@@ -30,3 +32,96 @@ func TestTime(t *testing.T) {
 		t.Error("X-Request-Time-Ms header is not set")
 	}
 }
+
+func TestTime_HandlerWritesNothing(t *testing.T) {
+
+	srv := httptest.NewServer(Time()(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("response code is: %d, expected: %d", res.StatusCode, http.StatusOK)
+	}
+
+	if res.Header.Get("X-Request-Time-Ms") == "" {
+		t.Error("X-Request-Time-Ms header is not set")
+	}
+}
+
+func TestTime_Options(t *testing.T) {
+
+	var slow time.Duration
+
+	m := Time(
+		WithTimeHeader("X-Response-Time"),
+		WithTimePrecision(time.Microsecond),
+		WithServerTiming(),
+		WithSlowRequest(time.Millisecond, func(r *http.Request, taken time.Duration) {
+			slow = taken
+		}),
+	)
+
+	handler := m(func(w http.ResponseWriter, r *http.Request) {
+		RecordTiming(r.Context(), "db", 12300*time.Microsecond)
+		RecordTiming(r.Context(), "cache miss", 0)
+		stop := StartTiming(r.Context(), "render")
+		time.Sleep(2 * time.Millisecond)
+		stop()
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+
+	handler(w, req)
+
+	if w.Header().Get("X-Request-Time-Ms") != "" {
+		t.Error("X-Request-Time-Ms header is set")
+	}
+
+	value := w.Header().Get("X-Response-Time")
+	if _, decimals, ok := strings.Cut(value, "."); !ok || len(decimals) != 3 {
+		t.Errorf("X-Response-Time is: %s, expected microsecond precision", value)
+	}
+
+	timing := w.Header().Get("Server-Timing")
+	for _, expected := range []string{"db;dur=12.300, ", "cache_miss;dur=0.000, ", "render;dur=", "total;dur="} {
+		if !strings.Contains(timing, expected) {
+			t.Errorf("Server-Timing is: %s, expected it to contain: %s", timing, expected)
+		}
+	}
+
+	if slow < 2*time.Millisecond {
+		t.Errorf("slow request callback got: %s, expected at least 2ms", slow)
+	}
+
+	// Recording without the middleware is a no-op.
+	RecordTiming(req.Context(), "db", time.Second)
+}
+
+func TestFormatMillis(t *testing.T) {
+
+	tests := []struct {
+		d         time.Duration
+		precision time.Duration
+		expected  string
+	}{
+		{d: 12345678 * time.Nanosecond, precision: time.Millisecond, expected: "12"},
+		{d: 12545678 * time.Nanosecond, precision: time.Millisecond, expected: "13"},
+		{d: 12345678 * time.Nanosecond, precision: 100 * time.Microsecond, expected: "12.3"},
+		{d: 12345678 * time.Nanosecond, precision: time.Microsecond, expected: "12.346"},
+		{d: 12345678 * time.Nanosecond, precision: time.Nanosecond, expected: "12.345678"},
+		{d: 1500 * time.Millisecond, precision: time.Second, expected: "2000"},
+	}
+
+	for _, tc := range tests {
+		if actual := formatMillis(tc.d, tc.precision); actual != tc.expected {
+			t.Errorf("formatMillis(%s, %s) is: %s, expected: %s", tc.d, tc.precision, actual, tc.expected)
+		}
+	}
+}
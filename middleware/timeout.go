@@ -0,0 +1,294 @@
+package middleware
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ironfang-ltd/go-router"
+)
+
+// TimeoutKey is the route metadata key of a time.Duration replacing the
+// timeout of Timeout for the route. A duration of zero or less disables
+// the timeout, for example for long polling:
+//
+//	r.Post("/reports", generate).Meta(middleware.TimeoutKey, 2*time.Minute)
+const TimeoutKey = "timeout"
+
+type TimeoutOption func(*TimeoutOptions)
+
+type TimeoutOptions struct {
+	Handler http.HandlerFunc
+}
+
+// WithTimeoutHandler sets the handler answering requests whose handler
+// overran the timeout. Its request context is done. The default writes the
+// context error with router.WriteError, a 504 Gateway Timeout; handlers
+// may answer with 503 Service Unavailable instead.
+func WithTimeoutHandler(handler http.HandlerFunc) func(*TimeoutOptions) {
+	return func(opts *TimeoutOptions) {
+		opts.Handler = handler
+	}
+}
+
+// Timeout gives the handler d to serve the request: the request context is
+// cancelled after d and, if the handler has not answered by then, the
+// timeout handler does. The handler runs in its own goroutine and writes
+// through a guarded writer, so nothing it writes after the timeout reaches
+// the client; it should return once its context is done. Streaming
+// handlers keep Flush. If the handler is still running at the deadline but
+// has already sent the header, the response is aborted rather than ended
+// as if it were complete. Like the other middleware, the writer keeps the
+// optional interfaces of the underlying one: ReadFrom and Hijack are
+// guarded too, and http.ResponseController reaches the rest, such as
+// SetWriteDeadline, through Unwrap.
+//
+// Routes can set their own timeout with the TimeoutKey metadata. Add
+// Timeout with Use, so the route is known. Panics of the handler are
+// raised again in the serving goroutine, where Recover can catch them.
+func Timeout(d time.Duration, options ...TimeoutOption) router.Middleware {
+
+	opts := &TimeoutOptions{
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			router.WriteError(w, r, r.Context().Err())
+		},
+	}
+
+	for _, option := range options {
+		option(opts)
+	}
+
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+
+			timeout := d
+			if v, ok := router.MetaFromContext[time.Duration](r.Context(), TimeoutKey); ok {
+				timeout = v
+			}
+
+			if timeout <= 0 {
+				next(w, r)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+
+			r = r.WithContext(ctx)
+
+			tw := &timeoutWriter{
+				w:   w,
+				h:   w.Header().Clone(),
+				ctx: ctx,
+			}
+
+			done := make(chan struct{})
+			panicked := make(chan any, 1)
+
+			go func() {
+				defer func() {
+					if rec := recover(); rec != nil {
+						panicked <- rec
+					}
+				}()
+
+				next(tw, r)
+
+				// The response is complete if no write was refused and the
+				// handler either answered or returned before the deadline.
+				// A handler returning after it without answering is
+				// answered by the timeout handler.
+				tw.mu.Lock()
+				tw.completed = tw.hijacked || !tw.timedOut && (tw.wroteHeader || ctx.Err() == nil)
+				if tw.completed && !tw.wroteHeader {
+					tw.copyHeader()
+				}
+				tw.mu.Unlock()
+
+				close(done)
+			}()
+
+			select {
+			case rec := <-panicked:
+				panic(rec)
+			case <-done:
+			case <-ctx.Done():
+			}
+
+			tw.mu.Lock()
+			defer tw.mu.Unlock()
+
+			// A hijacked connection belongs to the handler.
+			if tw.completed || tw.hijacked {
+				return
+			}
+
+			tw.timedOut = true
+
+			if tw.wroteHeader {
+				panic(http.ErrAbortHandler)
+			}
+
+			opts.Handler(w, r)
+		}
+	}
+}
+
+// timeoutWriter guards the response writer of a handler run by Timeout.
+// The handler gets its own header map, copied when the header is written,
+// so the timeout handler can use the original one without racing it.
+type timeoutWriter struct {
+	w   http.ResponseWriter
+	h   http.Header
+	ctx context.Context
+
+	mu          sync.Mutex
+	wroteHeader bool
+	timedOut    bool
+	completed   bool
+	hijacked    bool
+}
+
+// refused reports whether the handler may no longer write, because its
+// deadline has passed. It must be called with tw.mu held.
+func (tw *timeoutWriter) refused() bool {
+
+	if tw.ctx.Err() != nil {
+		tw.timedOut = true
+	}
+
+	return tw.timedOut
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.h
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.refused() {
+		return
+	}
+
+	tw.writeHeader(code)
+}
+
+// writeHeader must be called with tw.mu held.
+func (tw *timeoutWriter) writeHeader(code int) {
+
+	if tw.wroteHeader {
+		return
+	}
+
+	tw.copyHeader()
+	tw.w.WriteHeader(code)
+
+	// Informational responses may precede the final one.
+	if code >= 100 && code <= 199 && code != http.StatusSwitchingProtocols {
+		return
+	}
+
+	tw.wroteHeader = true
+}
+
+// copyHeader replaces the header of the underlying writer with the header
+// of the handler. It must be called with tw.mu held.
+func (tw *timeoutWriter) copyHeader() {
+
+	dst := tw.w.Header()
+	clear(dst)
+
+	for k, v := range tw.h {
+		dst[k] = v
+	}
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.refused() {
+		return 0, http.ErrHandlerTimeout
+	}
+
+	tw.writeHeader(http.StatusOK)
+
+	return tw.w.Write(b)
+}
+
+// Flush sends the buffered data to the client, unless the handler timed
+// out. It is what keeps streaming handlers working under Timeout, unlike
+// http.TimeoutHandler.
+func (tw *timeoutWriter) Flush() {
+	_ = tw.FlushError()
+}
+
+// FlushError is used by http.ResponseController.
+func (tw *timeoutWriter) FlushError() error {
+
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.refused() {
+		return http.ErrHandlerTimeout
+	}
+
+	tw.writeHeader(http.StatusOK)
+
+	return http.NewResponseController(tw.w).Flush()
+}
+
+// ReadFrom copies src to the client, with the underlying writer's
+// io.ReaderFrom when available, unless the handler timed out. The copy holds
+// the guard, so the deadline is enforced between copies rather than during
+// one.
+func (tw *timeoutWriter) ReadFrom(src io.Reader) (int64, error) {
+
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.refused() {
+		return 0, http.ErrHandlerTimeout
+	}
+
+	tw.writeHeader(http.StatusOK)
+
+	if rf, ok := tw.w.(io.ReaderFrom); ok {
+		return rf.ReadFrom(src)
+	}
+
+	return io.Copy(writerOnly{tw.w}, src)
+}
+
+// Hijack hands the connection over to the handler, unless it timed out.
+// Once hijacked, Timeout no longer answers the request.
+func (tw *timeoutWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.refused() {
+		return nil, nil, http.ErrHandlerTimeout
+	}
+
+	conn, brw, err := http.NewResponseController(tw.w).Hijack()
+	if err == nil {
+		tw.hijacked = true
+	}
+
+	return conn, brw, err
+}
+
+// Unwrap returns the underlying http.ResponseWriter, for
+// http.ResponseController. Writing to it directly bypasses the guard.
+func (tw *timeoutWriter) Unwrap() http.ResponseWriter {
+	return tw.w
+}
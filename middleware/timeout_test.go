@@ -0,0 +1,255 @@
+package middleware
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ironfang-ltd/go-router"
+)
+
+func TestTimeout(t *testing.T) {
+
+	lateWrite := make(chan error, 1)
+
+	r := router.New()
+	r.Use(Timeout(20 * time.Millisecond))
+
+	r.Get("/fast", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Handler", "fast")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("done"))
+	})
+
+	r.Get("/empty", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Handler", "empty")
+	})
+
+	r.Get("/slow", func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		w.Header().Set("X-Handler", "slow")
+		_, err := w.Write([]byte("late"))
+		lateWrite <- err
+	})
+
+	r.Get("/report", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(40 * time.Millisecond)
+		_, _ = w.Write([]byte("report"))
+	}).Meta(TimeoutKey, time.Second)
+
+	r.Get("/poll", func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Deadline(); ok {
+			t.Error("the request has a deadline")
+		}
+		time.Sleep(40 * time.Millisecond)
+		_, _ = w.Write([]byte("poll"))
+	}).Meta(TimeoutKey, time.Duration(0))
+
+	tests := []struct {
+		path    string
+		status  int
+		body    string
+		handler string
+	}{
+		{path: "/fast", status: http.StatusCreated, body: "done", handler: "fast"},
+		{path: "/empty", status: http.StatusOK, handler: "empty"},
+		{path: "/slow", status: http.StatusGatewayTimeout, body: "Gateway Timeout\n"},
+		{path: "/report", status: http.StatusOK, body: "report"},
+		{path: "/poll", status: http.StatusOK, body: "poll"},
+	}
+
+	for _, tc := range tests {
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", tc.path, nil))
+
+		if w.Code != tc.status {
+			t.Errorf("%s: response code is: %d, expected: %d", tc.path, w.Code, tc.status)
+		}
+
+		if w.Body.String() != tc.body {
+			t.Errorf("%s: body is: %q, expected: %q", tc.path, w.Body.String(), tc.body)
+		}
+
+		if w.Header().Get("X-Handler") != tc.handler {
+			t.Errorf("%s: X-Handler is: %s, expected: %s", tc.path, w.Header().Get("X-Handler"), tc.handler)
+		}
+	}
+
+	select {
+	case err := <-lateWrite:
+		if !errors.Is(err, http.ErrHandlerTimeout) {
+			t.Errorf("late write error is: %v, expected: %v", err, http.ErrHandlerTimeout)
+		}
+	case <-time.After(time.Second):
+		t.Error("the slow handler did not return")
+	}
+}
+
+func TestTimeout_Handler(t *testing.T) {
+
+	handler := Timeout(time.Millisecond, WithTimeoutHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/", nil))
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("response code is: %d, expected: %d", w.Code, http.StatusServiceUnavailable)
+	}
+
+	if w.Header().Get("Retry-After") != "1" {
+		t.Errorf("Retry-After is: %s, expected: 1", w.Header().Get("Retry-After"))
+	}
+}
+
+func TestTimeout_Streaming(t *testing.T) {
+
+	srv := httptest.NewServer(Timeout(50 * time.Millisecond)(func(w http.ResponseWriter, r *http.Request) {
+
+		if _, ok := w.(http.Flusher); !ok {
+			t.Error("the writer is not a Flusher")
+		}
+
+		_, _ = w.Write([]byte("first"))
+		if err := http.NewResponseController(w).Flush(); err != nil {
+			t.Error(err)
+		}
+
+		// Still streaming at the deadline.
+		<-r.Context().Done()
+		time.Sleep(50 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("response code is: %d, expected: %d", res.StatusCode, http.StatusOK)
+	}
+
+	// The first chunk was flushed before the timeout, after which the
+	// response is aborted instead of being ended cleanly.
+	body, err := io.ReadAll(res.Body)
+
+	if string(body) != "first" {
+		t.Errorf("body is: %q, expected: %q", body, "first")
+	}
+
+	if err == nil {
+		t.Error("the response was not aborted")
+	}
+}
+
+func TestTimeout_ResponseController(t *testing.T) {
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/copy", Timeout(time.Second)(func(w http.ResponseWriter, r *http.Request) {
+
+		if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(time.Second)); err != nil {
+			t.Errorf("SetWriteDeadline failed: %v", err)
+		}
+
+		if _, ok := w.(io.ReaderFrom); !ok {
+			t.Error("the writer is not a ReaderFrom")
+		}
+
+		_, _ = io.Copy(w, strings.NewReader("copied"))
+	}))
+
+	mux.HandleFunc("/hijack", Timeout(time.Second)(func(w http.ResponseWriter, r *http.Request) {
+
+		conn, brw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			t.Errorf("Hijack failed: %v", err)
+			return
+		}
+		defer conn.Close()
+
+		_, _ = brw.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 8\r\nConnection: close\r\n\r\nhijacked")
+		_ = brw.Flush()
+	}))
+
+	mux.HandleFunc("/late", Timeout(20*time.Millisecond)(func(w http.ResponseWriter, r *http.Request) {
+
+		<-r.Context().Done()
+
+		if _, err := w.(io.ReaderFrom).ReadFrom(strings.NewReader("late")); !errors.Is(err, http.ErrHandlerTimeout) {
+			t.Errorf("ReadFrom error is: %v, expected: %v", err, http.ErrHandlerTimeout)
+		}
+
+		if _, _, err := http.NewResponseController(w).Hijack(); !errors.Is(err, http.ErrHandlerTimeout) {
+			t.Errorf("Hijack error is: %v, expected: %v", err, http.ErrHandlerTimeout)
+		}
+	}))
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	tests := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{path: "/copy", status: http.StatusOK, body: "copied"},
+		{path: "/hijack", status: http.StatusOK, body: "hijacked"},
+		{path: "/late", status: http.StatusGatewayTimeout},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+
+		t.Run(tc.path, func(t *testing.T) {
+
+			res, err := http.Get(srv.URL + tc.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode != tc.status {
+				t.Errorf("response code is: %d, expected: %d", res.StatusCode, tc.status)
+			}
+
+			body, _ := io.ReadAll(res.Body)
+
+			if tc.body != "" && string(body) != tc.body {
+				t.Errorf("response body is: %s, expected: %s", body, tc.body)
+			}
+		})
+	}
+}
+
+func TestTimeout_Panic(t *testing.T) {
+
+	r := router.New()
+	r.Use(
+		Recover(WithRecoverLogger(slog.New(slog.NewTextHandler(io.Discard, nil))), WithRecoverStack(false)),
+		Timeout(time.Second),
+	)
+
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		panic("something broke")
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("response code is: %d, expected: %d", w.Code, http.StatusInternalServerError)
+	}
+}
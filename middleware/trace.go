@@ -0,0 +1,507 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ironfang-ltd/go-router"
+)
+
+// Trace context headers, as defined by the W3C Trace Context recommendation.
+const (
+	TraceparentHeader = "traceparent"
+	TracestateHeader  = "tracestate"
+)
+
+type TraceOption func(*TraceOptions)
+
+type TraceOptions struct {
+	Exporter      SpanExporter
+	SampleRate    float64
+	TrustIncoming bool
+}
+
+// WithTraceExporter sets the exporter spans are sent to when they end.
+// Without one, trace context is still propagated but spans are dropped.
+func WithTraceExporter(exporter SpanExporter) func(*TraceOptions) {
+	return func(opts *TraceOptions) {
+		opts.Exporter = exporter
+	}
+}
+
+// WithTraceSampleRate sets the fraction, between 0 and 1, of new traces
+// that are sampled. Requests continuing a trace follow the sampling
+// decision of their parent. The default is 1.
+func WithTraceSampleRate(rate float64) func(*TraceOptions) {
+	return func(opts *TraceOptions) {
+		opts.SampleRate = rate
+	}
+}
+
+// WithTrustIncomingTrace sets whether the traceparent and tracestate
+// headers sent by clients are continued. The default is true; services
+// facing untrusted clients may always start new traces.
+func WithTrustIncomingTrace(trust bool) func(*TraceOptions) {
+	return func(opts *TraceOptions) {
+		opts.TrustIncoming = trust
+	}
+}
+
+// Trace starts a server span for every request, continuing the trace of the
+// traceparent and tracestate request headers when they are valid and
+// starting a new trace otherwise. The span is stored in the request
+// context, where SpanFromContext and TraceTransport find it.
+//
+// The span is named after the method and route pattern, such as
+// "GET /users/:id", and records the response status. Responses with a 5xx
+// status, errors passed to Span.RecordError and panics mark it as failed.
+// Wrap the router with it, using router.WithRouteContext, to trace
+// requests that match no route, which are named after the method only.
+func Trace(options ...TraceOption) router.Middleware {
+
+	opts := &TraceOptions{
+		SampleRate:    1,
+		TrustIncoming: true,
+	}
+
+	for _, option := range options {
+		option(opts)
+	}
+
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+
+			span := &Span{
+				Kind:       SpanKindServer,
+				StartTime:  time.Now(),
+				Attributes: make(map[string]any),
+			}
+
+			parent, ok := SpanContext{}, false
+			if opts.TrustIncoming {
+				parent, ok = ParseTraceparent(r.Header.Get(TraceparentHeader))
+			}
+
+			if ok {
+				span.SpanContext = SpanContext{
+					TraceID: parent.TraceID,
+					Flags:   parent.Flags & TraceFlagSampled,
+					State:   parseTracestate(r.Header.Values(TracestateHeader)),
+				}
+				span.ParentSpanID = parent.SpanID
+			} else {
+				span.SpanContext.TraceID = newTraceID()
+				if sampled(opts.SampleRate) {
+					span.SpanContext.Flags = TraceFlagSampled
+				}
+			}
+
+			span.SpanContext.SpanID = newSpanID()
+
+			span.SetAttribute("http.request.method", r.Method)
+			span.SetAttribute("url.path", r.URL.Path)
+			if ip := remoteIP(r); ip != "" {
+				span.SetAttribute("client.address", ip)
+			}
+			if ua := r.UserAgent(); ua != "" {
+				span.SetAttribute("user_agent.original", ua)
+			}
+
+			r = router.WithRouteContext(r)
+			r = r.WithContext(context.WithValue(r.Context(), spanKey, span))
+
+			rw := NewResponseWriter(w)
+
+			defer func() {
+
+				rec := recover()
+				if rec != nil && rec != http.ErrAbortHandler {
+					span.RecordError(fmt.Errorf("panic: %v", rec))
+				}
+
+				span.end(r, rw.Status())
+
+				if opts.Exporter != nil && span.SpanContext.Sampled() {
+					opts.Exporter.ExportSpan(span.snapshot())
+				}
+
+				if rec != nil {
+					panic(rec)
+				}
+			}()
+
+			next(rw, r)
+		}
+	}
+}
+
+func sampled(rate float64) bool {
+
+	if rate >= 1 {
+		return true
+	}
+
+	if rate <= 0 {
+		return false
+	}
+
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+
+	var n uint64
+	for _, c := range b {
+		n = n<<8 | uint64(c)
+	}
+
+	return float64(n>>11)/float64(1<<53) < rate
+}
+
+type spanContextKey int
+
+const spanKey spanContextKey = iota
+
+// SpanFromContext returns the span started by Trace for the request, or
+// nil. The methods of Span do nothing on a nil span, so the result can be
+// used without checking it.
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey).(*Span)
+	return span
+}
+
+// TraceFlagSampled is the trace flag set when the trace is recorded.
+const TraceFlagSampled byte = 0x01
+
+// TraceID identifies a trace.
+type TraceID [16]byte
+
+func (id TraceID) IsValid() bool {
+	return id != TraceID{}
+}
+
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// SpanID identifies a span within a trace.
+type SpanID [8]byte
+
+func (id SpanID) IsValid() bool {
+	return id != SpanID{}
+}
+
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	for !id.IsValid() {
+		_, _ = rand.Read(id[:])
+	}
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	for !id.IsValid() {
+		_, _ = rand.Read(id[:])
+	}
+	return id
+}
+
+// SpanContext is the part of a span propagated to other services.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Flags   byte
+	State   string
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+func (sc SpanContext) Sampled() bool {
+	return sc.Flags&TraceFlagSampled != 0
+}
+
+// Traceparent formats sc as a version 00 traceparent header value.
+func (sc SpanContext) Traceparent() string {
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + hex.EncodeToString([]byte{sc.Flags})
+}
+
+// ParseTraceparent parses a traceparent header value. It reports false if
+// the value is malformed or carries an all-zero trace or span ID. Values of
+// versions after 00 are parsed as far as version 00 defines them.
+func ParseTraceparent(value string) (SpanContext, bool) {
+
+	var sc SpanContext
+
+	value = strings.TrimSpace(value)
+
+	if len(value) < 55 || value[2] != '-' || value[35] != '-' || value[52] != '-' {
+		return sc, false
+	}
+
+	version, ok := decodeHex(value[0:2])
+	if !ok || version[0] == 0xff || version[0] == 0 && len(value) != 55 || len(value) > 55 && value[55] != '-' {
+		return sc, false
+	}
+
+	traceID, ok := decodeHex(value[3:35])
+	if !ok {
+		return sc, false
+	}
+
+	spanID, ok := decodeHex(value[36:52])
+	if !ok {
+		return sc, false
+	}
+
+	flags, ok := decodeHex(value[53:55])
+	if !ok {
+		return sc, false
+	}
+
+	copy(sc.TraceID[:], traceID)
+	copy(sc.SpanID[:], spanID)
+	sc.Flags = flags[0]
+
+	return sc, sc.IsValid()
+}
+
+// decodeHex decodes lowercase hexadecimal, as required by traceparent.
+func decodeHex(s string) ([]byte, bool) {
+
+	if strings.ToLower(s) != s {
+		return nil, false
+	}
+
+	b, err := hex.DecodeString(s)
+
+	return b, err == nil
+}
+
+// parseTracestate joins the tracestate header lines and drops empty
+// members. Invalid values are dropped entirely, as the recommendation
+// requires, rather than being forwarded.
+func parseTracestate(values []string) string {
+
+	var members []string
+
+	for _, value := range values {
+		for _, member := range strings.Split(value, ",") {
+
+			member = strings.TrimSpace(member)
+			if member == "" {
+				continue
+			}
+
+			key, val, ok := strings.Cut(member, "=")
+			if !ok || key == "" || val == "" || len(key) > 256 || len(val) > 256 {
+				return ""
+			}
+
+			members = append(members, member)
+		}
+	}
+
+	if len(members) > 32 {
+		return ""
+	}
+
+	return strings.Join(members, ",")
+}
+
+type SpanKind int
+
+const (
+	SpanKindServer SpanKind = iota + 1
+	SpanKindClient
+)
+
+func (k SpanKind) String() string {
+	switch k {
+	case SpanKindServer:
+		return "server"
+	case SpanKindClient:
+		return "client"
+	}
+	return "unspecified"
+}
+
+type SpanStatusCode int
+
+const (
+	SpanStatusUnset SpanStatusCode = iota
+	SpanStatusOK
+	SpanStatusError
+)
+
+func (c SpanStatusCode) String() string {
+	switch c {
+	case SpanStatusOK:
+		return "ok"
+	case SpanStatusError:
+		return "error"
+	}
+	return "unset"
+}
+
+// SpanEvent is a timestamped annotation of a span, such as a recorded
+// error.
+type SpanEvent struct {
+	Name       string
+	Time       time.Time
+	Attributes map[string]any
+}
+
+// Span is an operation within a trace. The spans given to exporters are
+// snapshots that are no longer modified.
+type Span struct {
+	Name          string
+	Kind          SpanKind
+	SpanContext   SpanContext
+	ParentSpanID  SpanID
+	StartTime     time.Time
+	EndTime       time.Time
+	Attributes    map[string]any
+	Events        []SpanEvent
+	Status        SpanStatusCode
+	StatusMessage string
+
+	mu sync.Mutex
+}
+
+// SetAttribute sets an attribute of the span. Values should be strings,
+// booleans, integers or floats.
+func (s *Span) SetAttribute(key string, value any) {
+
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.Attributes[key] = value
+	s.mu.Unlock()
+}
+
+// RecordError adds an "exception" event for err to the span and marks it
+// as failed.
+func (s *Span) RecordError(err error) {
+
+	if s == nil || err == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Events = append(s.Events, SpanEvent{
+		Name: "exception",
+		Time: time.Now(),
+		Attributes: map[string]any{
+			"exception.type":    fmt.Sprintf("%T", err),
+			"exception.message": err.Error(),
+		},
+	})
+
+	s.Status = SpanStatusError
+	s.StatusMessage = err.Error()
+}
+
+// Context returns the propagated context of the span, or the zero
+// SpanContext for a nil span.
+func (s *Span) Context() SpanContext {
+
+	if s == nil {
+		return SpanContext{}
+	}
+
+	return s.SpanContext
+}
+
+// end names the span after the route r matched and records the status.
+func (s *Span) end(r *http.Request, status int) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.EndTime = time.Now()
+
+	s.Name = r.Method
+	if pattern := router.PatternFromContext(r.Context()); pattern != "" {
+		s.Name += " " + pattern
+		s.Attributes["http.route"] = pattern
+	}
+
+	s.Attributes["http.response.status_code"] = status
+
+	if status >= 500 && s.Status != SpanStatusError {
+		s.Status = SpanStatusError
+		s.StatusMessage = http.StatusText(status)
+	}
+}
+
+// snapshot returns a copy of the span that later calls on s do not modify.
+func (s *Span) snapshot() *Span {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attributes := make(map[string]any, len(s.Attributes))
+	for k, v := range s.Attributes {
+		attributes[k] = v
+	}
+
+	return &Span{
+		Name:          s.Name,
+		Kind:          s.Kind,
+		SpanContext:   s.SpanContext,
+		ParentSpanID:  s.ParentSpanID,
+		StartTime:     s.StartTime,
+		EndTime:       s.EndTime,
+		Attributes:    attributes,
+		Events:        append([]SpanEvent(nil), s.Events...),
+		Status:        s.Status,
+		StatusMessage: s.StatusMessage,
+	}
+}
+
+// Duration returns the time between the start and the end of the span.
+func (s *Span) Duration() time.Duration {
+	return s.EndTime.Sub(s.StartTime)
+}
+
+// TraceTransport is an http.RoundTripper that propagates the trace of the
+// outgoing request's context to the next service, in the traceparent and
+// tracestate headers.
+type TraceTransport struct {
+	// Base is the transport making the requests. If nil,
+	// http.DefaultTransport is used.
+	Base http.RoundTripper
+}
+
+func (t *TraceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	if sc := SpanFromContext(req.Context()).Context(); sc.IsValid() && req.Header.Get(TraceparentHeader) == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set(TraceparentHeader, sc.Traceparent())
+		if sc.State != "" {
+			req.Header.Set(TracestateHeader, sc.State)
+		}
+	}
+
+	return base.RoundTrip(req)
+}
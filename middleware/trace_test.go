@@ -0,0 +1,398 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ironfang-ltd/go-router"
+)
+
+const testTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestParseTraceparent(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		value string
+		valid bool
+	}{
+		{name: "Valid", value: testTraceparent, valid: true},
+		{name: "NotSampled", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", valid: true},
+		{name: "FutureVersion", value: "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", valid: true},
+		{name: "Empty", value: ""},
+		{name: "Uppercase", value: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01"},
+		{name: "ZeroTraceID", value: "00-00000000000000000000000000000000-00f067aa0ba902b7-01"},
+		{name: "ZeroSpanID", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01"},
+		{name: "InvalidVersion", value: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		{name: "TrailingData", value: testTraceparent + "-extra"},
+		{name: "Separator", value: "00-4bf92f3577b34da6a3ce929d0e0e4736_00f067aa0ba902b7-01"},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+
+			sc, ok := ParseTraceparent(tc.value)
+
+			if ok != tc.valid {
+				t.Fatalf("valid is: %t, expected: %t", ok, tc.valid)
+			}
+
+			if ok && sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+				t.Errorf("trace id is: %s", sc.TraceID)
+			}
+		})
+	}
+
+	sc, _ := ParseTraceparent(testTraceparent)
+	if sc.Traceparent() != testTraceparent {
+		t.Errorf("traceparent is: %s, expected: %s", sc.Traceparent(), testTraceparent)
+	}
+}
+
+func newTracedRouter(exporter SpanExporter, options ...TraceOption) http.HandlerFunc {
+
+	r := router.New()
+
+	r.Get("/users/:id", func(w http.ResponseWriter, r *http.Request) {
+		SpanFromContext(r.Context()).SetAttribute("user.id", r.PathValue("id"))
+		_, _ = w.Write([]byte("user"))
+	})
+
+	r.Get("/fail", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	r.Get("/error", func(w http.ResponseWriter, r *http.Request) {
+		SpanFromContext(r.Context()).RecordError(errors.New("query failed"))
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	r.Get("/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("something broke")
+	})
+
+	options = append([]TraceOption{WithTraceExporter(exporter)}, options...)
+
+	return Trace(options...)(r.ServeHTTP)
+}
+
+func TestTrace(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		path     string
+		span     string
+		status   SpanStatusCode
+		message  string
+		events   int
+		panicked bool
+	}{
+		{name: "Route", path: "/users/7", span: "GET /users/:id", status: SpanStatusUnset},
+		{name: "NotFound", path: "/missing", span: "GET", status: SpanStatusUnset},
+		{name: "ServerError", path: "/fail", span: "GET /fail", status: SpanStatusError, message: "Bad Gateway"},
+		{name: "RecordedError", path: "/error", span: "GET /error", status: SpanStatusError, message: "query failed", events: 1},
+		{name: "Panic", path: "/panic", span: "GET /panic", status: SpanStatusError, message: "panic: something broke", events: 1, panicked: true},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+
+			exporter := NewInMemoryExporter()
+			handler := newTracedRouter(exporter)
+
+			func() {
+				defer func() {
+					if rec := recover(); (rec != nil) != tc.panicked {
+						t.Errorf("panic is: %v, expected panic: %t", rec, tc.panicked)
+					}
+				}()
+				handler(httptest.NewRecorder(), httptest.NewRequest("GET", tc.path, nil))
+			}()
+
+			spans := exporter.Spans()
+			if len(spans) != 1 {
+				t.Fatalf("expected 1 span, got: %d", len(spans))
+			}
+
+			span := spans[0]
+
+			if span.Name != tc.span {
+				t.Errorf("span name is: %s, expected: %s", span.Name, tc.span)
+			}
+
+			if span.Status != tc.status || span.StatusMessage != tc.message {
+				t.Errorf("status is: %s %q, expected: %s %q", span.Status, span.StatusMessage, tc.status, tc.message)
+			}
+
+			if len(span.Events) != tc.events {
+				t.Errorf("events are: %v", span.Events)
+			}
+
+			if span.Kind != SpanKindServer || !span.SpanContext.IsValid() || span.ParentSpanID.IsValid() {
+				t.Errorf("span is not a new server span: %+v", span)
+			}
+
+			if span.EndTime.Before(span.StartTime) {
+				t.Errorf("span ends before it starts")
+			}
+		})
+	}
+}
+
+func TestTrace_Attributes(t *testing.T) {
+
+	exporter := NewInMemoryExporter()
+
+	req := httptest.NewRequest("GET", "/users/7", nil)
+	req.RemoteAddr = "203.0.113.9:51234"
+
+	newTracedRouter(exporter)(httptest.NewRecorder(), req)
+
+	span := exporter.Spans()[0]
+
+	expected := map[string]any{
+		"http.request.method":       "GET",
+		"http.route":                "/users/:id",
+		"http.response.status_code": 200,
+		"url.path":                  "/users/7",
+		"client.address":            "203.0.113.9",
+		"user.id":                   "7",
+	}
+
+	for key, value := range expected {
+		if span.Attributes[key] != value {
+			t.Errorf("%s is: %v, expected: %v", key, span.Attributes[key], value)
+		}
+	}
+}
+
+func TestTrace_Propagation(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		options   []TraceOption
+		parent    string
+		state     []string
+		continued bool
+		exported  bool
+	}{
+		{name: "Continued", parent: testTraceparent, state: []string{"vendor=a", "other=b"}, continued: true, exported: true},
+		{name: "ParentNotSampled", parent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", continued: true},
+		{name: "Invalid", parent: "00-xyz", exported: true},
+		{name: "Untrusted", options: []TraceOption{WithTrustIncomingTrace(false)}, parent: testTraceparent, exported: true},
+		{name: "NotSampled", options: []TraceOption{WithTraceSampleRate(0)}},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+
+			var outgoing http.Header
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				outgoing = r.Header.Clone()
+			}))
+			defer srv.Close()
+
+			client := &http.Client{Transport: &TraceTransport{}}
+
+			exporter := NewInMemoryExporter()
+
+			var sc SpanContext
+
+			handler := Trace(append([]TraceOption{WithTraceExporter(exporter)}, tc.options...)...)(func(w http.ResponseWriter, r *http.Request) {
+				sc = SpanFromContext(r.Context()).Context()
+				req, _ := http.NewRequestWithContext(r.Context(), "GET", srv.URL, nil)
+				res, err := client.Do(req)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				res.Body.Close()
+			})
+
+			req := httptest.NewRequest("GET", "/", nil)
+			if tc.parent != "" {
+				req.Header.Set("traceparent", tc.parent)
+			}
+			for _, state := range tc.state {
+				req.Header.Add("tracestate", state)
+			}
+
+			handler(httptest.NewRecorder(), req)
+
+			continued := sc.TraceID.String() == "4bf92f3577b34da6a3ce929d0e0e4736"
+			if continued != tc.continued {
+				t.Errorf("trace id is: %s, expected continued: %t", sc.TraceID, tc.continued)
+			}
+
+			if outgoing.Get("traceparent") != sc.Traceparent() {
+				t.Errorf("outgoing traceparent is: %s, expected: %s", outgoing.Get("traceparent"), sc.Traceparent())
+			}
+
+			if tc.state != nil && outgoing.Get("tracestate") != "vendor=a,other=b" {
+				t.Errorf("outgoing tracestate is: %s", outgoing.Get("tracestate"))
+			}
+
+			spans := exporter.Spans()
+			if (len(spans) == 1) != tc.exported {
+				t.Fatalf("spans are: %v, expected exported: %t", spans, tc.exported)
+			}
+
+			if tc.exported && tc.continued && spans[0].ParentSpanID.String() != "00f067aa0ba902b7" {
+				t.Errorf("parent span id is: %s", spans[0].ParentSpanID)
+			}
+		})
+	}
+}
+
+func TestJSONExporter(t *testing.T) {
+
+	var buf bytes.Buffer
+
+	req := httptest.NewRequest("GET", "/error", nil)
+	req.Header.Set("traceparent", testTraceparent)
+
+	newTracedRouter(NewJSONExporter(&buf))(httptest.NewRecorder(), req)
+
+	records := readLogRecords(t, &buf)
+	if len(records) != 1 {
+		t.Fatalf("expected 1 line, got: %d", len(records))
+	}
+
+	record := records[0]
+
+	expected := map[string]any{
+		"name":          "GET /error",
+		"kind":          "server",
+		"traceId":       "4bf92f3577b34da6a3ce929d0e0e4736",
+		"parentSpanId":  "00f067aa0ba902b7",
+		"status":        "error",
+		"statusMessage": "query failed",
+	}
+
+	for key, value := range expected {
+		if record[key] != value {
+			t.Errorf("%s is: %v, expected: %v", key, record[key], value)
+		}
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+
+	requests := make(chan map[string]any, 1)
+
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" || r.Header.Get("X-Api-Key") != "key" {
+			t.Errorf("unexpected export request: %s %s", r.URL.Path, r.Header)
+		}
+
+		b, _ := io.ReadAll(r.Body)
+
+		var body map[string]any
+		if err := json.Unmarshal(b, &body); err != nil {
+			t.Error(err)
+		}
+
+		requests <- body
+	}))
+	defer collector.Close()
+
+	exporter := NewOTLPExporter(
+		WithOTLPEndpoint(collector.URL+"/v1/traces"),
+		WithOTLPHeader("X-Api-Key", "key"),
+		WithOTLPServiceName("shop"),
+		WithOTLPBatch(2, time.Hour),
+	)
+
+	handler := newTracedRouter(exporter)
+
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/users/7", nil))
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/fail", nil))
+
+	var body map[string]any
+
+	select {
+	case body = <-requests:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the batch was not exported")
+	}
+
+	b, _ := json.Marshal(body)
+	payload := string(b)
+
+	for _, e := range []string{
+		`"key":"service.name","value":{"stringValue":"shop"}`,
+		`"name":"GET /users/:id"`,
+		`"key":"http.response.status_code","value":{"intValue":"200"}`,
+		`"kind":2`,
+		`"status":{"code":2,"message":"Bad Gateway"}`,
+	} {
+		if !strings.Contains(payload, e) {
+			t.Errorf("export request does not contain %s:\n%s", e, payload)
+		}
+	}
+
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/users/8", nil))
+
+	if err := exporter.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case body = <-requests:
+	default:
+		t.Fatal("the queued span was not exported on shutdown")
+	}
+
+	spans := body["resourceSpans"].([]any)[0].(map[string]any)["scopeSpans"].([]any)[0].(map[string]any)["spans"].([]any)
+	if len(spans) != 1 {
+		t.Errorf("expected 1 span, got: %d", len(spans))
+	}
+}
+
+func TestOTLPExporter_InvalidBatch(t *testing.T) {
+
+	requests := make(chan struct{}, 1)
+
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- struct{}{}
+	}))
+	defer collector.Close()
+
+	exporter := NewOTLPExporter(
+		WithOTLPEndpoint(collector.URL+"/v1/traces"),
+		WithOTLPBatch(0, -time.Second),
+		WithOTLPMaxQueueSize(0),
+	)
+
+	if exporter.opts.BatchSize != DefaultOTLPBatchSize || exporter.opts.Interval != DefaultOTLPInterval || exporter.opts.MaxQueueSize != DefaultOTLPMaxQueueSize {
+		t.Errorf("options are: %+v, expected the defaults", exporter.opts)
+	}
+
+	newTracedRouter(exporter)(httptest.NewRecorder(), httptest.NewRequest("GET", "/users/7", nil))
+
+	if err := exporter.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-requests:
+	default:
+		t.Fatal("the queued span was not exported on shutdown")
+	}
+}
@@ -0,0 +1,544 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SpanExporter receives the spans recorded by Trace. ExportSpan is called
+// on the request goroutine when a sampled span ends, so it must not block
+// on the network; the span is a snapshot the exporter may keep.
+type SpanExporter interface {
+	ExportSpan(span *Span)
+}
+
+// JSONExporter writes every span as a line of JSON.
+type JSONExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewJSONExporter returns an exporter writing spans to w, or to os.Stdout
+// if w is nil.
+func NewJSONExporter(w io.Writer) *JSONExporter {
+
+	if w == nil {
+		w = os.Stdout
+	}
+
+	return &JSONExporter{w: w}
+}
+
+func (e *JSONExporter) ExportSpan(span *Span) {
+
+	b, err := json.Marshal(newJSONSpan(span))
+	if err != nil {
+		return
+	}
+
+	e.mu.Lock()
+	_, _ = e.w.Write(append(b, '\n'))
+	e.mu.Unlock()
+}
+
+type jsonSpan struct {
+	Name         string         `json:"name"`
+	Kind         string         `json:"kind"`
+	TraceID      string         `json:"traceId"`
+	SpanID       string         `json:"spanId"`
+	ParentSpanID string         `json:"parentSpanId,omitempty"`
+	TraceState   string         `json:"traceState,omitempty"`
+	Start        time.Time      `json:"start"`
+	End          time.Time      `json:"end"`
+	Duration     float64        `json:"durationMs"`
+	Attributes   map[string]any `json:"attributes,omitempty"`
+	Events       []jsonEvent    `json:"events,omitempty"`
+	Status       string         `json:"status"`
+	Message      string         `json:"statusMessage,omitempty"`
+}
+
+type jsonEvent struct {
+	Name       string         `json:"name"`
+	Time       time.Time      `json:"time"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+}
+
+func newJSONSpan(span *Span) jsonSpan {
+
+	js := jsonSpan{
+		Name:       span.Name,
+		Kind:       span.Kind.String(),
+		TraceID:    span.SpanContext.TraceID.String(),
+		SpanID:     span.SpanContext.SpanID.String(),
+		TraceState: span.SpanContext.State,
+		Start:      span.StartTime,
+		End:        span.EndTime,
+		Duration:   float64(span.Duration()) / float64(time.Millisecond),
+		Attributes: span.Attributes,
+		Status:     span.Status.String(),
+		Message:    span.StatusMessage,
+	}
+
+	if span.ParentSpanID.IsValid() {
+		js.ParentSpanID = span.ParentSpanID.String()
+	}
+
+	for _, event := range span.Events {
+		js.Events = append(js.Events, jsonEvent(event))
+	}
+
+	return js
+}
+
+// InMemoryExporter keeps the spans it receives, for tests.
+type InMemoryExporter struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+func NewInMemoryExporter() *InMemoryExporter {
+	return &InMemoryExporter{}
+}
+
+func (e *InMemoryExporter) ExportSpan(span *Span) {
+	e.mu.Lock()
+	e.spans = append(e.spans, span)
+	e.mu.Unlock()
+}
+
+// Spans returns the spans exported so far, in the order they ended.
+func (e *InMemoryExporter) Spans() []*Span {
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return append([]*Span(nil), e.spans...)
+}
+
+// Reset forgets the spans exported so far.
+func (e *InMemoryExporter) Reset() {
+	e.mu.Lock()
+	e.spans = nil
+	e.mu.Unlock()
+}
+
+const (
+	DefaultOTLPEndpoint     = "http://localhost:4318/v1/traces"
+	DefaultOTLPBatchSize    = 512
+	DefaultOTLPMaxQueueSize = 2048
+	DefaultOTLPInterval     = 5 * time.Second
+)
+
+type OTLPOption func(*OTLPOptions)
+
+type OTLPOptions struct {
+	Endpoint     string
+	Headers      http.Header
+	Client       *http.Client
+	ServiceName  string
+	BatchSize    int
+	MaxQueueSize int
+	Interval     time.Duration
+	Logger       *slog.Logger
+}
+
+// WithOTLPEndpoint sets the URL spans are posted to. The default is
+// DefaultOTLPEndpoint, the traces endpoint of a local collector.
+func WithOTLPEndpoint(url string) func(*OTLPOptions) {
+	return func(opts *OTLPOptions) {
+		opts.Endpoint = url
+	}
+}
+
+// WithOTLPHeader adds a header, such as an API key, to the export requests.
+func WithOTLPHeader(name, value string) func(*OTLPOptions) {
+	return func(opts *OTLPOptions) {
+		opts.Headers.Add(name, value)
+	}
+}
+
+// WithOTLPClient sets the client making the export requests. The default
+// is a client with a 10 second timeout.
+func WithOTLPClient(client *http.Client) func(*OTLPOptions) {
+	return func(opts *OTLPOptions) {
+		opts.Client = client
+	}
+}
+
+// WithOTLPServiceName sets the service.name resource attribute. The
+// default is "unknown_service".
+func WithOTLPServiceName(name string) func(*OTLPOptions) {
+	return func(opts *OTLPOptions) {
+		opts.ServiceName = name
+	}
+}
+
+// WithOTLPBatch sets the number of spans sent per request and the longest
+// time a span waits to be sent. The defaults are DefaultOTLPBatchSize and
+// DefaultOTLPInterval, which are also used for a size or interval of zero
+// or less.
+func WithOTLPBatch(size int, interval time.Duration) func(*OTLPOptions) {
+	return func(opts *OTLPOptions) {
+		opts.BatchSize = size
+		opts.Interval = interval
+	}
+}
+
+// WithOTLPMaxQueueSize sets the number of spans kept while waiting to be
+// sent. Spans exported while the queue is full are dropped. The default is
+// DefaultOTLPMaxQueueSize, also used for a size of zero or less.
+func WithOTLPMaxQueueSize(n int) func(*OTLPOptions) {
+	return func(opts *OTLPOptions) {
+		opts.MaxQueueSize = n
+	}
+}
+
+// WithOTLPLogger sets the logger failed exports are reported to. The
+// default is slog.Default().
+func WithOTLPLogger(logger *slog.Logger) func(*OTLPOptions) {
+	return func(opts *OTLPOptions) {
+		opts.Logger = logger
+	}
+}
+
+// OTLPExporter sends spans in batches to an OpenTelemetry collector, using
+// the JSON encoding of OTLP/HTTP. Spans are queued by ExportSpan and sent
+// from a background goroutine, which Shutdown stops.
+type OTLPExporter struct {
+	opts *OTLPOptions
+
+	mu     sync.Mutex
+	queue  []*Span
+	closed bool
+
+	flush   chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+func NewOTLPExporter(options ...OTLPOption) *OTLPExporter {
+
+	opts := &OTLPOptions{
+		Endpoint:     DefaultOTLPEndpoint,
+		Headers:      make(http.Header),
+		Client:       &http.Client{Timeout: 10 * time.Second},
+		ServiceName:  "unknown_service",
+		BatchSize:    DefaultOTLPBatchSize,
+		MaxQueueSize: DefaultOTLPMaxQueueSize,
+		Interval:     DefaultOTLPInterval,
+		Logger:       slog.Default(),
+	}
+
+	for _, option := range options {
+		option(opts)
+	}
+
+	// An empty batch would never be sent and a ticker needs a positive
+	// interval.
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultOTLPBatchSize
+	}
+
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultOTLPInterval
+	}
+
+	if opts.MaxQueueSize <= 0 {
+		opts.MaxQueueSize = DefaultOTLPMaxQueueSize
+	}
+
+	e := &OTLPExporter{
+		opts:    opts,
+		flush:   make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	go e.run()
+
+	return e
+}
+
+func (e *OTLPExporter) ExportSpan(span *Span) {
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.closed || len(e.queue) >= e.opts.MaxQueueSize {
+		return
+	}
+
+	e.queue = append(e.queue, span)
+
+	if len(e.queue) >= e.opts.BatchSize {
+		select {
+		case e.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (e *OTLPExporter) run() {
+
+	defer close(e.stopped)
+
+	ticker := time.NewTicker(e.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-e.done:
+			return
+		case <-ticker.C:
+		case <-e.flush:
+		}
+
+		if err := e.Flush(context.Background()); err != nil {
+			e.opts.Logger.Error("exporting spans failed", "endpoint", e.opts.Endpoint, "error", err)
+		}
+	}
+}
+
+// Flush sends the queued spans. The spans of a batch the collector does not
+// accept are dropped.
+func (e *OTLPExporter) Flush(ctx context.Context) error {
+
+	for {
+		e.mu.Lock()
+		n := min(len(e.queue), e.opts.BatchSize)
+		batch := e.queue[:n:n]
+		e.queue = e.queue[n:]
+		e.mu.Unlock()
+
+		if n == 0 {
+			return nil
+		}
+
+		if err := e.send(ctx, batch); err != nil {
+			return err
+		}
+	}
+}
+
+// Shutdown stops the background goroutine and sends the queued spans.
+// Spans exported afterwards are dropped.
+func (e *OTLPExporter) Shutdown(ctx context.Context) error {
+
+	e.mu.Lock()
+	if !e.closed {
+		e.closed = true
+		close(e.done)
+	}
+	e.mu.Unlock()
+
+	select {
+	case <-e.stopped:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	return e.Flush(ctx)
+}
+
+func (e *OTLPExporter) send(ctx context.Context, spans []*Span) error {
+
+	body, err := json.Marshal(newOTLPRequest(e.opts.ServiceName, spans))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.opts.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	for name, values := range e.opts.Headers {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := e.opts.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("collector answered %s", res.Status)
+	}
+
+	return nil
+}
+
+// The types below are the subset of the OTLP/JSON trace request written by
+// OTLPExporter. IDs are hexadecimal and 64-bit integers are strings, as the
+// OTLP/JSON encoding requires.
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	TraceState        string          `json:"traceState,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Events            []otlpEvent     `json:"events,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpEvent struct {
+	TimeUnixNano string          `json:"timeUnixNano"`
+	Name         string          `json:"name"`
+	Attributes   []otlpAttribute `json:"attributes,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+const otlpScopeName = "github.com/ironfang-ltd/go-router/middleware"
+
+func newOTLPRequest(serviceName string, spans []*Span) otlpRequest {
+
+	scope := otlpScopeSpans{Scope: otlpScope{Name: otlpScopeName}}
+
+	for _, span := range spans {
+
+		s := otlpSpan{
+			TraceID:           span.SpanContext.TraceID.String(),
+			SpanID:            span.SpanContext.SpanID.String(),
+			TraceState:        span.SpanContext.State,
+			Name:              span.Name,
+			Kind:              otlpSpanKind(span.Kind),
+			StartTimeUnixNano: otlpTime(span.StartTime),
+			EndTimeUnixNano:   otlpTime(span.EndTime),
+			Attributes:        otlpAttributes(span.Attributes),
+			Status:            otlpStatus{Code: int(span.Status), Message: span.StatusMessage},
+		}
+
+		if span.ParentSpanID.IsValid() {
+			s.ParentSpanID = span.ParentSpanID.String()
+		}
+
+		for _, event := range span.Events {
+			s.Events = append(s.Events, otlpEvent{
+				TimeUnixNano: otlpTime(event.Time),
+				Name:         event.Name,
+				Attributes:   otlpAttributes(event.Attributes),
+			})
+		}
+
+		scope.Spans = append(scope.Spans, s)
+	}
+
+	return otlpRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource:   otlpResource{Attributes: otlpAttributes(map[string]any{"service.name": serviceName})},
+			ScopeSpans: []otlpScopeSpans{scope},
+		}},
+	}
+}
+
+// otlpSpanKind maps kind to the OTLP enumeration, in which 1 is internal.
+func otlpSpanKind(kind SpanKind) int {
+	switch kind {
+	case SpanKindServer:
+		return 2
+	case SpanKindClient:
+		return 3
+	}
+	return 0
+}
+
+func otlpTime(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func otlpAttributes(attributes map[string]any) []otlpAttribute {
+
+	list := make([]otlpAttribute, 0, len(attributes))
+
+	for key, value := range attributes {
+		list = append(list, otlpAttribute{Key: key, Value: newOTLPValue(value)})
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Key < list[j].Key
+	})
+
+	return list
+}
+
+func newOTLPValue(value any) otlpValue {
+
+	var v otlpValue
+
+	switch value := value.(type) {
+	case string:
+		v.StringValue = &value
+	case bool:
+		v.BoolValue = &value
+	case int:
+		s := strconv.Itoa(value)
+		v.IntValue = &s
+	case int64:
+		s := strconv.FormatInt(value, 10)
+		v.IntValue = &s
+	case float64:
+		v.DoubleValue = &value
+	default:
+		s := fmt.Sprint(value)
+		v.StringValue = &s
+	}
+
+	return v
+}
@@ -0,0 +1,155 @@
+package middleware
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+)
+
+// ResponseWriter wraps an http.ResponseWriter and records the status code,
+// the number of body bytes written and whether the header has been sent.
+//
+// Unlike a plain struct embedding, it keeps the optional interfaces of the
+// underlying writer reachable: Flush, Hijack and ReadFrom are forwarded, and
+// Unwrap lets http.ResponseController find the original writer.
+type ResponseWriter struct {
+	w             http.ResponseWriter
+	status        int
+	bytes         int64
+	wroteHeader   bool
+	onWriteHeader []func(status int)
+}
+
+// NewResponseWriter returns a ResponseWriter wrapping w. If w is already a
+// *ResponseWriter it is returned as is, so stacked middleware share a single
+// wrapper instead of nesting them.
+func NewResponseWriter(w http.ResponseWriter) *ResponseWriter {
+
+	if rw, ok := w.(*ResponseWriter); ok {
+		return rw
+	}
+
+	return &ResponseWriter{w: w}
+}
+
+// OnWriteHeader registers fn to run just before the header is sent. The
+// callbacks run once, in registration order, and may still modify Header().
+func (rw *ResponseWriter) OnWriteHeader(fn func(status int)) {
+	rw.onWriteHeader = append(rw.onWriteHeader, fn)
+}
+
+// Status returns the status code sent to the client, or http.StatusOK if the
+// header has not been written yet.
+func (rw *ResponseWriter) Status() int {
+	if !rw.wroteHeader {
+		return http.StatusOK
+	}
+	return rw.status
+}
+
+// BytesWritten returns the number of body bytes written so far.
+func (rw *ResponseWriter) BytesWritten() int64 {
+	return rw.bytes
+}
+
+// HeaderWritten reports whether the header has been sent.
+func (rw *ResponseWriter) HeaderWritten() bool {
+	return rw.wroteHeader
+}
+
+// Unwrap returns the underlying http.ResponseWriter. It is used by
+// http.ResponseController.
+func (rw *ResponseWriter) Unwrap() http.ResponseWriter {
+	return rw.w
+}
+
+func (rw *ResponseWriter) Header() http.Header {
+	return rw.w.Header()
+}
+
+func (rw *ResponseWriter) WriteHeader(code int) {
+
+	if rw.wroteHeader {
+		return
+	}
+
+	// Informational responses may be sent any number of times before the
+	// final header, with the exception of 101 Switching Protocols.
+	if code >= 100 && code <= 199 && code != http.StatusSwitchingProtocols {
+		rw.w.WriteHeader(code)
+		return
+	}
+
+	rw.wroteHeader = true
+	rw.status = code
+
+	for _, fn := range rw.onWriteHeader {
+		fn(code)
+	}
+
+	rw.w.WriteHeader(code)
+}
+
+func (rw *ResponseWriter) Write(b []byte) (int, error) {
+
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+
+	n, err := rw.w.Write(b)
+	rw.bytes += int64(n)
+
+	return n, err
+}
+
+// ReadFrom forwards to the underlying writer's io.ReaderFrom when available,
+// which keeps sendfile and splice working for file responses.
+func (rw *ResponseWriter) ReadFrom(src io.Reader) (int64, error) {
+
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+
+	var n int64
+	var err error
+
+	if rf, ok := rw.w.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(src)
+	} else {
+		n, err = io.Copy(writerOnly{rw.w}, src)
+	}
+
+	rw.bytes += n
+
+	return n, err
+}
+
+// Flush implements http.Flusher. It is a no-op if the underlying writer
+// cannot flush.
+func (rw *ResponseWriter) Flush() {
+	_ = rw.FlushError()
+}
+
+// FlushError flushes the underlying writer and reports whether it could.
+// http.ResponseController prefers this method over Flush.
+func (rw *ResponseWriter) FlushError() error {
+
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+
+	return http.NewResponseController(rw.w).Flush()
+}
+
+// Hijack implements http.Hijacker. It returns http.ErrNotSupported if the
+// underlying writer cannot be hijacked.
+func (rw *ResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(rw.w).Hijack()
+}
+
+// writerOnly hides every method but Write, so io.Copy cannot recurse back
+// into ResponseWriter.ReadFrom.
+type writerOnly struct {
+	io.Writer
+}
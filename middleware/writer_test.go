@@ -0,0 +1,151 @@
+package middleware
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type hijackableRecorder struct {
+	*httptest.ResponseRecorder
+	hijacked bool
+}
+
+func (h *hijackableRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h.hijacked = true
+	return nil, nil, nil
+}
+
+func TestResponseWriter_TracksStatusAndBytes(t *testing.T) {
+
+	rec := httptest.NewRecorder()
+	rw := NewResponseWriter(rec)
+
+	if rw.HeaderWritten() {
+		t.Error("header should not be written yet")
+	}
+
+	rw.WriteHeader(http.StatusCreated)
+	_, _ = rw.Write([]byte("hello"))
+	_, _ = rw.ReadFrom(strings.NewReader(" world"))
+
+	if rw.Status() != http.StatusCreated {
+		t.Errorf("status is: %d, expected: %d", rw.Status(), http.StatusCreated)
+	}
+
+	if rw.BytesWritten() != 11 {
+		t.Errorf("bytes written is: %d, expected: %d", rw.BytesWritten(), 11)
+	}
+
+	if rec.Body.String() != "hello world" {
+		t.Errorf("body is: %s, expected: %s", rec.Body.String(), "hello world")
+	}
+}
+
+func TestResponseWriter_ImplicitStatus(t *testing.T) {
+
+	rec := httptest.NewRecorder()
+	rw := NewResponseWriter(rec)
+
+	calls := 0
+	rw.OnWriteHeader(func(status int) {
+		calls++
+		rw.Header().Set("X-Status", http.StatusText(status))
+	})
+
+	_, _ = rw.Write([]byte("a"))
+	_, _ = rw.Write([]byte("b"))
+	rw.WriteHeader(http.StatusTeapot)
+
+	if calls != 1 {
+		t.Errorf("OnWriteHeader called %d times, expected: 1", calls)
+	}
+
+	if rec.Code != http.StatusOK || rw.Status() != http.StatusOK {
+		t.Errorf("status is: %d, expected: %d", rec.Code, http.StatusOK)
+	}
+
+	if rec.Header().Get("X-Status") != "OK" {
+		t.Errorf("X-Status header is: %s, expected: %s", rec.Header().Get("X-Status"), "OK")
+	}
+}
+
+func TestResponseWriter_ReusesWrapper(t *testing.T) {
+
+	rw := NewResponseWriter(httptest.NewRecorder())
+
+	if NewResponseWriter(rw) != rw {
+		t.Error("expected existing wrapper to be reused")
+	}
+}
+
+func TestResponseWriter_Flush(t *testing.T) {
+
+	rec := httptest.NewRecorder()
+	rw := NewResponseWriter(rec)
+
+	if err := http.NewResponseController(rw).Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !rec.Flushed {
+		t.Error("underlying recorder was not flushed")
+	}
+}
+
+func TestResponseWriter_Hijack(t *testing.T) {
+
+	rw := NewResponseWriter(httptest.NewRecorder())
+
+	if _, _, err := rw.Hijack(); !errors.Is(err, http.ErrNotSupported) {
+		t.Errorf("hijack error is: %v, expected: %v", err, http.ErrNotSupported)
+	}
+
+	h := &hijackableRecorder{ResponseRecorder: httptest.NewRecorder()}
+	rw = NewResponseWriter(h)
+
+	if _, _, err := http.NewResponseController(rw).Hijack(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !h.hijacked {
+		t.Error("underlying writer was not hijacked")
+	}
+}
+
+func TestResponseWriter_Unwrap(t *testing.T) {
+
+	rec := httptest.NewRecorder()
+	rw := NewResponseWriter(rec)
+
+	if rw.Unwrap() != rec {
+		t.Error("Unwrap did not return the underlying writer")
+	}
+}
+
+func TestTime_PreservesFlusher(t *testing.T) {
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+
+	handler := Time()(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := w.(http.Flusher); !ok {
+			t.Error("writer passed to handler is not a http.Flusher")
+		}
+		w.(http.Flusher).Flush()
+	})
+
+	handler.ServeHTTP(w, req)
+
+	if !w.Flushed {
+		t.Error("response was not flushed")
+	}
+
+	if w.Header().Get("X-Request-Time-Ms") == "" {
+		t.Error("X-Request-Time-Ms header is not set")
+	}
+}
@@ -0,0 +1,199 @@
+package router
+
+import (
+	"encoding/xml"
+	"fmt"
+	"html"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	MIMEApplicationJSON = "application/json"
+	MIMEApplicationXML  = "application/xml"
+	MIMETextPlain       = "text/plain"
+	MIMETextHTML        = "text/html"
+)
+
+type acceptRange struct {
+	typ     string
+	subtype string
+	q       float64
+}
+
+// Negotiate returns the offer that best matches the Accept header of r, or
+// an empty string if none of the offers is acceptable.
+//
+// Each offer is weighted by the most specific media range that matches it,
+// so "text/html;q=0.5, text/*" prefers text/plain over text/html. Ties are
+// broken by the order of the offers. A request without an Accept header
+// accepts the first offer.
+func Negotiate(r *http.Request, offers ...string) string {
+	return negotiate(r, offers, false)
+}
+
+// negotiate implements Negotiate. With vendorSuffix, vendor media ranges
+// such as application/vnd.acme.v2+json also accept the media type of their
+// structured syntax suffix, application/json, as they do once the version
+// they name has been selected.
+func negotiate(r *http.Request, offers []string, vendorSuffix bool) string {
+
+	if len(offers) == 0 {
+		return ""
+	}
+
+	accept := r.Header.Values("Accept")
+	if len(accept) == 0 {
+		return offers[0]
+	}
+
+	ranges := parseAccept(strings.Join(accept, ","))
+	if len(ranges) == 0 {
+		return offers[0]
+	}
+
+	if vendorSuffix {
+		ranges = withSuffixRanges(ranges)
+	}
+
+	best := ""
+	bestQ := 0.0
+
+	for _, offer := range offers {
+		q := acceptQuality(ranges, offer)
+		if q > bestQ {
+			best = offer
+			bestQ = q
+		}
+	}
+
+	return best
+}
+
+// withSuffixRanges adds the structured syntax suffix of every vendor media
+// range, application/json for application/vnd.acme.v2+json, with the same
+// quality.
+func withSuffixRanges(ranges []acceptRange) []acceptRange {
+
+	for _, ar := range ranges {
+
+		if !strings.HasPrefix(ar.subtype, "vnd.") {
+			continue
+		}
+
+		if _, suffix, ok := strings.Cut(ar.subtype, "+"); ok && suffix != "" {
+			ranges = append(ranges, acceptRange{typ: ar.typ, subtype: suffix, q: ar.q})
+		}
+	}
+
+	return ranges
+}
+
+func parseAccept(header string) []acceptRange {
+
+	var ranges []acceptRange
+
+	for _, part := range strings.Split(header, ",") {
+
+		mediaRange, params, _ := strings.Cut(part, ";")
+
+		typ, subtype, ok := strings.Cut(strings.TrimSpace(mediaRange), "/")
+		if !ok || typ == "" || subtype == "" {
+			continue
+		}
+
+		q := 1.0
+
+		for _, param := range strings.Split(params, ";") {
+			name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if !strings.EqualFold(name, "q") {
+				continue
+			}
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil || parsed < 0 || parsed > 1 {
+				parsed = 0
+			}
+			q = parsed
+		}
+
+		ranges = append(ranges, acceptRange{
+			typ:     strings.ToLower(typ),
+			subtype: strings.ToLower(subtype),
+			q:       q,
+		})
+	}
+
+	return ranges
+}
+
+// acceptQuality returns the quality of the most specific range matching the
+// media type offer.
+func acceptQuality(ranges []acceptRange, offer string) float64 {
+
+	mediaType, _, _ := strings.Cut(offer, ";")
+	typ, subtype, _ := strings.Cut(strings.ToLower(strings.TrimSpace(mediaType)), "/")
+
+	q := 0.0
+	specificity := -1
+
+	for _, ar := range ranges {
+
+		s := -1
+
+		switch {
+		case ar.typ == typ && ar.subtype == subtype:
+			s = 2
+		case ar.typ == typ && ar.subtype == "*":
+			s = 1
+		case ar.typ == "*" && ar.subtype == "*":
+			s = 0
+		}
+
+		if s > specificity {
+			specificity = s
+			q = ar.q
+		}
+	}
+
+	return q
+}
+
+// Render writes v with status in the representation negotiated from the
+// Accept header: JSON, XML, plain text or HTML. Plain text and HTML use
+// fmt.Sprint, with template.HTML values written unescaped. If none of these
+// is acceptable a 406 Not Acceptable error is written.
+func Render(w http.ResponseWriter, r *http.Request, status int, v any) {
+
+	w.Header().Add("Vary", "Accept")
+
+	switch Negotiate(r, MIMEApplicationJSON, MIMEApplicationXML, MIMETextPlain, MIMETextHTML) {
+	case MIMEApplicationJSON:
+		writeJSON(w, status, v)
+	case MIMEApplicationXML:
+		b, err := xml.Marshal(v)
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(xml.Header))
+		_, _ = w.Write(b)
+	case MIMETextPlain:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(status)
+		_, _ = fmt.Fprint(w, v)
+	case MIMETextHTML:
+		s, ok := v.(template.HTML)
+		if !ok {
+			s = template.HTML(html.EscapeString(fmt.Sprint(v)))
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(s))
+	default:
+		WriteError(w, r, NewHTTPError(http.StatusNotAcceptable, ""))
+	}
+}
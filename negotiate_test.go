@@ -0,0 +1,183 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		accept   string
+		offers   []string
+		expected string
+	}{
+		{name: "NoAcceptHeader", accept: "", offers: []string{"application/json", "text/csv"}, expected: "application/json"},
+		{name: "Exact", accept: "text/csv", offers: []string{"application/json", "text/csv"}, expected: "text/csv"},
+		{name: "QValues", accept: "application/json;q=0.5, text/csv;q=0.9", offers: []string{"application/json", "text/csv"}, expected: "text/csv"},
+		{name: "TypeWildcard", accept: "text/*", offers: []string{"application/json", "text/csv"}, expected: "text/csv"},
+		{name: "AnyWildcard", accept: "*/*", offers: []string{"application/json", "text/csv"}, expected: "application/json"},
+		{name: "MostSpecificWins", accept: "text/*;q=0.8, text/csv;q=0", offers: []string{"text/csv", "text/plain"}, expected: "text/plain"},
+		{name: "Excluded", accept: "application/json;q=0", offers: []string{"application/json"}, expected: ""},
+		{name: "NotAcceptable", accept: "image/png", offers: []string{"application/json", "text/csv"}, expected: ""},
+		{name: "CaseInsensitive", accept: "Application/JSON", offers: []string{"application/json"}, expected: "application/json"},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+
+			req, _ := http.NewRequest("GET", "/", nil)
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+
+			got := Negotiate(req, tc.offers...)
+
+			if got != tc.expected {
+				t.Errorf("negotiated '%s', expected: '%s'", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+
+	type item struct {
+		Name string `json:"name" xml:"name"`
+	}
+
+	tests := []struct {
+		accept      string
+		status      int
+		contentType string
+		body        string
+	}{
+		{accept: "application/json", status: http.StatusOK, contentType: "application/json; charset=utf-8", body: `{"name":"gopher"}`},
+		{accept: "application/xml", status: http.StatusOK, contentType: "application/xml; charset=utf-8", body: `<item><name>gopher</name></item>`},
+		{accept: "text/plain", status: http.StatusOK, contentType: "text/plain; charset=utf-8", body: `{gopher}`},
+		{accept: "image/png", status: http.StatusNotAcceptable, contentType: "text/plain; charset=utf-8", body: `Not Acceptable`},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+
+		t.Run(tc.accept, func(t *testing.T) {
+
+			req, _ := http.NewRequest("GET", "/", nil)
+			req.Header.Set("Accept", tc.accept)
+			w := httptest.NewRecorder()
+
+			Render(w, req, http.StatusOK, item{Name: "gopher"})
+
+			if w.Code != tc.status {
+				t.Errorf("response code is: %d, expected: %d", w.Code, tc.status)
+			}
+
+			if w.Header().Get("Content-Type") != tc.contentType {
+				t.Errorf("content type is: %s, expected: %s", w.Header().Get("Content-Type"), tc.contentType)
+			}
+
+			if !strings.Contains(w.Body.String(), tc.body) {
+				t.Errorf("response body is: %s, expected it to contain: %s", w.Body.String(), tc.body)
+			}
+		})
+	}
+}
+
+func TestRouter_Produces(t *testing.T) {
+
+	r := New()
+
+	r.Get("/report", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"total":1}`))
+	}).Produces("application/json")
+
+	r.Get("/report", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("total\n1\n"))
+	}).Produces("text/csv")
+
+	tests := []struct {
+		accept      string
+		status      int
+		contentType string
+		body        string
+	}{
+		{accept: "", status: http.StatusOK, contentType: "application/json", body: `{"total":1}`},
+		{accept: "text/csv", status: http.StatusOK, contentType: "text/csv", body: "total\n1\n"},
+		{accept: "application/json, text/csv;q=0.5", status: http.StatusOK, contentType: "application/json", body: `{"total":1}`},
+		{accept: "application/xml", status: http.StatusNotAcceptable},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+
+		t.Run("Accept="+tc.accept, func(t *testing.T) {
+
+			req, _ := http.NewRequest("GET", "/report", nil)
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, req)
+
+			if w.Code != tc.status {
+				t.Errorf("response code is: %d, expected: %d", w.Code, tc.status)
+			}
+
+			if w.Header().Get("Vary") != "Accept" {
+				t.Errorf("response header Vary is: %s, expected: %s", w.Header().Get("Vary"), "Accept")
+			}
+
+			if tc.status != http.StatusOK {
+				return
+			}
+
+			if w.Header().Get("Content-Type") != tc.contentType {
+				t.Errorf("content type is: %s, expected: %s", w.Header().Get("Content-Type"), tc.contentType)
+			}
+
+			if w.Body.String() != tc.body {
+				t.Errorf("response body is: %s, expected: %s", w.Body.String(), tc.body)
+			}
+		})
+	}
+
+	routes := r.GetRoutes()
+	if len(routes) != 2 {
+		t.Errorf("got %d routes, expected: 2", len(routes))
+	}
+}
+
+func TestRouter_ProducesWithFallback(t *testing.T) {
+
+	r := New()
+
+	r.Get("/report", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("default"))
+	})
+
+	r.Get("/report", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("csv"))
+	}).Produces("text/csv")
+
+	for accept, expected := range map[string]string{"": "default", "text/csv": "csv", "image/png": "default"} {
+
+		req, _ := http.NewRequest("GET", "/report", nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		w := httptest.NewRecorder()
+
+		r.ServeHTTP(w, req)
+
+		if w.Body.String() != expected {
+			t.Errorf("Accept '%s': response body is: %s, expected: %s", accept, w.Body.String(), expected)
+		}
+	}
+}
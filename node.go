@@ -26,8 +26,10 @@ type routeTreeNode struct {
 	parent      *routeTreeNode
 	children    []*routeTreeNode
 	middlewares []Middleware
+	cors        Middleware
 	handler     http.HandlerFunc
-	handlers    []http.HandlerFunc
+	wrapped     bool
+	routes      [][]*route
 	param       bool
 	catchAll    bool
 }
@@ -39,7 +41,7 @@ func newRouteTreeNode(config *Config) *routeTreeNode {
 		parent:   nil,
 		children: nil,
 		handler:  nil,
-		handlers: nil,
+		routes:   nil,
 		param:    false,
 		catchAll: false,
 	}
@@ -119,9 +121,7 @@ func (r *routeTreeNode) GetOrCreateNode(path string) *routeTreeNode {
 	return node
 }
 
-func (r *routeTreeNode) Find(req *http.Request) *routeTreeNode {
-
-	path := req.URL.Path
+func (r *routeTreeNode) Find(path string, req *http.Request) *routeTreeNode {
 
 	if path == "" {
 		return nil
@@ -176,6 +176,9 @@ func (r *routeTreeNode) Find(req *http.Request) *routeTreeNode {
 				path = path[high:]
 				break
 			} else if child.catchAll {
+				if name := child.segment[1:]; name != "" {
+					req.SetPathValue(name, path)
+				}
 				return child
 			}
 		}
@@ -188,35 +191,100 @@ func (r *routeTreeNode) Find(req *http.Request) *routeTreeNode {
 	return node
 }
 
-func (r *routeTreeNode) SetHandler(method string, handler http.HandlerFunc) {
-	if r.handlers == nil {
-		r.handlers = make([]http.HandlerFunc, httpMethodCount)
+func (r *routeTreeNode) AddRoute(method string, handler http.HandlerFunc) *route {
+	if r.routes == nil {
+		r.routes = make([][]*route, httpMethodCount)
+	}
+
+	rt := &route{
+		node:    r,
+		path:    r.getPath(),
+		method:  method,
+		handler: handler,
 	}
 
-	r.handlers[methodToUint8(method)] = handler
+	i := methodToUint8(method)
+	r.routes[i] = append(r.routes[i], rt)
 	r.handler = r.wrapMiddleware(r.final)
+
+	return rt
+}
+
+func (r *routeTreeNode) GetRoutes(method string) []*route {
+
+	if r.routes == nil {
+		return nil
+	}
+
+	if len(r.routes[httpMethodAny]) > 0 {
+		return r.routes[httpMethodAny]
+	}
+
+	return r.routes[methodToUint8(method)]
+}
+
+// Match returns the route serving req and the media type negotiated for it,
+// or nil if no route accepts the request method and Accept header. versioned
+// reports whether the router selected an API version for req.
+func (r *routeTreeNode) Match(req *http.Request, versioned bool) (*route, string) {
+	return selectRoute(r.GetRoutes(req.Method), req, versioned)
 }
 
-func (r *routeTreeNode) GetHandler(method string) http.HandlerFunc {
+// Methods returns the methods registered on the node, in a stable order.
+func (r *routeTreeNode) Methods() []string {
 
-	if r.handlers == nil {
+	if r.routes == nil {
 		return nil
 	}
 
-	if r.handlers[httpMethodAny] != nil {
-		return r.handlers[httpMethodAny]
+	if len(r.routes[httpMethodAny]) > 0 {
+		methods := make([]string, 0, httpMethodAny)
+		for i := uint8(0); i < httpMethodAny; i++ {
+			methods = append(methods, uint8ToMethod(i))
+		}
+		return methods
+	}
+
+	var methods []string
+
+	for i, routes := range r.routes {
+		if len(routes) > 0 {
+			methods = append(methods, uint8ToMethod(uint8(i)))
+		}
 	}
 
-	return r.handlers[methodToUint8(method)]
+	return methods
 }
 
 func (r *routeTreeNode) Use(middleware ...Middleware) {
 	r.middlewares = append(r.middlewares, middleware...)
+	r.rewrap()
+}
+
+// Cors sets the CORS policy of the node and its descendants, replacing the
+// policy inherited from its parents.
+func (r *routeTreeNode) Cors(policy Middleware) {
+	r.cors = policy
+	r.rewrap()
+}
+
+// rewrap rebuilds the handler chain of the node and its descendants, so
+// middleware added to a group applies to routes registered before it.
+func (r *routeTreeNode) rewrap() {
+
 	r.handler = r.wrapMiddleware(r.final)
+
+	for _, child := range r.children {
+		child.rewrap()
+	}
 }
 
+// wrapMiddleware wraps final in the middleware and CORS policy applying to
+// the node, and records in r.wrapped whether there were any.
 func (r *routeTreeNode) wrapMiddleware(final http.HandlerFunc) http.HandlerFunc {
 
+	handler := final
+
 	middlewares := make([]Middleware, 0)
 
 	// collect all middlewares from parent nodes and current node
@@ -237,31 +305,74 @@ func (r *routeTreeNode) wrapMiddleware(final http.HandlerFunc) http.HandlerFunc
 	}
 
 	for i := 0; i < len(middlewares); i++ {
-		final = middlewares[i](final)
+		handler = middlewares[i](handler)
+	}
+
+	// The nearest CORS policy runs first, so preflight requests are answered
+	// before any other middleware, such as authentication, can reject them.
+	for node = r; node != nil; node = node.parent {
+		if node.cors != nil {
+			handler = node.cors(handler)
+			break
+		}
 	}
 
-	return final
+	r.wrapped = len(middlewares) > 0 || node != nil
+
+	return handler
 }
 
 func (r *routeTreeNode) final(w http.ResponseWriter, req *http.Request) {
 
-	handler := r.GetHandler(req.Method)
+	routes := r.GetRoutes(req.Method)
 
-	if handler == nil {
+	if len(routes) == 0 {
 
 		// If all handlers are nil, then return 404
-		if r.handlers == nil {
+		if r.routes == nil {
 			r.config.NotFoundHandler(w, req)
 			return
 		}
 
 		// There are handlers, but not for this method
+		w.Header().Set("Allow", strings.Join(r.Methods(), ", "))
 		r.config.MethodNotAllowedHandler(w, req)
 
 		return
 	}
 
-	handler(w, req)
+	if isNegotiated(routes) {
+		w.Header().Add("Vary", "Accept")
+	}
+
+	var rt *route
+	var mediaType string
+
+	if rc := requestContextFrom(req.Context()); rc != nil && rc.node == r {
+		rt, mediaType = rc.route, rc.mediaType
+	} else {
+		rt, mediaType = r.Match(req, VersionFrom(req) != "")
+	}
+
+	r.serve(w, req, rt, mediaType)
+}
+
+// serve calls the handler of rt, the route matched for req on the node, or
+// answers 406 Not Acceptable if no route matched.
+func (r *routeTreeNode) serve(w http.ResponseWriter, req *http.Request, rt *route, mediaType string) {
+
+	if rt == nil {
+		WriteError(w, req, NewHTTPError(http.StatusNotAcceptable, ""))
+		return
+	}
+
+	if mediaType != "" && isConcreteMediaType(mediaType) {
+		w.Header().Set("Content-Type", mediaType)
+	}
+
+	rt.writeDeprecation(w.Header())
+
+	rt.handler(w, req)
 }
 
 func (r *routeTreeNode) getPath() string {
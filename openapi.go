@@ -0,0 +1,571 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+const OpenAPIVersion = "3.1.0"
+
+// OpenAPI is an OpenAPI 3.1 document.
+type OpenAPI struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       OpenAPIInfo                             `json:"info"`
+	Servers    []OpenAPIServer                         `json:"servers,omitempty"`
+	Paths      map[string]map[string]*OpenAPIOperation `json:"paths"`
+	Components *OpenAPIComponents                      `json:"components,omitempty"`
+}
+
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type OpenAPIServer struct {
+	URL string `json:"url"`
+}
+
+type OpenAPIComponents struct {
+	Schemas map[string]*Schema `json:"schemas,omitempty"`
+}
+
+type OpenAPIOperation struct {
+	OperationID string                      `json:"operationId,omitempty"`
+	Summary     string                      `json:"summary,omitempty"`
+	Description string                      `json:"description,omitempty"`
+	Tags        []string                    `json:"tags,omitempty"`
+	Parameters  []*OpenAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *OpenAPIRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*OpenAPIResponse `json:"responses"`
+	Deprecated  bool                        `json:"deprecated,omitempty"`
+}
+
+type OpenAPIParameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required,omitempty"`
+	Schema   *Schema `json:"schema"`
+}
+
+type OpenAPIRequestBody struct {
+	Required bool                         `json:"required,omitempty"`
+	Content  map[string]*OpenAPIMediaType `json:"content"`
+}
+
+type OpenAPIResponse struct {
+	Description string                       `json:"description"`
+	Content     map[string]*OpenAPIMediaType `json:"content,omitempty"`
+}
+
+type OpenAPIMediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+// Schema is the subset of JSON Schema used to describe Go types.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Default              any                `json:"default,omitempty"`
+}
+
+type OpenAPIOption func(*OpenAPI)
+
+func WithOpenAPIInfo(title, version string) OpenAPIOption {
+	return func(doc *OpenAPI) {
+		doc.Info.Title = title
+		doc.Info.Version = version
+	}
+}
+
+func WithOpenAPIDescription(description string) OpenAPIOption {
+	return func(doc *OpenAPI) {
+		doc.Info.Description = description
+	}
+}
+
+func WithOpenAPIServers(urls ...string) OpenAPIOption {
+	return func(doc *OpenAPI) {
+		for _, url := range urls {
+			doc.Servers = append(doc.Servers, OpenAPIServer{URL: url})
+		}
+	}
+}
+
+// OpenAPIHandler serves the OpenAPI document of r as JSON. The document is
+// generated on the first request, so routes registered after the handler
+// are included.
+func OpenAPIHandler(r Router, opts ...OpenAPIOption) http.HandlerFunc {
+
+	var once sync.Once
+	var b []byte
+	var err error
+
+	return func(w http.ResponseWriter, req *http.Request) {
+
+		once.Do(func() {
+			b, err = json.Marshal(NewOpenAPI(r.GetRoutes(), opts...))
+		})
+
+		if err != nil {
+			WriteError(w, req, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_, _ = w.Write(b)
+	}
+}
+
+// NewOpenAPI builds an OpenAPI 3.1 document from a route table. Schemas are
+// generated by reflecting over the request and response types documented on
+// the routes; named struct types are shared through components.
+func NewOpenAPI(routes []RouteDescriptor, opts ...OpenAPIOption) *OpenAPI {
+
+	doc := &OpenAPI{
+		OpenAPI: OpenAPIVersion,
+		Info: OpenAPIInfo{
+			Title:   "API",
+			Version: "1.0.0",
+		},
+		Paths: make(map[string]map[string]*OpenAPIOperation),
+	}
+
+	for _, opt := range opts {
+		opt(doc)
+	}
+
+	gen := &schemaGenerator{
+		schemas: make(map[string]*Schema),
+		names:   make(map[reflect.Type]string),
+	}
+
+	for _, rd := range routes {
+
+		if rd.Method == "*" {
+			continue
+		}
+
+		path, pathParams := openAPIPath(rd.Path)
+
+		item := doc.Paths[path]
+		if item == nil {
+			item = make(map[string]*OpenAPIOperation)
+			doc.Paths[path] = item
+		}
+
+		method := strings.ToLower(rd.Method)
+		if item[method] != nil {
+			// Routes with the same path and method that differ by the media
+			// type they produce are documented as one operation.
+			continue
+		}
+
+		item[method] = gen.operation(rd, path, pathParams, producesFor(routes, rd))
+	}
+
+	if len(gen.schemas) > 0 {
+		doc.Components = &OpenAPIComponents{Schemas: gen.schemas}
+	}
+
+	return doc
+}
+
+// producesFor collects the media types produced by every route sharing the
+// method and path of rd.
+func producesFor(routes []RouteDescriptor, rd RouteDescriptor) []string {
+
+	var produces []string
+
+	for _, other := range routes {
+		if other.Method == rd.Method && other.Path == rd.Path {
+			produces = append(produces, other.Produces...)
+		}
+	}
+
+	if len(produces) == 0 {
+		produces = []string{MIMEApplicationJSON}
+	}
+
+	return produces
+}
+
+// openAPIPath converts a router path such as /users/:id to /users/{id} and
+// returns the names of its path parameters.
+func openAPIPath(path string) (string, []string) {
+
+	segments := strings.Split(path, "/")
+	var params []string
+
+	for i, segment := range segments {
+
+		if len(segment) == 0 || (segment[0] != ':' && segment[0] != '*') {
+			continue
+		}
+
+		name := segment[1:]
+		if name == "" {
+			name = "wildcard"
+		}
+
+		segments[i] = "{" + name + "}"
+		params = append(params, name)
+	}
+
+	return strings.Join(segments, "/"), params
+}
+
+type schemaGenerator struct {
+	schemas map[string]*Schema
+	names   map[reflect.Type]string
+}
+
+func (gen *schemaGenerator) operation(rd RouteDescriptor, path string, pathParams []string, produces []string) *OpenAPIOperation {
+
+	op := &OpenAPIOperation{
+		OperationID: operationID(rd.Method, path),
+		Summary:     rd.Summary,
+		Description: rd.Description,
+		Tags:        rd.Tags,
+		Responses:   make(map[string]*OpenAPIResponse),
+		Deprecated:  rd.Deprecated,
+	}
+
+	documented := make(map[string]bool)
+
+	if rd.Request != nil {
+
+		t := derefType(rd.Request)
+
+		if t.Kind() == reflect.Struct {
+
+			for _, f := range bindFieldsOf(t) {
+
+				if f.source == BindSourceForm {
+					continue
+				}
+
+				op.Parameters = append(op.Parameters, &OpenAPIParameter{
+					Name:     f.name,
+					In:       f.source,
+					Required: f.source == BindSourcePath || f.required,
+					Schema:   gen.paramSchema(f),
+				})
+
+				if f.source == BindSourcePath {
+					documented[f.name] = true
+				}
+			}
+
+			if body := gen.bodySchema(t); body != nil && hasRequestBody(rd.Method) {
+				op.RequestBody = &OpenAPIRequestBody{
+					Required: true,
+					Content: map[string]*OpenAPIMediaType{
+						MIMEApplicationJSON: {Schema: body},
+					},
+				}
+			}
+		} else {
+			op.RequestBody = &OpenAPIRequestBody{
+				Required: true,
+				Content: map[string]*OpenAPIMediaType{
+					MIMEApplicationJSON: {Schema: gen.schema(rd.Request)},
+				},
+			}
+		}
+	}
+
+	// Path parameters without a documented request field are strings.
+	for _, name := range pathParams {
+		if documented[name] {
+			continue
+		}
+		op.Parameters = append(op.Parameters, &OpenAPIParameter{
+			Name:     name,
+			In:       BindSourcePath,
+			Required: true,
+			Schema:   &Schema{Type: "string"},
+		})
+	}
+
+	for _, res := range rd.Responses {
+
+		response := &OpenAPIResponse{Description: http.StatusText(res.Status)}
+
+		if res.Type != nil {
+			schema := gen.schema(res.Type)
+			response.Content = make(map[string]*OpenAPIMediaType)
+			for _, mediaType := range produces {
+				response.Content[mediaType] = &OpenAPIMediaType{Schema: schema}
+			}
+		}
+
+		op.Responses[strconv.Itoa(res.Status)] = response
+	}
+
+	if len(op.Responses) == 0 {
+		op.Responses["200"] = &OpenAPIResponse{Description: http.StatusText(http.StatusOK)}
+	}
+
+	return op
+}
+
+func (gen *schemaGenerator) paramSchema(f bindField) *Schema {
+
+	schema := gen.schema(f.typ)
+
+	if f.defaultValue != "" && schema.Ref == "" {
+		copied := *schema
+		copied.Default = f.defaultValue
+		schema = &copied
+	}
+
+	return schema
+}
+
+// bodySchema describes the fields of a request type that are not bound from
+// the path, query or headers. It returns nil if there are none.
+func (gen *schemaGenerator) bodySchema(t reflect.Type) *Schema {
+
+	schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	gen.addProperties(schema, t, true)
+
+	if len(schema.Properties) == 0 {
+		return nil
+	}
+
+	return schema
+}
+
+var (
+	byteSliceType = reflect.TypeOf([]byte(nil))
+	jsonRawType   = reflect.TypeOf(json.RawMessage(nil))
+)
+
+func (gen *schemaGenerator) schema(t reflect.Type) *Schema {
+
+	t = derefType(t)
+
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case durationType:
+		return &Schema{Type: "string", Format: "duration"}
+	case byteSliceType:
+		return &Schema{Type: "string", Format: "byte"}
+	case jsonRawType:
+		return &Schema{}
+	}
+
+	if reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		return &Schema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: gen.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: gen.schema(t.Elem())}
+	case reflect.Struct:
+		return gen.structSchema(t)
+	}
+
+	return &Schema{}
+}
+
+func (gen *schemaGenerator) structSchema(t reflect.Type) *Schema {
+
+	name := gen.componentName(t)
+
+	if name != "" {
+		if _, ok := gen.schemas[name]; !ok {
+			// Register before recursing so self-referencing types terminate.
+			schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+			gen.schemas[name] = schema
+			gen.addProperties(schema, t, false)
+		}
+		return &Schema{Ref: "#/components/schemas/" + name}
+	}
+
+	schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	gen.addProperties(schema, t, false)
+
+	return schema
+}
+
+// addProperties adds the JSON properties of struct type t to schema. When
+// skipBound is set, fields bound from the path, query or headers are left
+// out.
+func (gen *schemaGenerator) addProperties(schema *Schema, t reflect.Type, skipBound bool) {
+
+	for i := 0; i < t.NumField(); i++ {
+
+		sf := t.Field(i)
+		tag := sf.Tag.Get("json")
+
+		if tag == "-" {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(tag, ",")
+
+		if sf.Anonymous && name == "" && derefType(sf.Type).Kind() == reflect.Struct {
+			gen.addProperties(schema, derefType(sf.Type), skipBound)
+			continue
+		}
+
+		if !sf.IsExported() {
+			continue
+		}
+
+		if skipBound && isBoundField(sf) {
+			continue
+		}
+
+		if name == "" {
+			name = sf.Name
+		}
+
+		schema.Properties[name] = gen.schema(sf.Type)
+
+		if !strings.Contains(opts, "omitempty") && !strings.Contains(opts, "omitzero") && sf.Type.Kind() != reflect.Pointer {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+
+	sort.Strings(schema.Required)
+}
+
+func hasRequestBody(method string) bool {
+	return method == http.MethodPost || method == http.MethodPut || method == http.MethodPatch
+}
+
+func isBoundField(sf reflect.StructField) bool {
+	for _, source := range []string{BindSourcePath, BindSourceQuery, BindSourceHeader, BindSourceForm} {
+		if _, ok := sf.Tag.Lookup(source); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// componentName returns the component name of a named struct type, or an
+// empty string for anonymous structs. Types sharing a name, such as User
+// types from different packages, are told apart: the first one keeps the
+// plain name and the others are qualified with their package.
+func (gen *schemaGenerator) componentName(t reflect.Type) string {
+
+	if name, ok := gen.names[t]; ok {
+		return name
+	}
+
+	name := schemaName(t)
+	if name == "" {
+		return ""
+	}
+
+	candidates := []string{name}
+
+	if pkg := t.PkgPath(); pkg != "" {
+		candidates = append(candidates,
+			sanitizeSchemaName(path.Base(pkg))+"."+name,
+			sanitizeSchemaName(pkg)+"."+name,
+		)
+	}
+
+	for _, candidate := range candidates {
+		if _, taken := gen.schemas[candidate]; !taken {
+			gen.names[t] = candidate
+			return candidate
+		}
+	}
+
+	for i := 2; ; i++ {
+		candidate := candidates[len(candidates)-1] + "_" + strconv.Itoa(i)
+		if _, taken := gen.schemas[candidate]; !taken {
+			gen.names[t] = candidate
+			return candidate
+		}
+	}
+}
+
+// schemaName returns the name of a named struct type, or an empty string
+// for anonymous structs. Generic type arguments are folded into the name so
+// the result is a valid component key.
+func schemaName(t reflect.Type) string {
+
+	name := t.Name()
+	if name == "" {
+		return ""
+	}
+
+	return sanitizeSchemaName(name)
+}
+
+func sanitizeSchemaName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '.' || r == '-' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+func derefType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
+
+// operationID derives an identifier such as getUsersById from a method and
+// an OpenAPI path.
+func operationID(method, path string) string {
+
+	var sb strings.Builder
+	sb.WriteString(strings.ToLower(method))
+
+	upper := true
+
+	for _, r := range path {
+		switch {
+		case r == '{':
+			sb.WriteString("By")
+			upper = true
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if upper {
+				r = unicode.ToUpper(r)
+				upper = false
+			}
+			sb.WriteRune(r)
+		default:
+			upper = true
+		}
+	}
+
+	return sb.String()
+}
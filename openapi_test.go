@@ -0,0 +1,209 @@
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type openAPIUser struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Email     *string   `json:"email,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	Manager   *openAPIUser
+}
+
+type openAPIUserRequest struct {
+	ID     int64  `path:"id"`
+	Tenant string `header:"X-Tenant,required"`
+	Name   string `json:"name"`
+}
+
+type openAPIListRequest struct {
+	Page int `query:"page" default:"1"`
+}
+
+func TestOpenAPIPath(t *testing.T) {
+
+	tests := map[string]string{
+		"/":                    "/",
+		"/users/:id":           "/users/{id}",
+		"/users/:id/posts/:pk": "/users/{id}/posts/{pk}",
+		"/static/*filePath":    "/static/{filePath}",
+	}
+
+	for path, expected := range tests {
+		got, _ := openAPIPath(path)
+		if got != expected {
+			t.Errorf("openapi path of '%s' is: '%s', expected: '%s'", path, got, expected)
+		}
+	}
+}
+
+func TestNewOpenAPI(t *testing.T) {
+
+	r := New()
+
+	r.Get("/users", func(w http.ResponseWriter, r *http.Request) {}).
+		Summary("List users").
+		Tags("users").
+		Request(openAPIListRequest{}).
+		Response(http.StatusOK, []openAPIUser{})
+
+	r.Put("/users/:id", func(w http.ResponseWriter, r *http.Request) {}).
+		Tags("users").
+		Request(openAPIUserRequest{}).
+		Response(http.StatusOK, openAPIUser{}).
+		Response(http.StatusNotFound, nil).
+		Deprecated(time.Date(2025, time.June, 1, 0, 0, 0, 0, time.UTC))
+
+	r.Get("/users/:id/avatar", func(w http.ResponseWriter, r *http.Request) {})
+
+	doc := NewOpenAPI(r.GetRoutes(), WithOpenAPIInfo("Users", "2.0.0"))
+
+	if doc.OpenAPI != "3.1.0" || doc.Info.Title != "Users" || doc.Info.Version != "2.0.0" {
+		t.Errorf("document header is: %s %+v", doc.OpenAPI, doc.Info)
+	}
+
+	list := doc.Paths["/users"]["get"]
+	if list == nil {
+		t.Fatal("GET /users is missing")
+	}
+
+	if list.Summary != "List users" || !reflect.DeepEqual(list.Tags, []string{"users"}) {
+		t.Errorf("GET /users is: %+v", list)
+	}
+
+	if len(list.Parameters) != 1 || list.Parameters[0].In != "query" || list.Parameters[0].Schema.Default != "1" {
+		t.Errorf("GET /users parameters are: %+v", list.Parameters)
+	}
+
+	items := list.Responses["200"].Content["application/json"].Schema
+	if items.Type != "array" || items.Items.Ref != "#/components/schemas/openAPIUser" {
+		t.Errorf("GET /users response schema is: %+v", items)
+	}
+
+	update := doc.Paths["/users/{id}"]["put"]
+	if update == nil {
+		t.Fatal("PUT /users/{id} is missing")
+	}
+
+	if !update.Deprecated || update.OperationID != "putUsersById" {
+		t.Errorf("PUT /users/{id} is: %+v", update)
+	}
+
+	if len(update.Parameters) != 2 || update.Parameters[0].Name != "id" || update.Parameters[0].Schema.Type != "integer" || !update.Parameters[1].Required {
+		t.Errorf("PUT /users/{id} parameters are: %+v", update.Parameters)
+	}
+
+	body := update.RequestBody.Content["application/json"].Schema
+	if len(body.Properties) != 1 || body.Properties["name"] == nil {
+		t.Errorf("PUT /users/{id} body schema is: %+v", body)
+	}
+
+	if update.Responses["404"] == nil || update.Responses["404"].Content != nil {
+		t.Errorf("PUT /users/{id} 404 response is: %+v", update.Responses["404"])
+	}
+
+	avatar := doc.Paths["/users/{id}/avatar"]["get"]
+	if len(avatar.Parameters) != 1 || avatar.Parameters[0].Schema.Type != "string" || avatar.Responses["200"] == nil {
+		t.Errorf("GET /users/{id}/avatar is: %+v", avatar)
+	}
+
+	user := doc.Components.Schemas["openAPIUser"]
+	if user == nil {
+		t.Fatal("openAPIUser schema is missing")
+	}
+
+	if user.Properties["createdAt"].Format != "date-time" || user.Properties["Manager"].Ref != "#/components/schemas/openAPIUser" {
+		t.Errorf("openAPIUser schema is: %+v", user)
+	}
+
+	if !reflect.DeepEqual(user.Required, []string{"createdAt", "id", "name"}) {
+		t.Errorf("openAPIUser required is: %v", user.Required)
+	}
+}
+
+func TestNewOpenAPI_SchemaNameCollision(t *testing.T) {
+
+	r := New()
+
+	r.Get("/bytes", func(w http.ResponseWriter, r *http.Request) {}).
+		Response(http.StatusOK, bytes.Reader{})
+
+	r.Get("/strings", func(w http.ResponseWriter, r *http.Request) {}).
+		Response(http.StatusOK, strings.Reader{})
+
+	{
+		type item struct {
+			Name string `json:"name"`
+		}
+		r.Get("/names", func(w http.ResponseWriter, r *http.Request) {}).
+			Response(http.StatusOK, item{})
+	}
+
+	{
+		type item struct {
+			Count int `json:"count"`
+		}
+		r.Get("/counts", func(w http.ResponseWriter, r *http.Request) {}).
+			Response(http.StatusOK, item{})
+	}
+
+	doc := NewOpenAPI(r.GetRoutes())
+
+	refs := map[string]string{
+		"/bytes":   "#/components/schemas/Reader",
+		"/strings": "#/components/schemas/strings.Reader",
+		"/names":   "#/components/schemas/item",
+		"/counts":  "#/components/schemas/go-router.item",
+	}
+
+	for path, ref := range refs {
+		schema := doc.Paths[path]["get"].Responses["200"].Content["application/json"].Schema
+		if schema.Ref != ref {
+			t.Errorf("GET %s response schema is: %s, expected: %s", path, schema.Ref, ref)
+		}
+	}
+
+	if len(doc.Components.Schemas) != 4 {
+		t.Errorf("schemas are: %v, expected 4", doc.Components.Schemas)
+	}
+
+	if doc.Components.Schemas["item"].Properties["name"] == nil || doc.Components.Schemas["go-router.item"].Properties["count"] == nil {
+		t.Errorf("item schemas are: %+v, %+v", doc.Components.Schemas["item"], doc.Components.Schemas["go-router.item"])
+	}
+}
+
+func TestOpenAPIHandler(t *testing.T) {
+
+	r := New()
+
+	r.Get("/openapi.json", OpenAPIHandler(r))
+	r.Get("/users/:id", func(w http.ResponseWriter, r *http.Request) {})
+
+	req, _ := http.NewRequest("GET", "/openapi.json", nil)
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("response code is: %d, expected: %d", w.Code, http.StatusOK)
+	}
+
+	var doc map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	paths := doc["paths"].(map[string]any)
+	if paths["/users/{id}"] == nil || paths["/openapi.json"] == nil {
+		t.Errorf("paths are: %v", paths)
+	}
+}
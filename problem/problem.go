@@ -0,0 +1,169 @@
+// Package problem implements RFC 9457 problem details for HTTP APIs.
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+const (
+	ContentType = "application/problem+json"
+
+	// DefaultType is used when a problem has no more specific type URI.
+	DefaultType = "about:blank"
+)
+
+// Problem is an RFC 9457 problem details object. Extensions are serialized
+// as additional top-level members.
+type Problem struct {
+	Type       string
+	Title      string
+	Status     int
+	Detail     string
+	Instance   string
+	Extensions map[string]any
+}
+
+// New returns a Problem for status with the default type and the status
+// text as its title.
+func New(status int) *Problem {
+	return &Problem{
+		Type:   DefaultType,
+		Title:  http.StatusText(status),
+		Status: status,
+	}
+}
+
+// WithDetail sets the detail and returns p.
+func (p *Problem) WithDetail(detail string) *Problem {
+	p.Detail = detail
+	return p
+}
+
+// WithInstance sets the instance and returns p.
+func (p *Problem) WithInstance(instance string) *Problem {
+	p.Instance = instance
+	return p
+}
+
+// With sets the extension member key and returns p. The standard members
+// cannot be overridden this way.
+func (p *Problem) With(key string, value any) *Problem {
+
+	if p.Extensions == nil {
+		p.Extensions = make(map[string]any)
+	}
+
+	p.Extensions[key] = value
+
+	return p
+}
+
+func (p *Problem) Error() string {
+
+	msg := p.Title
+	if msg == "" {
+		msg = "status " + strconv.Itoa(p.Status)
+	}
+
+	if p.Detail != "" {
+		msg += ": " + p.Detail
+	}
+
+	return msg
+}
+
+// StatusCode returns the problem status.
+func (p *Problem) StatusCode() int {
+	return p.Status
+}
+
+func (p *Problem) MarshalJSON() ([]byte, error) {
+
+	m := make(map[string]any, len(p.Extensions)+5)
+
+	for k, v := range p.Extensions {
+		m[k] = v
+	}
+
+	typ := p.Type
+	if typ == "" {
+		typ = DefaultType
+	}
+
+	m["type"] = typ
+
+	if p.Title != "" {
+		m["title"] = p.Title
+	}
+
+	if p.Status != 0 {
+		m["status"] = p.Status
+	}
+
+	if p.Detail != "" {
+		m["detail"] = p.Detail
+	}
+
+	if p.Instance != "" {
+		m["instance"] = p.Instance
+	}
+
+	return json.Marshal(m)
+}
+
+func (p *Problem) UnmarshalJSON(b []byte) error {
+
+	var m map[string]any
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+
+	*p = Problem{}
+
+	for k, v := range m {
+		switch k {
+		case "type":
+			p.Type, _ = v.(string)
+		case "title":
+			p.Title, _ = v.(string)
+		case "status":
+			if f, ok := v.(float64); ok {
+				p.Status = int(f)
+			}
+		case "detail":
+			p.Detail, _ = v.(string)
+		case "instance":
+			p.Instance, _ = v.(string)
+		default:
+			if p.Extensions == nil {
+				p.Extensions = make(map[string]any)
+			}
+			p.Extensions[k] = v
+		}
+	}
+
+	return nil
+}
+
+// Write writes p as an application/problem+json response.
+func Write(w http.ResponseWriter, p *Problem) {
+
+	b, err := json.Marshal(p)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	status := p.Status
+	if status == 0 {
+		status = http.StatusInternalServerError
+	}
+
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Del("Content-Length")
+	w.WriteHeader(status)
+	_, _ = w.Write(b)
+}
@@ -0,0 +1,70 @@
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+
+	w := httptest.NewRecorder()
+
+	p := New(http.StatusNotFound).
+		WithDetail("user 42 does not exist").
+		WithInstance("/users/42").
+		With("userId", 42)
+
+	Write(w, p)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("response code is: %d, expected: %d", w.Code, http.StatusNotFound)
+	}
+
+	if w.Header().Get("Content-Type") != ContentType {
+		t.Errorf("content type is: %s, expected: %s", w.Header().Get("Content-Type"), ContentType)
+	}
+
+	expected := `{"detail":"user 42 does not exist","instance":"/users/42","status":404,"title":"Not Found","type":"about:blank","userId":42}`
+	if w.Body.String() != expected {
+		t.Errorf("response body is: %s, expected: %s", w.Body.String(), expected)
+	}
+}
+
+func TestProblem_ExtensionsCannotOverrideMembers(t *testing.T) {
+
+	p := New(http.StatusBadRequest).With("status", 200)
+
+	b, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got Problem
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Status != http.StatusBadRequest {
+		t.Errorf("status is: %d, expected: %d", got.Status, http.StatusBadRequest)
+	}
+}
+
+func TestProblem_RoundTrip(t *testing.T) {
+
+	b := []byte(`{"type":"https://example.com/out-of-credit","title":"Out of credit","status":403,"balance":30}`)
+
+	var p Problem
+	if err := json.Unmarshal(b, &p); err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Type != "https://example.com/out-of-credit" || p.Status != http.StatusForbidden {
+		t.Errorf("problem is: %+v", p)
+	}
+
+	if p.Extensions["balance"] != float64(30) {
+		t.Errorf("balance is: %v, expected: %v", p.Extensions["balance"], 30)
+	}
+}
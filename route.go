@@ -0,0 +1,257 @@
+package router
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Route interface {
+	// Use(middleware ...Middleware)
+
+	// Produces restricts the route to requests accepting one of the given
+	// media types. Several routes with the same method and path can produce
+	// different media types; the router picks one with Negotiate and answers
+	// 406 Not Acceptable when none fits.
+	Produces(mediaTypes ...string) Route
+
+	// Deprecated marks the route as deprecated since at, which may be in the
+	// future. Responses carry a Deprecation header (RFC 9745) with the date
+	// and, if set with WithSunset, a Sunset header (RFC 8594) announcing
+	// when the route will be removed. It panics if at is zero.
+	Deprecated(at time.Time, options ...DeprecationOption) Route
+
+	// Summary sets a short summary of what the route does.
+	Summary(summary string) Route
+
+	// Description sets a longer description of the route.
+	Description(description string) Route
+
+	// Tags adds tags used to group the route in generated documentation and
+	// available to middleware through RouteFromContext.
+	Tags(tags ...string) Route
+
+	// Request documents the type the route binds the request into. Its
+	// path, query and header tagged fields describe the parameters and the
+	// remaining fields the body. v is only used for its type.
+	Request(v any) Route
+
+	// Response documents a response with the given status and body type. v
+	// may be nil for responses without a body.
+	Response(status int, v any) Route
+
+	// Meta stores an arbitrary value on the route. Middleware reads it from
+	// the matched route with RouteFromContext or MetaFromContext.
+	Meta(key string, value any) Route
+}
+
+// ResponseDescriptor documents a response of a route.
+type ResponseDescriptor struct {
+	Status int
+	Type   reflect.Type
+}
+
+// DeprecationOption configures the deprecation of a route.
+type DeprecationOption func(*route)
+
+// WithSunset sets the date the deprecated route will be removed.
+func WithSunset(sunset time.Time) DeprecationOption {
+	return func(rt *route) {
+		rt.sunset = sunset
+	}
+}
+
+type route struct {
+	node         *routeTreeNode
+	path         string
+	method       string
+	handler      http.HandlerFunc
+	produces     []string
+	deprecatedAt time.Time
+	sunset       time.Time
+	summary      string
+	description  string
+	tags         []string
+	requestType  reflect.Type
+	responses    []ResponseDescriptor
+	meta         map[string]any
+}
+
+func (rt *route) Produces(mediaTypes ...string) Route {
+	rt.produces = append(rt.produces, mediaTypes...)
+	return rt
+}
+
+func (rt *route) Deprecated(at time.Time, options ...DeprecationOption) Route {
+
+	if at.IsZero() {
+		panic("deprecation date must not be zero")
+	}
+
+	rt.deprecatedAt = at
+
+	for _, option := range options {
+		option(rt)
+	}
+
+	return rt
+}
+
+func (rt *route) Summary(summary string) Route {
+	rt.summary = summary
+	return rt
+}
+
+func (rt *route) Description(description string) Route {
+	rt.description = description
+	return rt
+}
+
+func (rt *route) Tags(tags ...string) Route {
+	rt.tags = append(rt.tags, tags...)
+	return rt
+}
+
+func (rt *route) Request(v any) Route {
+	rt.requestType = reflect.TypeOf(v)
+	return rt
+}
+
+func (rt *route) Response(status int, v any) Route {
+	rt.responses = append(rt.responses, ResponseDescriptor{
+		Status: status,
+		Type:   reflect.TypeOf(v),
+	})
+	return rt
+}
+
+func (rt *route) Meta(key string, value any) Route {
+	if rt.meta == nil {
+		rt.meta = make(map[string]any)
+	}
+	rt.meta[key] = value
+	return rt
+}
+
+// descriptor describes the route for GetRoutes and RouteFromContext.
+func (rt *route) descriptor() RouteDescriptor {
+
+	p := rt.path
+	if len(p) == 0 {
+		p = "/"
+	}
+
+	return RouteDescriptor{
+		Method:       rt.method,
+		Path:         p,
+		Produces:     rt.produces,
+		Deprecated:   !rt.deprecatedAt.IsZero(),
+		DeprecatedAt: rt.deprecatedAt,
+		Sunset:       rt.sunset,
+		Summary:      rt.summary,
+		Description:  rt.description,
+		Tags:         rt.tags,
+		Request:      rt.requestType,
+		Responses:    rt.responses,
+		Meta:         rt.meta,
+	}
+}
+
+// writeDeprecation sets the Deprecation and Sunset headers of a deprecated
+// route.
+func (rt *route) writeDeprecation(h http.Header) {
+
+	if rt.deprecatedAt.IsZero() {
+		return
+	}
+
+	h.Set("Deprecation", "@"+strconv.FormatInt(rt.deprecatedAt.Unix(), 10))
+
+	if !rt.sunset.IsZero() {
+		h.Set("Sunset", rt.sunset.UTC().Format(http.TimeFormat))
+	}
+}
+
+// selectRoute picks the route for req among routes registered for the same
+// method and path. Routes that produce a media type acceptable to the client
+// are preferred; a route without a Produces constraint is the fallback. It
+// returns the route and the negotiated media type, or nil if nothing fits.
+// For versioned requests vendor media types in Accept also match their
+// structured syntax suffix, so application/vnd.acme.v2+json selects a route
+// producing application/json.
+func selectRoute(routes []*route, req *http.Request, versioned bool) (*route, string) {
+
+	var fallback *route
+	var offers []string
+
+	for _, rt := range routes {
+		if len(rt.produces) == 0 {
+			fallback = rt
+			continue
+		}
+		offers = append(offers, rt.produces...)
+	}
+
+	if len(offers) == 0 {
+		return fallback, ""
+	}
+
+	if fallback != nil && len(req.Header.Values("Accept")) == 0 {
+		return fallback, ""
+	}
+
+	mediaType := negotiate(req, offers, versioned)
+	if mediaType == "" {
+		return fallback, ""
+	}
+
+	for _, rt := range routes {
+		for _, produces := range rt.produces {
+			if produces == mediaType {
+				return rt, mediaType
+			}
+		}
+	}
+
+	return fallback, ""
+}
+
+// isNegotiated reports whether any of the routes has a Produces constraint.
+func isNegotiated(routes []*route) bool {
+	for _, rt := range routes {
+		if len(rt.produces) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// isConcreteMediaType reports whether mediaType can be used as a
+// Content-Type, i.e. it has no wildcards.
+func isConcreteMediaType(mediaType string) bool {
+	return !strings.Contains(mediaType, "*")
+}
+
+// visibleRoutes drops routes without a Produces constraint that were
+// replaced by a later registration for the same method and path.
+func visibleRoutes(routes []*route) []*route {
+
+	last := -1
+	for i, rt := range routes {
+		if len(rt.produces) == 0 {
+			last = i
+		}
+	}
+
+	visible := make([]*route, 0, len(routes))
+	for i, rt := range routes {
+		if len(rt.produces) == 0 && i != last {
+			continue
+		}
+		visible = append(visible, rt)
+	}
+
+	return visible
+}
@@ -0,0 +1,248 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestRoute_MetaFromMiddleware(t *testing.T) {
+
+	req, _ := http.NewRequest("DELETE", "/invoices/9", nil)
+	w := httptest.NewRecorder()
+
+	r := New()
+
+	var scope string
+	var descriptor RouteDescriptor
+
+	r.Use(func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			scope, _ = MetaFromContext[string](r.Context(), "scope")
+			descriptor, _ = RouteFromContext(r.Context())
+			next(w, r)
+		}
+	})
+
+	r.Group("/invoices").Delete("/:id", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}).Meta("scope", "admin").Tags("billing").Summary("Delete an invoice")
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Errorf("response code is: %d, expected: %d", w.Code, http.StatusNoContent)
+	}
+
+	if scope != "admin" {
+		t.Errorf("scope is: %s, expected: %s", scope, "admin")
+	}
+
+	if descriptor.Method != http.MethodDelete || descriptor.Path != "/invoices/:id" {
+		t.Errorf("route is: %s %s, expected: %s %s", descriptor.Method, descriptor.Path, http.MethodDelete, "/invoices/:id")
+	}
+
+	if !reflect.DeepEqual(descriptor.Tags, []string{"billing"}) || descriptor.Summary != "Delete an invoice" {
+		t.Errorf("route is: %+v", descriptor)
+	}
+}
+
+func TestRoute_MetaWithoutMatch(t *testing.T) {
+
+	req, _ := http.NewRequest("POST", "/", nil)
+	w := httptest.NewRecorder()
+
+	r := New()
+
+	matched := true
+
+	r.Use(func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			_, matched = RouteFromContext(r.Context())
+			next(w, r)
+		}
+	})
+
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {}).Meta("scope", "admin")
+
+	r.ServeHTTP(w, req)
+
+	if matched {
+		t.Error("expected no matched route for a disallowed method")
+	}
+
+	if _, ok := MetaFromContext[string](req.Context(), "scope"); ok {
+		t.Error("expected no metadata outside the router")
+	}
+}
+
+func TestRoute_MetaWrongType(t *testing.T) {
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+
+	r := New()
+
+	ok := true
+
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		_, ok = MetaFromContext[int](r.Context(), "scope")
+	}).Meta("scope", "admin")
+
+	r.ServeHTTP(w, req)
+
+	if ok {
+		t.Error("expected metadata of the wrong type to be reported as missing")
+	}
+}
+
+func TestRoute_WithRouteContext(t *testing.T) {
+
+	r := New()
+
+	r.Get("/users/:id", func(w http.ResponseWriter, r *http.Request) {}).Meta("scope", "admin")
+
+	tests := []struct {
+		path    string
+		matched bool
+		pattern string
+	}{
+		{path: "/users/7", matched: true, pattern: "/users/:id"},
+		{path: "/missing", matched: false},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+
+		t.Run(tc.path, func(t *testing.T) {
+
+			req := WithRouteContext(httptest.NewRequest("GET", tc.path, nil))
+
+			if WithRouteContext(req) != req {
+				t.Error("expected a prepared request to be returned unchanged")
+			}
+
+			r.ServeHTTP(httptest.NewRecorder(), req)
+
+			descriptor, ok := RouteFromContext(req.Context())
+			if ok != tc.matched || descriptor.Path != tc.pattern {
+				t.Errorf("route is: %t %s, expected: %t %s", ok, descriptor.Path, tc.matched, tc.pattern)
+			}
+
+			if scope, _ := MetaFromContext[string](req.Context(), "scope"); tc.matched && scope != "admin" {
+				t.Errorf("scope is: %s, expected: %s", scope, "admin")
+			}
+		})
+	}
+}
+
+func TestRoute_ContextAttached(t *testing.T) {
+
+	var plain, tagged, wrapped string
+	var plainRoute bool
+	var plainMethods []string
+
+	r := New()
+
+	r.Get("/plain", func(w http.ResponseWriter, r *http.Request) {
+		plain = PatternFromContext(r.Context())
+		_, plainRoute = RouteFromContext(r.Context())
+		plainMethods = AllowedMethods(r)
+	})
+
+	r.Get("/tagged", func(w http.ResponseWriter, r *http.Request) {
+		tagged = PatternFromContext(r.Context())
+	}).Tags("users")
+
+	r.Group("/group").Use(func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			wrapped = PatternFromContext(r.Context())
+			next(w, r)
+		}
+	})
+
+	r.Get("/group/wrapped", func(w http.ResponseWriter, r *http.Request) {})
+
+	for _, path := range []string{"/plain", "/tagged", "/group/wrapped"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	// Plain routes are served without the request context, so the context
+	// functions return empty values, as documented.
+	if plain != "" {
+		t.Errorf("plain route pattern is: %s, expected none", plain)
+	}
+
+	if plainRoute {
+		t.Error("expected no route descriptor on a plain route")
+	}
+
+	if plainMethods != nil {
+		t.Errorf("plain route allowed methods are: %v, expected none", plainMethods)
+	}
+
+	// A request prepared with WithRouteContext records them on any route.
+	req := WithRouteContext(httptest.NewRequest("GET", "/plain", nil))
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	if plain != "/plain" {
+		t.Errorf("prepared plain route pattern is: %s, expected: %s", plain, "/plain")
+	}
+
+	if !plainRoute {
+		t.Error("expected a route descriptor on a prepared plain route")
+	}
+
+	if len(plainMethods) != 1 || plainMethods[0] != "GET" {
+		t.Errorf("prepared plain route allowed methods are: %v, expected: [GET]", plainMethods)
+	}
+
+	if tagged != "/tagged" {
+		t.Errorf("tagged route pattern is: %s, expected: %s", tagged, "/tagged")
+	}
+
+	if wrapped != "/group/wrapped" {
+		t.Errorf("middleware route pattern is: %s, expected: %s", wrapped, "/group/wrapped")
+	}
+}
+
+func TestRoute_PatternFromContext(t *testing.T) {
+
+	r := New()
+
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {})
+	r.Group("/users").Get("/:id", func(w http.ResponseWriter, r *http.Request) {})
+	r.Version("v2").Get("/orders/*path", func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		method  string
+		path    string
+		pattern string
+	}{
+		{method: "GET", path: "/", pattern: "/"},
+		{method: "GET", path: "/users/7", pattern: "/users/:id"},
+		{method: "DELETE", path: "/users/7", pattern: "/users/:id"},
+		{method: "GET", path: "/v2/orders/1/items", pattern: "/v2/orders/*path"},
+		{method: "GET", path: "/missing", pattern: ""},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+
+		t.Run(tc.method+" "+tc.path, func(t *testing.T) {
+
+			req := WithRouteContext(httptest.NewRequest(tc.method, tc.path, nil))
+
+			r.ServeHTTP(httptest.NewRecorder(), req)
+
+			if pattern := PatternFromContext(req.Context()); pattern != tc.pattern {
+				t.Errorf("pattern is: %s, expected: %s", pattern, tc.pattern)
+			}
+		})
+	}
+
+	if pattern := PatternFromContext(httptest.NewRequest("GET", "/", nil).Context()); pattern != "" {
+		t.Errorf("pattern outside a router is: %s, expected none", pattern)
+	}
+}
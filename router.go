@@ -2,11 +2,15 @@ package router
 
 import (
 	"net/http"
+	"reflect"
+	"strings"
+	"time"
 )
 
 const (
 	ErrPathMustStartWithSlash  = "path must start with '/'"
 	ErrPathMustNotEndWithSlash = "path must not end with '/'"
+	ErrInvalidVersion          = "version must be a non-empty path segment"
 
 	PathSep = '/'
 )
@@ -25,22 +29,35 @@ type RouteGroup interface {
 	Put(path string, handler http.HandlerFunc) Route
 	Patch(path string, handler http.HandlerFunc) Route
 	Delete(path string, handler http.HandlerFunc) Route
+	// Static takes the handler serving the files, such as
+	// middleware.FileServer, rather than file server options, because the
+	// middleware package imports this one.
+	Static(prefix string, handler http.HandlerFunc)
 	Group(prefix string) RouteGroup
+	Version(version string) RouteGroup
 	Use(middleware ...Middleware)
-}
-
-type Route interface {
-	// Use(middleware ...Middleware)
+	Cors(policy Middleware)
 }
 
 type RouteDescriptor struct {
-	Method string
-	Path   string
+	Method       string
+	Path         string
+	Produces     []string
+	Deprecated   bool
+	DeprecatedAt time.Time
+	Sunset       time.Time
+	Summary      string
+	Description  string
+	Tags         []string
+	Request      reflect.Type
+	Responses    []ResponseDescriptor
+	Meta         map[string]any
 }
 
 type router struct {
-	config *Config
-	node   *routeTreeNode
+	config   *Config
+	node     *routeTreeNode
+	versions *versionRegistry
 }
 
 func New(opts ...Option) Router {
@@ -52,6 +69,7 @@ func New(opts ...Option) Router {
 		MethodNotAllowedHandler: func(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusMethodNotAllowed)
 		},
+		VersionHeader: DefaultVersionHeader,
 	}
 
 	for _, opt := range opts {
@@ -59,8 +77,9 @@ func New(opts ...Option) Router {
 	}
 
 	rtr := &router{
-		config: config,
-		node:   newRouteTreeNode(config),
+		config:   config,
+		node:     newRouteTreeNode(config),
+		versions: &versionRegistry{},
 	}
 
 	return rtr
@@ -86,22 +105,73 @@ func (rtr *router) Delete(path string, handler http.HandlerFunc) Route {
 	return rtr.mapMethod(http.MethodDelete, path, handler)
 }
 
+// Static serves handler, usually middleware.FileServer, for GET and HEAD
+// requests to prefix and every path below it. The part of the path after
+// prefix is available as the "filePath" path value, which is empty for
+// prefix itself. A trailing slash on prefix is ignored, so "/assets/" is
+// the same as "/assets".
+func (rtr *router) Static(prefix string, handler http.HandlerFunc) {
+
+	prefix = strings.TrimRight(prefix, "/")
+	pattern := prefix + "/*filePath"
+
+	if prefix == "" {
+		prefix = "/"
+	}
+
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		rtr.mapMethod(method, prefix, handler)
+		rtr.mapMethod(method, pattern, handler)
+	}
+}
+
 func (rtr *router) Group(prefix string) RouteGroup {
 
 	node := rtr.node.GetOrCreateNode(prefix)
 
 	group := &router{
-		config: rtr.config,
-		node:   node,
+		config:   rtr.config,
+		node:     node,
+		versions: rtr.versions,
 	}
 
 	return group
 }
 
+// Version returns a group for the given API version, mounted at
+// "/{version}" below the current group. Requests that do not name a version
+// in the path are routed to it when they select it with the version header
+// (see WithVersionHeader) or a vendor media type such as
+// "application/vnd.acme.v2+json" in Accept, or when it is the default
+// version (see WithDefaultVersion).
+func (rtr *router) Version(version string) RouteGroup {
+
+	if version == "" || strings.IndexByte(version, PathSep) >= 0 {
+		panic(ErrInvalidVersion)
+	}
+
+	rtr.versions.add(rtr.node.getPath(), version)
+
+	return rtr.Group("/" + version)
+}
+
 func (rtr *router) Use(middleware ...Middleware) {
 	rtr.node.Use(middleware...)
 }
 
+// Cors sets the CORS policy of the group, usually middleware.Cors. The
+// policy runs before any other middleware of the group and answers
+// preflight requests for every path with registered routes, even when no
+// OPTIONS route exists. A nested group's policy replaces its parent's.
+func (rtr *router) Cors(policy Middleware) {
+
+	if policy == nil {
+		panic("cors policy must not be nil")
+	}
+
+	rtr.node.Cors(policy)
+}
+
 func (rtr *router) GetRoutes() []RouteDescriptor {
 
 	var routes []RouteDescriptor
@@ -120,18 +190,9 @@ func (rtr *router) GetRoutes() []RouteDescriptor {
 			break
 		}
 
-		for i, handler := range node.handlers {
-			if handler != nil {
-
-				p := node.getPath()
-				if len(p) == 0 {
-					p = "/"
-				}
-
-				routes = append(routes, RouteDescriptor{
-					Method: uint8ToMethod(uint8(i)),
-					Path:   p,
-				})
+		for _, methodRoutes := range node.routes {
+			for _, rt := range visibleRoutes(methodRoutes) {
+				routes = append(routes, rt.descriptor())
 			}
 		}
 
@@ -143,7 +204,65 @@ func (rtr *router) GetRoutes() []RouteDescriptor {
 
 func (rtr *router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
-	node := rtr.node.Find(r)
+	path := r.URL.Path
+	versioned := len(rtr.versions.mounts) > 0
+
+	var node *routeTreeNode
+	var version string
+
+	if versioned {
+
+		lookup, v, inferred := rtr.versions.resolve(path, r, rtr.config)
+
+		if lookup != path {
+			node = rtr.node.Find(lookup, r)
+			if node != nil && node.routes != nil {
+				version = v
+			} else {
+				node = nil
+			}
+		} else {
+			version = v
+		}
+
+		if inferred {
+			w.Header().Add("Vary", rtr.config.VersionHeader)
+			w.Header().Add("Vary", "Accept")
+		}
+	}
+
+	if node == nil {
+		node = rtr.node.Find(path, r)
+	}
+
+	var rt *route
+	var mediaType string
+
+	if node != nil {
+		rt, mediaType = node.Match(r, version != "")
+	}
+
+	// Reuse the context prepared by WithRouteContext, so middleware wrapping
+	// the router can see the route it matched. Otherwise the request is
+	// only given a context, which costs allocations, when something may
+	// read it.
+	rc := requestContextFrom(r.Context())
+
+	switch {
+	case rc != nil && rc.config == nil:
+	case versioned || rtr.needsContext(r, node, rt):
+		rc = &requestContext{}
+		r = withRequestContext(r, rc)
+	default:
+		node.serve(w, r, rt, mediaType)
+		return
+	}
+
+	rc.config = rtr.config
+	rc.version = version
+	rc.node = node
+	rc.route = rt
+	rc.mediaType = mediaType
 
 	if node == nil {
 		rtr.config.NotFoundHandler(w, r)
@@ -153,7 +272,21 @@ func (rtr *router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	node.handler(w, r)
 }
 
-func (rtr *router) mapMethod(method, path string, handler http.HandlerFunc) *routeTreeNode {
+// needsContext reports whether serving the request needs the request
+// context: to reach the ErrorHandler, for middleware, which may read the
+// route, for routes with metadata, tags or content negotiation, and for
+// every response other than a matched route, whose handlers may call
+// AllowedMethods or write errors. Plain routes are served without it.
+func (rtr *router) needsContext(r *http.Request, node *routeTreeNode, rt *route) bool {
+
+	if rtr.config.ErrorHandler != nil || node == nil || rt == nil || node.wrapped {
+		return true
+	}
+
+	return rt.meta != nil || len(rt.tags) > 0 || isNegotiated(node.GetRoutes(r.Method))
+}
+
+func (rtr *router) mapMethod(method, path string, handler http.HandlerFunc) *route {
 
 	if len(path) == 0 || path[0] != PathSep {
 		panic(ErrPathMustStartWithSlash)
@@ -168,6 +301,5 @@ func (rtr *router) mapMethod(method, path string, handler http.HandlerFunc) *rou
 	}
 
 	node := rtr.node.GetOrCreateNode(path)
-	node.SetHandler(method, handler)
-	return node
+	return node.AddRoute(method, handler)
 }
@@ -219,7 +219,182 @@ func BenchmarkGet_SingleRoot(b *testing.B) {
 		w.WriteHeader(200)
 	})
 
+	b.ReportAllocs()
+
+	for n := 0; n < b.N; n++ {
+		r.ServeHTTP(w, req)
+	}
+}
+
+func BenchmarkGet_Static(b *testing.B) {
+
+	req, _ := http.NewRequest("GET", "/users/list", nil)
+	w := httptest.NewRecorder()
+
+	r := New()
+
+	r.Get("/users/list", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	})
+
+	b.ReportAllocs()
+
+	for n := 0; n < b.N; n++ {
+		r.ServeHTTP(w, req)
+	}
+}
+
+// BenchmarkGet_Middleware measures a route whose middleware may read the
+// route from the request context, which then has to be attached.
+func BenchmarkGet_Middleware(b *testing.B) {
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+
+	r := New()
+
+	r.Use(func(next http.HandlerFunc) http.HandlerFunc {
+		return next
+	})
+
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	})
+
+	b.ReportAllocs()
+
 	for n := 0; n < b.N; n++ {
 		r.ServeHTTP(w, req)
 	}
 }
+
+func TestRouter_UseAfterRoutes(t *testing.T) {
+
+	req, _ := http.NewRequest("GET", "/group/endpoint", nil)
+	w := httptest.NewRecorder()
+
+	r := New()
+
+	r.Group("/group").Get("/endpoint", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	r.Use(func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Test", "test")
+			next(w, r)
+		}
+	})
+
+	r.ServeHTTP(w, req)
+
+	if w.Header().Get("X-Test") != "test" {
+		t.Errorf("response header X-Test is: %s, expected: %s", w.Header().Get("X-Test"), "test")
+	}
+}
+
+func TestRouter_MethodNotAllowedSetsAllow(t *testing.T) {
+
+	req, _ := http.NewRequest("DELETE", "/items", nil)
+	w := httptest.NewRecorder()
+
+	r := New()
+
+	r.Get("/items", func(w http.ResponseWriter, r *http.Request) {})
+	r.Post("/items", func(w http.ResponseWriter, r *http.Request) {})
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("response code is: %d, expected: %d", w.Code, http.StatusMethodNotAllowed)
+	}
+
+	if w.Header().Get("Allow") != "GET, POST" {
+		t.Errorf("response header Allow is: %s, expected: %s", w.Header().Get("Allow"), "GET, POST")
+	}
+}
+
+func TestRouter_StaticPrefix(t *testing.T) {
+
+	tests := []struct {
+		prefix   string
+		path     string
+		expected string
+	}{
+		{prefix: "/assets", path: "/assets/app.js", expected: "app.js"},
+		{prefix: "/assets/", path: "/assets/app.js", expected: "app.js"},
+		{prefix: "/assets/", path: "/assets", expected: ""},
+		{prefix: "/", path: "/app.js", expected: "app.js"},
+		{prefix: "", path: "/", expected: ""},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+
+		t.Run(tc.prefix+tc.path, func(t *testing.T) {
+
+			r := New()
+
+			filePath := "unset"
+
+			r.Static(tc.prefix, func(w http.ResponseWriter, r *http.Request) {
+				filePath = r.PathValue("filePath")
+			})
+
+			req, _ := http.NewRequest("GET", tc.path, nil)
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Errorf("response code is: %d, expected: %d", w.Code, http.StatusOK)
+			}
+
+			if filePath != tc.expected {
+				t.Errorf("filePath is: %s, expected: %s", filePath, tc.expected)
+			}
+		})
+	}
+}
+
+func TestRouter_CatchAllPathValue(t *testing.T) {
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{path: "/files/a.txt", expected: "a.txt"},
+		{path: "/files/css/site.css", expected: "css/site.css"},
+		{path: "/files/docs/", expected: "docs/"},
+	}
+
+	r := New()
+
+	var filePath string
+
+	r.Static("/files", func(w http.ResponseWriter, r *http.Request) {
+		filePath = r.PathValue("filePath")
+	})
+
+	for i := range tests {
+		tc := tests[i]
+
+		t.Run(tc.path, func(t *testing.T) {
+
+			filePath = ""
+
+			req, _ := http.NewRequest("HEAD", tc.path, nil)
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Errorf("response code is: %d, expected: %d", w.Code, http.StatusOK)
+			}
+
+			if filePath != tc.expected {
+				t.Errorf("filePath is: %s, expected: %s", filePath, tc.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package router
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const DefaultVersionHeader = "Api-Version"
+
+// versionMount records the versions registered below one path prefix.
+type versionMount struct {
+	prefix   string
+	versions map[string]bool
+}
+
+// versionRegistry is shared by a router and all of its groups.
+type versionRegistry struct {
+	mounts []*versionMount
+}
+
+func (vr *versionRegistry) add(prefix, version string) {
+
+	for _, m := range vr.mounts {
+		if m.prefix == prefix {
+			m.versions[version] = true
+			return
+		}
+	}
+
+	vr.mounts = append(vr.mounts, &versionMount{
+		prefix:   prefix,
+		versions: map[string]bool{version: true},
+	})
+
+	// Longest prefix first, so nested mounts win over the root.
+	sort.Slice(vr.mounts, func(i, j int) bool {
+		return len(vr.mounts[i].prefix) > len(vr.mounts[j].prefix)
+	})
+}
+
+// resolve returns the path to look up for req and the API version it
+// selects. A version in the path always wins; otherwise the version header,
+// a vendor media type in Accept or the default version is inserted after the
+// mount prefix. inferred reports whether the version came from anything but
+// the path, in which case the response varies on the request headers.
+func (vr *versionRegistry) resolve(path string, req *http.Request, config *Config) (lookup, version string, inferred bool) {
+
+	for _, m := range vr.mounts {
+
+		if path != m.prefix && !strings.HasPrefix(path, m.prefix+"/") {
+			continue
+		}
+
+		rest := path[len(m.prefix):]
+
+		segment := strings.TrimPrefix(rest, "/")
+		if i := strings.IndexByte(segment, PathSep); i >= 0 {
+			segment = segment[:i]
+		}
+
+		if m.versions[segment] {
+			return path, segment, false
+		}
+
+		version = m.match(req.Header.Get(config.VersionHeader))
+
+		if version == "" {
+			version = m.matchAccept(req.Header.Values("Accept"))
+		}
+
+		if version == "" {
+			version = m.match(config.DefaultVersion)
+		}
+
+		if version == "" {
+			return path, "", true
+		}
+
+		if rest == "/" {
+			rest = ""
+		}
+
+		return m.prefix + "/" + version + rest, version, true
+	}
+
+	return path, "", false
+}
+
+// match accepts "v2" as well as "2" for a version registered as "v2".
+func (m *versionMount) match(value string) string {
+
+	value = strings.TrimSpace(value)
+
+	if value == "" {
+		return ""
+	}
+
+	if m.versions[value] {
+		return value
+	}
+
+	if m.versions["v"+value] {
+		return "v" + value
+	}
+
+	return ""
+}
+
+// matchAccept looks for a vendor media type such as
+// application/vnd.acme.v2+json and returns the version it names.
+func (m *versionMount) matchAccept(accept []string) string {
+
+	for _, ar := range parseAccept(strings.Join(accept, ",")) {
+
+		if ar.q == 0 || !strings.HasPrefix(ar.subtype, "vnd.") {
+			continue
+		}
+
+		subtype, _, _ := strings.Cut(ar.subtype, "+")
+		parts := strings.Split(subtype, ".")
+
+		for i := len(parts) - 1; i > 0; i-- {
+			if v := m.match(parts[i]); v != "" {
+				return v
+			}
+		}
+	}
+
+	return ""
+}
+
+// VersionFrom returns the API version the router resolved for r, or an empty
+// string if the route is not versioned.
+func VersionFrom(r *http.Request) string {
+
+	if rc := requestContextFrom(r.Context()); rc != nil {
+		return rc.version
+	}
+
+	return ""
+}
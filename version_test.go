@@ -0,0 +1,191 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newVersionedRouter(opts ...Option) Router {
+
+	r := New(opts...)
+
+	for _, version := range []string{"v1", "v2"} {
+		v := version
+		g := r.Version(v)
+		g.Get("/users/:id", func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(v + ":" + r.PathValue("id") + ":" + VersionFrom(r)))
+		})
+	}
+
+	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	})
+
+	return r
+}
+
+func TestRouter_Version(t *testing.T) {
+
+	r := newVersionedRouter(WithDefaultVersion("v1"))
+
+	tests := []struct {
+		name     string
+		path     string
+		headers  map[string]string
+		status   int
+		expected string
+	}{
+		{name: "Path", path: "/v2/users/7", status: http.StatusOK, expected: "v2:7:v2"},
+		{name: "PathWinsOverHeader", path: "/v1/users/7", headers: map[string]string{"Api-Version": "v2"}, status: http.StatusOK, expected: "v1:7:v1"},
+		{name: "Header", path: "/users/7", headers: map[string]string{"Api-Version": "v2"}, status: http.StatusOK, expected: "v2:7:v2"},
+		{name: "HeaderWithoutPrefix", path: "/users/7", headers: map[string]string{"Api-Version": "2"}, status: http.StatusOK, expected: "v2:7:v2"},
+		{name: "MediaType", path: "/users/7", headers: map[string]string{"Accept": "application/vnd.acme.v2+json"}, status: http.StatusOK, expected: "v2:7:v2"},
+		{name: "Default", path: "/users/7", status: http.StatusOK, expected: "v1:7:v1"},
+		{name: "UnknownHeaderFallsBackToDefault", path: "/users/7", headers: map[string]string{"Api-Version": "v9"}, status: http.StatusOK, expected: "v1:7:v1"},
+		{name: "Unversioned", path: "/health", headers: map[string]string{"Api-Version": "v2"}, status: http.StatusOK, expected: "ok"},
+		{name: "UnknownPathVersion", path: "/v9/users/7", status: http.StatusNotFound},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+
+			req, _ := http.NewRequest("GET", tc.path, nil)
+			for name, value := range tc.headers {
+				req.Header.Set(name, value)
+			}
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, req)
+
+			if w.Code != tc.status {
+				t.Errorf("response code is: %d, expected: %d", w.Code, tc.status)
+			}
+
+			if tc.status == http.StatusOK && w.Body.String() != tc.expected {
+				t.Errorf("response body is: %s, expected: %s", w.Body.String(), tc.expected)
+			}
+		})
+	}
+}
+
+func TestRouter_VersionWithoutDefault(t *testing.T) {
+
+	r := newVersionedRouter()
+
+	req, _ := http.NewRequest("GET", "/users/7", nil)
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("response code is: %d, expected: %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestRouter_VersionNestedGroup(t *testing.T) {
+
+	r := New(WithVersionHeader("X-Api-Version"))
+
+	r.Group("/api").Version("v3").Get("/items", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("items"))
+	})
+
+	req, _ := http.NewRequest("GET", "/api/items", nil)
+	req.Header.Set("X-Api-Version", "v3")
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	if w.Body.String() != "items" {
+		t.Errorf("response body is: %s, expected: %s", w.Body.String(), "items")
+	}
+
+	if w.Header().Values("Vary")[0] != "X-Api-Version" {
+		t.Errorf("response header Vary is: %v, expected it to contain: %s", w.Header().Values("Vary"), "X-Api-Version")
+	}
+}
+
+func TestRouter_VersionMediaTypeWithProduces(t *testing.T) {
+
+	r := New()
+
+	v2 := r.Version("v2")
+	v2.Get("/reports", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("report"))
+	}).Produces("application/json", "text/csv")
+
+	tests := []struct {
+		name        string
+		accept      string
+		status      int
+		contentType string
+		expected    string
+	}{
+		{name: "VendorJSON", accept: "application/vnd.acme.v2+json", status: http.StatusOK, contentType: "application/json", expected: "report"},
+		{name: "VendorJSONOverCSV", accept: "text/csv;q=0.5, application/vnd.acme.v2+json", status: http.StatusOK, contentType: "application/json", expected: "report"},
+		{name: "VendorXML", accept: "application/vnd.acme.v2+xml", status: http.StatusNotAcceptable},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+
+			req, _ := http.NewRequest("GET", "/reports", nil)
+			req.Header.Set("Accept", tc.accept)
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, req)
+
+			if w.Code != tc.status {
+				t.Errorf("response code is: %d, expected: %d", w.Code, tc.status)
+			}
+
+			if tc.status != http.StatusOK {
+				return
+			}
+
+			if w.Header().Get("Content-Type") != tc.contentType {
+				t.Errorf("response header Content-Type is: %s, expected: %s", w.Header().Get("Content-Type"), tc.contentType)
+			}
+
+			if w.Body.String() != tc.expected {
+				t.Errorf("response body is: %s, expected: %s", w.Body.String(), tc.expected)
+			}
+		})
+	}
+}
+
+func TestRoute_Deprecated(t *testing.T) {
+
+	deprecatedAt := time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC)
+	sunset := time.Date(2027, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	r := New()
+
+	r.Get("/old", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}).Deprecated(deprecatedAt, WithSunset(sunset))
+
+	req, _ := http.NewRequest("GET", "/old", nil)
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	if w.Header().Get("Deprecation") != "@1772323200" {
+		t.Errorf("response header Deprecation is: %s, expected: %s", w.Header().Get("Deprecation"), "@1772323200")
+	}
+
+	if w.Header().Get("Sunset") != "Fri, 01 Jan 2027 00:00:00 GMT" {
+		t.Errorf("response header Sunset is: %s, expected: %s", w.Header().Get("Sunset"), "Fri, 01 Jan 2027 00:00:00 GMT")
+	}
+
+	routes := r.GetRoutes()
+	if !routes[0].Deprecated || !routes[0].DeprecatedAt.Equal(deprecatedAt) || !routes[0].Sunset.Equal(sunset) {
+		t.Errorf("route descriptor is: %+v, expected it to be deprecated", routes[0])
+	}
+}